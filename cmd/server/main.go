@@ -19,6 +19,7 @@ import (
 	"hmdp-backend/internal/config"
 	"hmdp-backend/internal/data"
 	"hmdp-backend/internal/handler"
+	"hmdp-backend/internal/lifecycle"
 	"hmdp-backend/internal/middleware"
 	"hmdp-backend/internal/observability"
 	"hmdp-backend/internal/router"
@@ -106,44 +107,25 @@ func main() {
 	}
 	log.Info("connected to redis", zap.String("addr", cfg.Redis.Addr))
 
-	// 初始化 Kafka
-	// 主业务的生产者
-	kafkaWriter := data.NewKafkaWriter(cfg.Kafka, cfg.Kafka.Topic)
-	// 重试和死信的生产者
-	kafkaRetryWriter := data.NewKafkaWriter(cfg.Kafka, cfg.Kafka.RetryTopic)
-	kafkaDLQWriter := data.NewKafkaWriter(cfg.Kafka, cfg.Kafka.DLQTopic)
-	// 缓存补偿的生产者
-	cacheInvalidateWriter := data.NewKafkaWriter(cfg.Kafka, cfg.Kafka.CacheInvalidateTopic)
-	cacheInvalidateDLQWriter := data.NewKafkaWriter(cfg.Kafka, cfg.Kafka.CacheInvalidateDLQTopic)
-	// 主业务消费者
-	kafkaReader := data.NewKafkaReader(cfg.Kafka, cfg.Kafka.Topic, cfg.Kafka.GroupID)
-	// 重试消费者 - 重新处理失败消息
-	kafkaRetryReader := data.NewKafkaReader(cfg.Kafka, cfg.Kafka.RetryTopic, cfg.Kafka.GroupID+"-retry")
-	// 死信消费者 - 审计与告警
-	kafkaDLQReader := data.NewKafkaReader(cfg.Kafka, cfg.Kafka.DLQTopic, cfg.Kafka.GroupID+"-dlq")
-	// 缓存补偿消费者
-	cacheInvalidateReader := data.NewKafkaReader(cfg.Kafka, cfg.Kafka.CacheInvalidateTopic, cfg.Kafka.GroupID+"-shop-cache")
-	cacheInvalidateDLQReader := data.NewKafkaReader(cfg.Kafka, cfg.Kafka.CacheInvalidateDLQTopic, cfg.Kafka.GroupID+"-shop-cache-dlq")
-	defer kafkaWriter.Close()
-	defer kafkaRetryWriter.Close()
-	defer kafkaDLQWriter.Close()
-	defer cacheInvalidateWriter.Close()
-	defer cacheInvalidateDLQWriter.Close()
-	defer kafkaReader.Close()
-	defer kafkaRetryReader.Close()
-	defer kafkaDLQReader.Close()
-	defer cacheInvalidateReader.Close()
-	defer cacheInvalidateDLQReader.Close()
-	log.Info("configured kafka",
-		zap.Strings("brokers", cfg.Kafka.Brokers),
-		zap.String("topic", cfg.Kafka.Topic),
-		zap.String("retryTopic", cfg.Kafka.RetryTopic),
-		zap.String("dlqTopic", cfg.Kafka.DLQTopic),
-		zap.String("cacheInvalidateTopic", cfg.Kafka.CacheInvalidateTopic),
-		zap.String("cacheInvalidateDLQTopic", cfg.Kafka.CacheInvalidateDLQTopic),
-		zap.String("groupID", cfg.Kafka.GroupID),
-		zap.String("retryGroupID", cfg.Kafka.GroupID+"-retry"),
-	)
+	var seckillMetrics *observability.SeckillMetrics
+	var cacheMetrics *observability.CacheMetrics
+	var queueMetrics *observability.QueueMetrics
+	var metricsRegistry *prometheus.Registry
+	if cfg.Observability.Metrics.Enabled {
+		metricsRegistry = observability.NewMetricsRegistry()
+		seckillMetrics = observability.NewSeckillMetrics(metricsRegistry, serviceName)
+		cacheMetrics = observability.NewCacheMetrics(metricsRegistry, serviceName)
+		queueMetrics = observability.NewQueueMetrics(metricsRegistry, serviceName)
+	}
+
+	// 初始化消息队列（kafka | redis | memory）
+	queues, err := newMessageQueues(cfg, redisClient, queueMetrics, log)
+	if err != nil {
+		log.Fatal("message queue init failed", zap.Error(err))
+	}
+	// 生命周期管理：停机时先停止 worker（处理完在途消息并提交 offset），再关闭消费者与生产者
+	lc := lifecycle.NewManager(log)
+	queues.registerClose(lc)
 
 	// 构建 Service Registry（传入统一 logger）
 	smtpCfg := utils.SMTPConfig{
@@ -153,34 +135,35 @@ func main() {
 		Pass: cfg.SMTP.Pass,
 		To:   cfg.SMTP.To,
 	}
-	var seckillMetrics *observability.SeckillMetrics
-	var metricsRegistry *prometheus.Registry
-	if cfg.Observability.Metrics.Enabled {
-		metricsRegistry = observability.NewMetricsRegistry()
-		seckillMetrics = observability.NewSeckillMetrics(metricsRegistry, serviceName)
-	}
 	services := service.NewRegistry(
 		db,
 		redisClient,
-		kafkaWriter,
-		kafkaRetryWriter,
-		kafkaDLQWriter,
-		cacheInvalidateWriter,
-		cacheInvalidateDLQWriter,
-		kafkaReader,
-		kafkaRetryReader,
-		kafkaDLQReader,
-		cacheInvalidateReader,
-		cacheInvalidateDLQReader,
+		queues.orderProducer,
+		queues.orderRetryProducer,
+		queues.orderDLQProducer,
+		queues.cacheInvalidateProducer,
+		queues.cacheInvalidateDLQProducer,
+		queues.orderConsumer,
+		queues.orderRetryConsumer,
+		queues.orderDLQConsumer,
+		queues.cacheInvalidateConsumer,
+		queues.cacheInvalidateDLQConsumer,
 		smtpCfg,
 		cfg.App.ShopCache,
+		cfg.App.Seckill,
 		seckillMetrics,
+		cacheMetrics,
 		log,
 	)
+	services.Start(lc)
 
 	// 初始化 Gin 引擎
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
+	// 按 IP 限流依赖 ClientIP，只信任配置的代理转发的 X-Forwarded-For
+	if err := engine.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("invalid server.trustedProxies", zap.Error(err))
+	}
 	engine.Use(gin.Recovery())
 	engine.Use(middleware.ErrorHandler(log))
 	engine.Use(middleware.RequestIDMiddleware(cfg.Observability.Logging.RequestIDHeader))
@@ -207,11 +190,22 @@ func main() {
 	}
 	log.Info("configured upload directory", zap.String("path", uploadDir))
 	// 注册健康检查端点
-	healthHandler := handler.NewHealthHandler(sqlDB, redisClient, cfg.Kafka.Brokers, log)
+	// 未使用 Kafka 时就绪检查不检测 Kafka
+	var kafkaBrokers []string
+	if cfg.Queue.Driver == "" || cfg.Queue.Driver == service.QueueDriverKafka {
+		kafkaBrokers = cfg.Kafka.Brokers
+	}
+	healthHandler := handler.NewHealthHandler(sqlDB, redisClient, kafkaBrokers, log)
 	engine.GET("/healthz", healthHandler.Healthz)
 	engine.GET("/readyz", healthHandler.Readyz)
 
-	router.RegisterRoutes(engine, services, uploadDir, redisClient)
+	var rateLimitMetrics *observability.RateLimitMetrics
+	if metricsRegistry != nil {
+		rateLimitMetrics = observability.NewRateLimitMetrics(metricsRegistry, serviceName)
+	}
+	rateLimiter := middleware.NewRateLimiter(redisClient, cfg.App.RateLimit, rateLimitMetrics, log)
+	idempotency := middleware.NewIdempotency(redisClient, cfg.App.Idempotency, log)
+	router.RegisterRoutes(engine, services, uploadDir, redisClient, cfg.App.Admin.UserIDs, rateLimiter, idempotency)
 
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
 	server := &http.Server{
@@ -234,8 +228,15 @@ func main() {
 
 	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	// 先停止接收新请求，避免停机过程中继续产生订单消息
 	if err := server.Shutdown(ctxShutdown); err != nil {
-		log.Fatal("server shutdown failed", zap.Error(err))
+		log.Error("server shutdown failed", zap.Error(err))
+	}
+	// 再停止后台 worker，排空在途消息、提交 offset 后关闭 reader 与 writer
+	ctxStop, cancelStop := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancelStop()
+	if err := lc.Stop(ctxStop); err != nil {
+		log.Error("lifecycle stop failed", zap.Error(err))
 	}
 	log.Info("server exited")
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/data"
+	"hmdp-backend/internal/lifecycle"
+	"hmdp-backend/internal/observability"
+	"hmdp-backend/internal/service"
+)
+
+// messageQueues 订单与缓存补偿链路使用的生产者与消费者
+type messageQueues struct {
+	orderProducer              service.Producer
+	orderRetryProducer         service.Producer
+	orderDLQProducer           service.Producer
+	cacheInvalidateProducer    service.Producer
+	cacheInvalidateDLQProducer service.Producer
+	orderConsumer              service.Consumer
+	orderRetryConsumer         service.Consumer
+	orderDLQConsumer           service.Consumer
+	cacheInvalidateConsumer    service.Consumer
+	cacheInvalidateDLQConsumer service.Consumer
+}
+
+// newMessageQueues 按 queue.driver 创建消息队列，topic 名称沿用 kafka 配置
+func newMessageQueues(
+	cfg *config.Config,
+	rdb *redis.Client,
+	queueMetrics *observability.QueueMetrics,
+	log *zap.Logger,
+) (*messageQueues, error) {
+	kc := cfg.Kafka
+	switch cfg.Queue.Driver {
+	case "", service.QueueDriverKafka:
+		if len(kc.Brokers) == 0 {
+			return nil, fmt.Errorf("queue driver kafka requires kafka.brokers")
+		}
+		q := &messageQueues{
+			// 主业务的生产者
+			orderProducer: service.NewKafkaProducer(data.NewKafkaWriter(kc, kc.Topic)),
+			// 重试和死信的生产者
+			orderRetryProducer: service.NewKafkaProducer(data.NewKafkaWriter(kc, kc.RetryTopic)),
+			orderDLQProducer:   service.NewKafkaProducer(data.NewKafkaWriter(kc, kc.DLQTopic)),
+			// 缓存补偿的生产者
+			cacheInvalidateProducer:    service.NewKafkaProducer(data.NewKafkaWriter(kc, kc.CacheInvalidateTopic)),
+			cacheInvalidateDLQProducer: service.NewKafkaProducer(data.NewKafkaWriter(kc, kc.CacheInvalidateDLQTopic)),
+			// 主业务消费者
+			orderConsumer: service.NewKafkaConsumer(data.NewKafkaReader(kc, kc.Topic, kc.GroupID)),
+			// 重试消费者 - 重新处理失败消息
+			orderRetryConsumer: service.NewKafkaConsumer(data.NewKafkaReader(kc, kc.RetryTopic, kc.GroupID+"-retry")),
+			// 死信消费者 - 审计与告警
+			orderDLQConsumer: service.NewKafkaConsumer(data.NewKafkaReader(kc, kc.DLQTopic, kc.GroupID+"-dlq")),
+			// 缓存补偿消费者
+			cacheInvalidateConsumer:    service.NewKafkaConsumer(data.NewKafkaReader(kc, kc.CacheInvalidateTopic, kc.GroupID+"-shop-cache")),
+			cacheInvalidateDLQConsumer: service.NewKafkaConsumer(data.NewKafkaReader(kc, kc.CacheInvalidateDLQTopic, kc.GroupID+"-shop-cache-dlq")),
+		}
+		log.Info("configured kafka",
+			zap.Strings("brokers", kc.Brokers),
+			zap.String("topic", kc.Topic),
+			zap.String("retryTopic", kc.RetryTopic),
+			zap.String("dlqTopic", kc.DLQTopic),
+			zap.String("cacheInvalidateTopic", kc.CacheInvalidateTopic),
+			zap.String("cacheInvalidateDLQTopic", kc.CacheInvalidateDLQTopic),
+			zap.String("groupID", kc.GroupID),
+			zap.String("retryGroupID", kc.GroupID+"-retry"),
+		)
+		return q, nil
+	case service.QueueDriverRedis:
+		rc := cfg.Queue.Redis
+		q := &messageQueues{
+			orderProducer:              service.NewRedisStreamProducer(rdb, rc, kc.Topic),
+			orderRetryProducer:         service.NewRedisStreamProducer(rdb, rc, kc.RetryTopic),
+			orderDLQProducer:           service.NewRedisStreamProducer(rdb, rc, kc.DLQTopic),
+			cacheInvalidateProducer:    service.NewRedisStreamProducer(rdb, rc, kc.CacheInvalidateTopic),
+			cacheInvalidateDLQProducer: service.NewRedisStreamProducer(rdb, rc, kc.CacheInvalidateDLQTopic),
+			// 消费者组命名与 Kafka 一致
+			orderConsumer:              service.NewRedisStreamConsumer(rdb, rc, kc.Topic, kc.GroupID, queueMetrics, log),
+			orderRetryConsumer:         service.NewRedisStreamConsumer(rdb, rc, kc.RetryTopic, kc.GroupID+"-retry", queueMetrics, log),
+			orderDLQConsumer:           service.NewRedisStreamConsumer(rdb, rc, kc.DLQTopic, kc.GroupID+"-dlq", queueMetrics, log),
+			cacheInvalidateConsumer:    service.NewRedisStreamConsumer(rdb, rc, kc.CacheInvalidateTopic, kc.GroupID+"-shop-cache", queueMetrics, log),
+			cacheInvalidateDLQConsumer: service.NewRedisStreamConsumer(rdb, rc, kc.CacheInvalidateDLQTopic, kc.GroupID+"-shop-cache-dlq", queueMetrics, log),
+		}
+		log.Info("configured redis streams queue", zap.String("groupID", kc.GroupID))
+		return q, nil
+	case service.QueueDriverMemory:
+		broker := service.NewMemoryBroker(cfg.Queue.MemoryBuffer)
+		log.Warn("using in-memory message queue, messages are lost on restart")
+		return &messageQueues{
+			orderProducer:              broker.Producer(kc.Topic),
+			orderRetryProducer:         broker.Producer(kc.RetryTopic),
+			orderDLQProducer:           broker.Producer(kc.DLQTopic),
+			cacheInvalidateProducer:    broker.Producer(kc.CacheInvalidateTopic),
+			cacheInvalidateDLQProducer: broker.Producer(kc.CacheInvalidateDLQTopic),
+			orderConsumer:              broker.Consumer(kc.Topic),
+			orderRetryConsumer:         broker.Consumer(kc.RetryTopic),
+			orderDLQConsumer:           broker.Consumer(kc.DLQTopic),
+			cacheInvalidateConsumer:    broker.Consumer(kc.CacheInvalidateTopic),
+			cacheInvalidateDLQConsumer: broker.Consumer(kc.CacheInvalidateDLQTopic),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown queue driver %q", cfg.Queue.Driver)
+	}
+}
+
+// registerClose 停机时在 worker 退出后关闭生产者与消费者
+// 关闭按注册的逆序执行：先关闭消费者，再关闭生产者（worker 退出前仍可能写重试/死信）
+func (q *messageQueues) registerClose(lc *lifecycle.Manager) {
+	lc.OnStop("order producer", q.orderProducer.Close)
+	lc.OnStop("order retry producer", q.orderRetryProducer.Close)
+	lc.OnStop("order dlq producer", q.orderDLQProducer.Close)
+	lc.OnStop("cache invalidate producer", q.cacheInvalidateProducer.Close)
+	lc.OnStop("cache invalidate dlq producer", q.cacheInvalidateDLQProducer.Close)
+	lc.OnStop("order consumer", q.orderConsumer.Close)
+	lc.OnStop("order retry consumer", q.orderRetryConsumer.Close)
+	lc.OnStop("order dlq consumer", q.orderDLQConsumer.Close)
+	lc.OnStop("cache invalidate consumer", q.cacheInvalidateConsumer.Close)
+	lc.OnStop("cache invalidate dlq consumer", q.cacheInvalidateDLQConsumer.Close)
+}
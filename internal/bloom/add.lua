@@ -0,0 +1,10 @@
+-- 批量置位：ARGV 为所有元素的位偏移
+-- key 不存在（未预热或正在重建替换前）时不写入，返回 0：
+-- 只含部分元素的位图会被 check.lua 视为已创建，从而误拦截其余全部元素，并跳过启动预热
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    return 0
+end
+for i = 1, #ARGV do
+    redis.call('SETBIT', KEYS[1], ARGV[i], 1)
+end
+return 1
@@ -0,0 +1,194 @@
+// Package bloom 提供基于 Redis 位图的布隆过滤器：按预期元素数与目标误判率计算位数 m 与哈希个数 k，
+// 使用 Kirsch–Mitzenmacher 双重哈希生成 k 个位偏移，批量写入与检查各只需一次 Lua 调用。
+// 商铺、用户、优惠券等实体各创建一个 Filter 即可复用。
+package bloom
+
+import (
+	"context"
+	_ "embed"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultExpectedItems     = 100000
+	defaultFalsePositiveRate = 0.01
+	// maxBits Redis 字符串最大 512MB，位图最多 2^32 位
+	maxBits = 1 << 32
+	// secondHashSeed 第二个哈希函数的种子，与第一个（种子 0）相互独立
+	secondHashSeed = 0x9e3779b97f4a7c15
+)
+
+//go:embed add.lua
+var addLuaSource string
+
+//go:embed check.lua
+var checkLuaSource string
+
+var (
+	addLua   = redis.NewScript(addLuaSource)
+	checkLua = redis.NewScript(checkLuaSource)
+)
+
+// Options 布隆过滤器配置
+type Options struct {
+	Key               string  // Redis key 前缀，完整 key 带上 m 与 k，参数变化后自动使用新的位图
+	ExpectedItems     int64   // 预期元素数 n，缺省 100000
+	FalsePositiveRate float64 // 元素数达到 n 时的目标误判率 p，缺省 0.01
+}
+
+// Filter Redis 布隆过滤器
+type Filter struct {
+	rdb  *redis.Client
+	key  string
+	opts Options
+	m    uint64 // 位数
+	k    int    // 哈希个数
+}
+
+// Stats 布隆过滤器状态
+type Stats struct {
+	Bits         int64   `json:"bits"`         // 位数组大小 m
+	Hashes       int     `json:"hashes"`       // 哈希函数个数 k
+	Capacity     int64   `json:"capacity"`     // 预期元素数 n
+	TargetFPR    float64 `json:"targetFpr"`    // 目标误判率 p
+	SetBits      int64   `json:"setBits"`      // 已置位的位数
+	FillRatio    float64 `json:"fillRatio"`    // 置位比例
+	EstimatedFPR float64 `json:"estimatedFpr"` // 估算误判率 = fillRatio ^ k
+}
+
+// New 创建布隆过滤器，按 opts 计算 m 与 k
+func New(rdb *redis.Client, opts Options) *Filter {
+	if opts.ExpectedItems <= 0 {
+		opts.ExpectedItems = defaultExpectedItems
+	}
+	if opts.FalsePositiveRate <= 0 || opts.FalsePositiveRate >= 1 {
+		opts.FalsePositiveRate = defaultFalsePositiveRate
+	}
+	m, k := OptimalParams(opts.ExpectedItems, opts.FalsePositiveRate)
+	return &Filter{
+		rdb:  rdb,
+		key:  opts.Key + ":" + strconv.FormatUint(m, 10) + ":" + strconv.Itoa(k),
+		opts: opts,
+		m:    m,
+		k:    k,
+	}
+}
+
+// OptimalParams 计算 n 个元素、误判率 p 所需的位数 m = -n·ln(p)/(ln2)² 与哈希个数 k = m/n·ln2
+func OptimalParams(n int64, p float64) (uint64, int) {
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	if m < 1 {
+		m = 1
+	}
+	if m > maxBits {
+		m = maxBits
+	}
+	k := int(math.Round(m / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return uint64(m), k
+}
+
+// Key 位图的完整 Redis key
+func (f *Filter) Key() string { return f.key }
+
+// Bits 位数 m
+func (f *Filter) Bits() uint64 { return f.m }
+
+// Hashes 哈希个数 k
+func (f *Filter) Hashes() int { return f.k }
+
+// WithKey 返回写入另一个 key 的同参数过滤器，用于重建时先写临时 key
+func (f *Filter) WithKey(key string) *Filter {
+	clone := *f
+	clone.key = key
+	return &clone
+}
+
+// Locations 双重哈希生成 k 个位偏移：g_i = (h1 + i·h2) mod m
+func (f *Filter) Locations(item string) []uint64 {
+	h1 := xxhash.Sum64String(item)
+	d := xxhash.NewWithSeed(secondHashSeed)
+	_, _ = d.WriteString(item)
+	h2 := d.Sum64() % f.m
+	if h2 == 0 {
+		// h2 为 0 时 k 个偏移会重合
+		h2 = 1
+	}
+	h1 %= f.m
+	res := make([]uint64, f.k)
+	for i := range res {
+		res[i] = (h1 + uint64(i)*h2) % f.m
+	}
+	return res
+}
+
+// Reserve 预先分配完整的位数组，ttl > 0 时设置过期时间（重建中断时自动清理）
+func (f *Filter) Reserve(ctx context.Context, ttl time.Duration) error {
+	_, err := f.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetBit(ctx, f.key, int64(f.m-1), 0)
+		if ttl > 0 {
+			pipe.Expire(ctx, f.key, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Add 批量写入元素，一次 Lua 调用；位图尚未创建时不写入，由 Reserve 创建后再全量写入（预热/重建）
+func (f *Filter) Add(ctx context.Context, items ...string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(items)*f.k)
+	for _, item := range items {
+		for _, off := range f.Locations(item) {
+			args = append(args, off)
+		}
+	}
+	return addLua.Run(ctx, f.rdb, []string{f.key}, args...).Err()
+}
+
+// MightContain 检查元素是否可能存在；位图尚未创建（未预热）时返回 true 放行
+func (f *Filter) MightContain(ctx context.Context, item string) (bool, error) {
+	offsets := f.Locations(item)
+	args := make([]interface{}, len(offsets))
+	for i, off := range offsets {
+		args[i] = off
+	}
+	res, err := checkLua.Run(ctx, f.rdb, []string{f.key}, args...).Int()
+	if err != nil {
+		return false, err
+	}
+	return res != 0, nil
+}
+
+// Exists 位图是否已创建
+func (f *Filter) Exists(ctx context.Context) (bool, error) {
+	n, err := f.rdb.Exists(ctx, f.key).Result()
+	return n > 0, err
+}
+
+// Stats 统计置位比例与估算误判率
+func (f *Filter) Stats(ctx context.Context) (*Stats, error) {
+	setBits, err := f.rdb.BitCount(ctx, f.key, nil).Result()
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{
+		Bits:      int64(f.m),
+		Hashes:    f.k,
+		Capacity:  f.opts.ExpectedItems,
+		TargetFPR: f.opts.FalsePositiveRate,
+		SetBits:   setBits,
+	}
+	stats.FillRatio = float64(setBits) / float64(f.m)
+	stats.EstimatedFPR = math.Pow(stats.FillRatio, float64(f.k))
+	return stats, nil
+}
@@ -0,0 +1,113 @@
+package bloom
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestOptimalParams(t *testing.T) {
+	m, k := OptimalParams(100000, 0.01)
+	if m != 958506 || k != 7 {
+		t.Fatalf("unexpected m=%d k=%d", m, k)
+	}
+	if m, _ := OptimalParams(1<<40, 1e-9); m != maxBits {
+		t.Fatalf("expected m capped at %d, got %d", uint64(maxBits), m)
+	}
+	f := New(nil, Options{Key: "bloom:test"})
+	if f.Bits() != 958506 || f.Hashes() != 7 || f.Key() != "bloom:test:958506:7" {
+		t.Fatalf("unexpected defaults m=%d k=%d key=%s", f.Bits(), f.Hashes(), f.Key())
+	}
+}
+
+// TestFalsePositiveRate 按双重哈希偏移在内存位图中模拟，实际误判率应接近目标值
+func TestFalsePositiveRate(t *testing.T) {
+	const n = 20000
+	f := New(nil, Options{Key: "bloom:test", ExpectedItems: n, FalsePositiveRate: 0.01})
+	bits := make([]bool, f.Bits())
+	for i := 0; i < n; i++ {
+		for _, off := range f.Locations(strconv.Itoa(i)) {
+			bits[off] = true
+		}
+	}
+	for i := 0; i < n; i++ {
+		for _, off := range f.Locations(strconv.Itoa(i)) {
+			if !bits[off] {
+				t.Fatalf("false negative for %d", i)
+			}
+		}
+	}
+
+	falsePositives := 0
+	const probes = 100000
+	for i := n; i < n+probes; i++ {
+		hit := true
+		for _, off := range f.Locations(strconv.Itoa(i)) {
+			if !bits[off] {
+				hit = false
+				break
+			}
+		}
+		if hit {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / probes; rate > 0.015 {
+		t.Fatalf("false positive rate %.4f exceeds target", rate)
+	}
+}
+
+// TestFilterRedis 未创建时放行且 Add 不创建 key，写入后命中，重建用的临时 key 与线上 key 互不影响（依赖本地 Redis）
+func TestFilterRedis(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	f := New(rdb, Options{Key: "test:bloom:" + strconv.FormatInt(time.Now().UnixNano(), 10), ExpectedItems: 1000})
+	build := f.WithKey(f.Key() + ":build")
+	defer rdb.Del(ctx, f.Key(), build.Key())
+
+	if ok, err := f.MightContain(ctx, "1"); err != nil || !ok {
+		t.Fatalf("expected pass before creation, got %v %v", ok, err)
+	}
+	// 未创建时 Add 不写入，否则只含部分元素的位图会误拦截其余元素
+	if err := f.Add(ctx, "1"); err != nil {
+		t.Fatalf("add before creation: %v", err)
+	}
+	if exists, err := f.Exists(ctx); err != nil || exists {
+		t.Fatalf("expected add to skip missing key, got %v %v", exists, err)
+	}
+	if ok, err := f.MightContain(ctx, "2"); err != nil || !ok {
+		t.Fatalf("expected pass after skipped add, got %v %v", ok, err)
+	}
+	if err := build.Reserve(ctx, time.Minute); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if err := build.Add(ctx, "1", "2", "3"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if exists, err := f.Exists(ctx); err != nil || exists {
+		t.Fatalf("expected live key untouched, got %v %v", exists, err)
+	}
+	for _, item := range []string{"1", "2", "3"} {
+		if ok, err := build.MightContain(ctx, item); err != nil || !ok {
+			t.Fatalf("expected %s present, got %v %v", item, ok, err)
+		}
+	}
+	if ok, err := build.MightContain(ctx, "404"); err != nil || ok {
+		t.Fatalf("expected 404 absent, got %v %v", ok, err)
+	}
+	stats, err := build.Stats(ctx)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.SetBits == 0 || stats.SetBits > int64(3*build.Hashes()) || stats.Bits != int64(build.Bits()) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,10 @@
+-- 检查元素的全部位偏移：key 不存在返回 -1，任一位为 0 返回 0，全部为 1 返回 1
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    return -1
+end
+for i = 1, #ARGV do
+    if redis.call('GETBIT', KEYS[1], ARGV[i]) == 0 then
+        return 0
+    end
+end
+return 1
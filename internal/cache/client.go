@@ -0,0 +1,311 @@
+// Package cache 提供通用的多级缓存客户端：本地 BigCache + Redis，
+// 支持互斥锁重建、逻辑过期、singleflight 合并回源与空值缓存，各实体按需配置策略与 TTL。
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"hmdp-backend/internal/utils"
+)
+
+// Strategy 缓存未命中或过期时的回源策略
+type Strategy string
+
+const (
+	// StrategyMutex Redis 互斥锁：只有拿到锁的实例回源，其他请求等待后重查缓存，适合热点 key 防击穿
+	StrategyMutex Strategy = "mutex"
+	// StrategyLogicalExpire 逻辑过期：Redis 中数据不设 TTL，过期后返回旧值并由拿到锁的请求异步重建，需要预热
+	StrategyLogicalExpire Strategy = "logical_expire"
+	// StrategySingleflight 进程内合并回源：同一实例同一 key 只回源一次，不依赖 Redis 锁
+	StrategySingleflight Strategy = "singleflight"
+)
+
+const (
+	defaultLockTTL        = 10 * time.Second
+	defaultLockRetryDelay = 50 * time.Millisecond
+	// nullValue Redis 中的空值标记；本地缓存用 localNullValue 表示，避免与空数据混淆
+	nullValue = ""
+)
+
+var localNullValue = []byte{0}
+
+// ErrNotFound 数据不存在：Loader 返回该错误表示数据源中没有这条数据，开启空值缓存时会缓存空值
+var ErrNotFound = errors.New("cache: not found")
+
+// Loader 从数据源加载一条数据，不存在时返回 ErrNotFound
+type Loader[T any] func(ctx context.Context, id string) (*T, error)
+
+// Options 缓存客户端配置，每类实体一份
+type Options[T any] struct {
+	Name       string        // 实体名称，用于日志
+	KeyPrefix  string        // 缓存 key 前缀，完整 key 为 KeyPrefix + id
+	LockPrefix string        // 互斥锁 key 前缀，为空时使用 "lock:" + KeyPrefix
+	Strategy   Strategy      // Get 使用的默认策略，缺省为 StrategyMutex
+	TTL        time.Duration // Redis 缓存时间；逻辑过期策略下为逻辑过期时间
+	NullTTL    time.Duration // 空值缓存时间，0 表示不缓存空值
+	LockTTL    time.Duration // 互斥锁过期时间，缺省 10s
+	Loader     Loader[T]     // 回源函数
+	// Invalidator 非空时删除本地缓存会广播给其他实例
+	Invalidator *Invalidator
+}
+
+// Client 类型化的多级缓存客户端；local 为 nil 时只使用 Redis
+type Client[T any] struct {
+	rdb   *redis.Client
+	local *bigcache.BigCache
+	opts  Options[T]
+	group singleflight.Group
+	log   *zap.Logger
+}
+
+// logicalData 逻辑过期缓存的存储格式，与 utils.RedisData 保持一致
+type logicalData[T any] struct {
+	ExpireTime time.Time `json:"expireTime"`
+	Data       *T        `json:"data"`
+}
+
+// New 创建缓存客户端
+func New[T any](rdb *redis.Client, local *bigcache.BigCache, opts Options[T], log *zap.Logger) *Client[T] {
+	if log == nil {
+		log = zap.NewNop()
+	}
+	if opts.Strategy == "" {
+		opts.Strategy = StrategyMutex
+	}
+	if opts.LockPrefix == "" {
+		opts.LockPrefix = "lock:" + opts.KeyPrefix
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = defaultLockTTL
+	}
+	opts.Invalidator.register(opts.Name, local)
+	return &Client[T]{rdb: rdb, local: local, opts: opts, log: log.With(zap.String("cache", opts.Name))}
+}
+
+// Key 返回 id 对应的缓存 key
+func (c *Client[T]) Key(id string) string {
+	return c.opts.KeyPrefix + id
+}
+
+// Get 按配置的默认策略查询，数据不存在时返回 ErrNotFound；逻辑过期策略下缓存未预热时返回 nil, nil
+func (c *Client[T]) Get(ctx context.Context, id string) (*T, error) {
+	switch c.opts.Strategy {
+	case StrategyLogicalExpire:
+		return c.GetWithLogicalExpire(ctx, id)
+	case StrategySingleflight:
+		return c.GetWithSingleflight(ctx, id)
+	default:
+		return c.GetWithMutex(ctx, id)
+	}
+}
+
+// GetWithMutex 本地缓存 -> Redis -> 互斥锁回源；拿不到锁时短暂休眠后重查缓存
+func (c *Client[T]) GetWithMutex(ctx context.Context, id string) (*T, error) {
+	key := c.Key(id)
+	lock := utils.NewRedisLock(c.rdb, c.opts.LockPrefix+id, c.opts.LockTTL)
+	for {
+		if v, hit, err := c.lookup(ctx, key); hit || err != nil {
+			return v, err
+		}
+
+		locked, err := lock.TryLock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !locked {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(defaultLockRetryDelay):
+			}
+			continue
+		}
+		// DoubleCheck 拿到锁后再查一次，其他实例可能刚完成重建
+		v, hit, err := c.lookup(ctx, key)
+		if !hit && err == nil {
+			v, err = c.load(ctx, id, key)
+		}
+		// 回源超过 LockTTL 时锁可能已被其他实例持有，按 token 释放不会删除别人的锁
+		_ = lock.Unlock(context.WithoutCancel(ctx))
+		return v, err
+	}
+}
+
+// GetWithSingleflight 本地缓存 -> Redis -> 进程内合并回源
+func (c *Client[T]) GetWithSingleflight(ctx context.Context, id string) (*T, error) {
+	key := c.Key(id)
+	if v, hit, err := c.lookup(ctx, key); hit || err != nil {
+		return v, err
+	}
+	res, err, _ := c.group.Do(key, func() (interface{}, error) {
+		// 回源结果共享给同一 key 的并发请求，不受首个请求取消的影响
+		return c.load(context.WithoutCancel(ctx), id, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*T), nil
+}
+
+// GetWithLogicalExpire 读取逻辑过期缓存：未过期直接返回；已过期时返回旧值，并由拿到锁的请求异步重建
+// 缓存未预热时返回 nil, nil，需通过 SetLogicalExpire 或定时任务提前写入
+func (c *Client[T]) GetWithLogicalExpire(ctx context.Context, id string) (*T, error) {
+	key := c.Key(id)
+	cached, err := c.rdb.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if cached == nullValue {
+		return nil, ErrNotFound
+	}
+	var wrapped logicalData[T]
+	if err := json.Unmarshal([]byte(cached), &wrapped); err != nil {
+		return nil, err
+	}
+	if wrapped.ExpireTime.After(time.Now()) {
+		return wrapped.Data, nil
+	}
+
+	lock := utils.NewRedisLock(c.rdb, c.opts.LockPrefix+id, c.opts.LockTTL)
+	locked, err := lock.TryLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if locked {
+		go func() {
+			bg := context.WithoutCancel(ctx)
+			defer func() {
+				_ = lock.Unlock(bg)
+			}()
+			if err := c.rebuildLogicalExpire(bg, id); err != nil {
+				c.log.Warn("rebuild logical expire cache failed", zap.String("key", key), zap.Error(err))
+			}
+		}()
+	}
+	return wrapped.Data, nil
+}
+
+// SetLogicalExpire 写入逻辑过期缓存（Redis 不设 TTL），用于预热
+func (c *Client[T]) SetLogicalExpire(ctx context.Context, id string, value *T) error {
+	data, err := json.Marshal(logicalData[T]{ExpireTime: time.Now().Add(c.opts.TTL), Data: value})
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, c.Key(id), data, 0).Err()
+}
+
+// Delete 删除 Redis 缓存，并删除所有实例的本地缓存
+func (c *Client[T]) Delete(ctx context.Context, id string) error {
+	key := c.Key(id)
+	if err := c.rdb.Del(ctx, key).Err(); err != nil {
+		return err
+	}
+	c.InvalidateLocal(ctx, key)
+	return nil
+}
+
+// InvalidateLocal 按完整 key 删除本机缓存，并广播给其他实例；广播失败只记日志，其他实例的副本在本地 TTL 后过期
+func (c *Client[T]) InvalidateLocal(ctx context.Context, key string) {
+	if c.local == nil {
+		return
+	}
+	_ = c.local.Delete(key)
+	if err := c.opts.Invalidator.Publish(ctx, c.opts.Name, key); err != nil {
+		c.log.Warn("broadcast local cache invalidation failed", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// rebuildLogicalExpire 回源并重写逻辑过期缓存；数据已不存在时按空值处理
+func (c *Client[T]) rebuildLogicalExpire(ctx context.Context, id string) error {
+	v, err := c.opts.Loader(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		if c.opts.NullTTL > 0 {
+			return c.rdb.Set(ctx, c.Key(id), nullValue, c.opts.NullTTL).Err()
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.SetLogicalExpire(ctx, id, v)
+}
+
+// lookup 依次查询本地缓存与 Redis，hit 表示命中（包括空值，此时返回 ErrNotFound）
+func (c *Client[T]) lookup(ctx context.Context, key string) (*T, bool, error) {
+	if c.local != nil {
+		if data, err := c.local.Get(key); err == nil {
+			if string(data) == string(localNullValue) {
+				return nil, true, ErrNotFound
+			}
+			var v T
+			if err := json.Unmarshal(data, &v); err == nil {
+				return &v, true, nil
+			}
+			_ = c.local.Delete(key)
+		}
+	}
+
+	cached, err := c.rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if cached == nullValue {
+		c.setLocal(key, localNullValue)
+		return nil, true, ErrNotFound
+	}
+	var v T
+	if err := json.Unmarshal([]byte(cached), &v); err != nil {
+		return nil, false, err
+	}
+	c.setLocal(key, []byte(cached))
+	return &v, true, nil
+}
+
+// load 回源并写入 Redis 与本地缓存；数据不存在且开启空值缓存时写入空值
+func (c *Client[T]) load(ctx context.Context, id, key string) (*T, error) {
+	v, err := c.opts.Loader(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		if c.opts.NullTTL > 0 {
+			if setErr := c.rdb.Set(ctx, key, nullValue, c.opts.NullTTL).Err(); setErr != nil {
+				c.log.Warn("cache null value failed", zap.String("key", key), zap.Error(setErr))
+			}
+			c.setLocal(key, localNullValue)
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.rdb.Set(ctx, key, data, c.opts.TTL).Err(); err != nil {
+		return nil, err
+	}
+	c.setLocal(key, data)
+	return v, nil
+}
+
+func (c *Client[T]) setLocal(key string, data []byte) {
+	if c.local == nil || len(data) == 0 {
+		return
+	}
+	if err := c.local.Set(key, data); err != nil {
+		c.log.Debug("local cache set failed", zap.String("key", key), zap.Error(err))
+	}
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/redis/go-redis/v9"
+)
+
+type item struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestNewDefaults(t *testing.T) {
+	c := New[item](nil, nil, Options[item]{KeyPrefix: "cache:item:"}, nil)
+	if c.opts.Strategy != StrategyMutex || c.opts.LockPrefix != "lock:cache:item:" || c.opts.LockTTL != defaultLockTTL {
+		t.Fatalf("unexpected defaults %+v", c.opts)
+	}
+	if c.Key("1") != "cache:item:1" {
+		t.Fatalf("unexpected key %s", c.Key("1"))
+	}
+}
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb
+}
+
+// TestClientStrategies 各策略的回源次数、空值缓存与逻辑过期重建（依赖本地 Redis）
+func TestClientStrategies(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	local, err := bigcache.New(ctx, bigcache.DefaultConfig(time.Minute))
+	if err != nil {
+		t.Fatalf("init local cache: %v", err)
+	}
+	prefix := "test:cache:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"
+	defer func() {
+		keys, _ := rdb.Keys(ctx, prefix+"*").Result()
+		if len(keys) > 0 {
+			rdb.Del(ctx, keys...)
+		}
+	}()
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context, id string) (*item, error) {
+		loads.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		if id == "missing" {
+			return nil, ErrNotFound
+		}
+		return &item{ID: id, Name: "v" + strconv.Itoa(int(loads.Load()))}, nil
+	}
+
+	for _, strategy := range []Strategy{StrategyMutex, StrategySingleflight} {
+		loads.Store(0)
+		c := New(rdb, local, Options[item]{
+			Name:      string(strategy),
+			KeyPrefix: prefix + string(strategy) + ":",
+			Strategy:  strategy,
+			TTL:       time.Minute,
+			NullTTL:   time.Minute,
+			Loader:    loader,
+		}, nil)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if v, err := c.Get(ctx, "1"); err != nil || v.ID != "1" {
+					t.Errorf("%s: unexpected result %+v %v", strategy, v, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := loads.Load(); n != 1 {
+			t.Fatalf("%s: expected one load, got %d", strategy, n)
+		}
+
+		for i := 0; i < 2; i++ {
+			if _, err := c.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("%s: expected ErrNotFound, got %v", strategy, err)
+			}
+		}
+		if n := loads.Load(); n != 2 {
+			t.Fatalf("%s: expected null value cached, loads=%d", strategy, n)
+		}
+		if cached, _ := rdb.Get(ctx, c.Key("missing")).Result(); cached != nullValue {
+			t.Fatalf("%s: expected null value in redis, got %q", strategy, cached)
+		}
+		if data, err := local.Get(c.Key("missing")); err != nil || string(data) != string(localNullValue) {
+			t.Fatalf("%s: expected null value in local cache, got %q %v", strategy, data, err)
+		}
+		if err := c.Delete(ctx, "missing"); err != nil {
+			t.Fatalf("%s: delete: %v", strategy, err)
+		}
+		_, _ = c.Get(ctx, "missing")
+		if n := loads.Load(); n != 3 {
+			t.Fatalf("%s: expected reload after delete, loads=%d", strategy, n)
+		}
+	}
+
+	loads.Store(0)
+	logical := New(rdb, nil, Options[item]{
+		Name:      "logical",
+		KeyPrefix: prefix + "logical:",
+		Strategy:  StrategyLogicalExpire,
+		TTL:       -time.Second, // 写入即过期
+		Loader:    loader,
+	}, nil)
+	if v, err := logical.Get(ctx, "1"); v != nil || err != nil {
+		t.Fatalf("expected nil before preheat, got %+v %v", v, err)
+	}
+	if err := logical.SetLogicalExpire(ctx, "1", &item{ID: "1", Name: "old"}); err != nil {
+		t.Fatalf("preheat: %v", err)
+	}
+	if v, err := logical.Get(ctx, "1"); err != nil || v.Name != "old" {
+		t.Fatalf("expected stale value, got %+v %v", v, err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for loads.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if loads.Load() != 1 {
+		t.Fatalf("expected async rebuild")
+	}
+}
+
+// TestMutexUnlockKeepsOtherHolder 回源超过 LockTTL、锁已被其他实例持有时，释放不会删除别人的锁（依赖本地 Redis）
+func TestMutexUnlockKeepsOtherHolder(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestRedis(t)
+	prefix := "test:cache:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"
+	c := New(rdb, nil, Options[item]{
+		KeyPrefix: prefix,
+		TTL:       time.Minute,
+		LockTTL:   50 * time.Millisecond,
+		Loader: func(ctx context.Context, id string) (*item, error) {
+			time.Sleep(100 * time.Millisecond)
+			// 原锁已过期，模拟其他实例拿到锁
+			rdb.Set(ctx, "lock:"+prefix+id, "other", time.Minute)
+			return &item{ID: id}, nil
+		},
+	}, nil)
+	defer rdb.Del(ctx, c.Key("1"), "lock:"+prefix+"1")
+
+	if v, err := c.GetWithMutex(ctx, "1"); err != nil || v.ID != "1" {
+		t.Fatalf("unexpected result %+v %v", v, err)
+	}
+	if holder, err := rdb.Get(ctx, "lock:"+prefix+"1").Result(); err != nil || holder != "other" {
+		t.Fatalf("expected other holder's lock kept, got %q %v", holder, err)
+	}
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/observability"
+)
+
+// invalidateChannel 本地缓存失效广播频道，所有实例共用
+const invalidateChannel = "cache:invalidate"
+
+// invalidateMessage 失效广播内容
+type invalidateMessage struct {
+	Cache       string `json:"cache"`       // 缓存名，对应 Options.Name
+	Key         string `json:"key"`         // 完整缓存 key
+	Origin      string `json:"origin"`      // 发出广播的实例，自身收到时忽略
+	PublishedAt int64  `json:"publishedAt"` // 发出时间（毫秒），用于统计扇出耗时
+}
+
+// Invalidator 通过 Redis pub/sub 广播本地缓存失效：某个实例修改数据后，其他实例删除各自的本地副本
+// pub/sub 不保证送达（如订阅断线期间），此时本地副本最迟在本地缓存 TTL 后过期
+type Invalidator struct {
+	rdb      *redis.Client
+	instance string
+	metrics  *observability.CacheMetrics
+	log      *zap.Logger
+
+	mu     sync.RWMutex
+	locals map[string]*bigcache.BigCache
+}
+
+// NewInvalidator 创建失效广播器；rdb 为 nil 时返回 nil，只删除本机缓存
+func NewInvalidator(rdb *redis.Client, metrics *observability.CacheMetrics, log *zap.Logger) *Invalidator {
+	if rdb == nil {
+		return nil
+	}
+	if log == nil {
+		log = zap.NewNop()
+	}
+	host, _ := os.Hostname()
+	return &Invalidator{
+		rdb:      rdb,
+		instance: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8]),
+		metrics:  metrics,
+		log:      log,
+		locals:   make(map[string]*bigcache.BigCache),
+	}
+}
+
+// register 登记缓存名对应的本地缓存，收到广播时按缓存名删除
+func (i *Invalidator) register(name string, local *bigcache.BigCache) {
+	if i == nil || local == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.locals[name] = local
+}
+
+// Publish 广播本地缓存失效
+func (i *Invalidator) Publish(ctx context.Context, cache, key string) error {
+	if i == nil {
+		return nil
+	}
+	data, err := json.Marshal(invalidateMessage{
+		Cache:       cache,
+		Key:         key,
+		Origin:      i.instance,
+		PublishedAt: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := i.rdb.Publish(ctx, invalidateChannel, data).Err(); err != nil {
+		i.metrics.ObserveInvalidation(cache, "error")
+		return err
+	}
+	i.metrics.ObserveInvalidation(cache, "published")
+	return nil
+}
+
+// Run 订阅失效广播并删除本机缓存，直到 ctx 取消；go-redis 断线后会自动重连并重新订阅
+func (i *Invalidator) Run(ctx context.Context) {
+	pubsub := i.rdb.Subscribe(ctx, invalidateChannel)
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			i.handle(msg.Payload)
+		}
+	}
+}
+
+// handle 处理一条失效广播
+func (i *Invalidator) handle(payload string) {
+	var msg invalidateMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil || msg.Key == "" {
+		i.log.Warn("invalid cache invalidate message", zap.String("payload", payload), zap.Error(err))
+		return
+	}
+	if msg.Origin == i.instance {
+		return
+	}
+	i.mu.RLock()
+	local := i.locals[msg.Cache]
+	i.mu.RUnlock()
+	if local == nil {
+		return
+	}
+	_ = local.Delete(msg.Key)
+	i.metrics.ObserveInvalidation(msg.Cache, "received")
+	i.metrics.ObserveFanout(msg.Cache, time.Since(time.UnixMilli(msg.PublishedAt)))
+}
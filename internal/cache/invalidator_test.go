@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLocal(t *testing.T) *bigcache.BigCache {
+	t.Helper()
+	local, err := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute))
+	if err != nil {
+		t.Fatalf("init local cache: %v", err)
+	}
+	return local
+}
+
+func TestInvalidatorHandleSkipsSelf(t *testing.T) {
+	inv := NewInvalidator(redis.NewClient(&redis.Options{}), nil, nil)
+	local := newTestLocal(t)
+	inv.register("shop", local)
+	_ = local.Set("cache:shop:1", []byte("{}"))
+
+	self, _ := json.Marshal(invalidateMessage{Cache: "shop", Key: "cache:shop:1", Origin: inv.instance})
+	inv.handle(string(self))
+	if _, err := local.Get("cache:shop:1"); err != nil {
+		t.Fatalf("expected own broadcast ignored")
+	}
+	other, _ := json.Marshal(invalidateMessage{Cache: "shop", Key: "cache:shop:1", Origin: "other", PublishedAt: time.Now().UnixMilli()})
+	inv.handle(string(other))
+	if _, err := local.Get("cache:shop:1"); err == nil {
+		t.Fatalf("expected local entry evicted")
+	}
+	if NewInvalidator(nil, nil, nil) != nil {
+		t.Fatalf("expected nil invalidator without redis")
+	}
+}
+
+// TestInvalidateLocalAcrossInstances 一个实例删除本地缓存后，另一个实例的本地副本被删除（依赖本地 Redis）
+func TestInvalidateLocalAcrossInstances(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rdb := newTestRedis(t)
+
+	key := "test:invalidate:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	newInstance := func() (*Client[item], *bigcache.BigCache) {
+		local := newTestLocal(t)
+		inv := NewInvalidator(rdb, nil, nil)
+		go inv.Run(ctx)
+		return New(rdb, local, Options[item]{Name: "item", KeyPrefix: "test:", Invalidator: inv}, nil), local
+	}
+	writer, _ := newInstance()
+	_, readerLocal := newInstance()
+	_ = readerLocal.Set(key, []byte("{}"))
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		// 订阅建立前发布的广播会丢失，重复发布直到对方删除
+		writer.InvalidateLocal(ctx, key)
+		time.Sleep(50 * time.Millisecond)
+		if _, err := readerLocal.Get(key); err != nil {
+			return
+		}
+	}
+	t.Fatalf("local entry on other instance not evicted")
+}
@@ -13,6 +13,7 @@ type Config struct {
 	MySQL   MySQLConfig   `mapstructure:"mysql"`
 	Redis   RedisConfig   `mapstructure:"redis"`
 	Kafka   KafkaConfig   `mapstructure:"kafka"`
+	Queue   QueueConfig   `mapstructure:"queue"`
 	SMTP    SMTPConfig    `mapstructure:"smtp"`
 	App     AppConfig     `mapstructure:"app"`
 	Logging LoggingConfig `mapstructure:"logging"`
@@ -22,6 +23,9 @@ type Config struct {
 // ServerConfig defines HTTP server options
 type ServerConfig struct {
 	Port int `mapstructure:"port"`
+	// TrustedProxies 可信反向代理的 IP/CIDR，只有来自这些地址的请求才读取 X-Forwarded-For/X-Real-IP 作为客户端 IP；
+	// 为空表示不经代理直连，客户端 IP 一律取 TCP 对端地址，防止伪造请求头绕过按 IP 限流
+	TrustedProxies []string `mapstructure:"trustedProxies"`
 }
 
 // MySQLConfig configures the relational database connection
@@ -50,6 +54,26 @@ type KafkaConfig struct {
 	GroupID string   `mapstructure:"groupId"`
 }
 
+// QueueConfig selects the message queue backend used by the order and cache invalidation pipelines.
+// Topic names are shared with KafkaConfig.
+type QueueConfig struct {
+	Driver       string            `mapstructure:"driver"`       // kafka（默认）| redis（Redis Streams）| memory（单机开发，进程内 channel，消息不持久化）
+	MemoryBuffer int               `mapstructure:"memoryBuffer"` // memory 驱动每个 topic 的缓冲大小
+	Redis        RedisStreamConfig `mapstructure:"redis"`
+}
+
+// RedisStreamConfig configures the Redis Streams queue driver.
+// Consumer group names are derived from KafkaConfig.GroupID.
+type RedisStreamConfig struct {
+	StreamPrefix  string        `mapstructure:"streamPrefix"`  // stream key 前缀，key 为 前缀 + topic
+	Consumer      string        `mapstructure:"consumer"`      // 组内消费者名称，默认 hostname-pid
+	TrimInterval  time.Duration `mapstructure:"trimInterval"`  // 按各消费者组进度裁剪 stream 的间隔，默认 1m，< 0 关闭
+	BatchSize     int64         `mapstructure:"batchSize"`     // 单次 XREADGROUP/XCLAIM 条数
+	Block         time.Duration `mapstructure:"block"`         // XREADGROUP 阻塞等待时间，同时决定停机时拉取的最长等待
+	ClaimInterval time.Duration `mapstructure:"claimInterval"` // 扫描 XPENDING 的间隔
+	ClaimMinIdle  time.Duration `mapstructure:"claimMinIdle"`  // 超过该时间未确认的消息视为卡住，被 XCLAIM 转移
+}
+
 // SMTPConfig configures email notifications.
 type SMTPConfig struct {
 	Host string `mapstructure:"host"`
@@ -63,6 +87,32 @@ type SMTPConfig struct {
 type AppConfig struct {
 	ImageUploadDir string `mapstructure:"imageUploadDir"`
 	ShopCache      ShopCacheConfig `mapstructure:"shopCache"`
+	Seckill        SeckillConfig   `mapstructure:"seckill"`
+	Admin          AdminConfig     `mapstructure:"admin"`
+	RateLimit      RateLimitConfig `mapstructure:"rateLimit"`
+	Idempotency    IdempotencyConfig `mapstructure:"idempotency"`
+}
+
+// IdempotencyConfig configures how long Idempotency-Key responses are kept.
+type IdempotencyConfig struct {
+	TTL     time.Duration `mapstructure:"ttl"`     // 响应保存时间，默认 24h
+	LockTTL time.Duration `mapstructure:"lockTTL"` // 首个请求处理中标记的过期时间，默认 30s，需大于接口最长处理时间
+}
+
+// RateLimitConfig configures Redis token bucket rate limiting for HTTP routes.
+type RateLimitConfig struct {
+	Enabled bool            `mapstructure:"enabled"`
+	Rules   []RateLimitRule `mapstructure:"rules"`
+}
+
+// RateLimitRule limits one route by one key; a route may have several rules (e.g. per user and per IP).
+type RateLimitRule struct {
+	Name   string  `mapstructure:"name"`   // 规则名，用于 Redis key 与指标
+	Method string  `mapstructure:"method"` // HTTP 方法，为空匹配全部
+	Path   string  `mapstructure:"path"`   // Gin 路由模板，如 /voucher-order/seckill/:id
+	Key    string  `mapstructure:"key"`    // 限流维度：user | ip | voucher（路径参数 id）
+	Rate   float64 `mapstructure:"rate"`   // 每秒补充的令牌数
+	Burst  int     `mapstructure:"burst"`  // 桶容量，允许的突发请求数
 }
 
 // ShopCacheConfig configures local cache and cache delete behavior for shops.
@@ -70,6 +120,29 @@ type ShopCacheConfig struct {
 	LocalTTL           time.Duration `mapstructure:"localTTL"`
 	DeleteRetryCount   int           `mapstructure:"deleteRetryCount"`
 	DeleteRetryDelay   time.Duration `mapstructure:"deleteRetryDelay"`
+	BloomRebuildInterval time.Duration `mapstructure:"bloomRebuildInterval"` // 布隆过滤器定期重建间隔，默认 6h，< 0 关闭定期重建
+	Bloom              BloomConfig   `mapstructure:"bloom"` // 商铺布隆过滤器容量与误判率
+}
+
+// BloomConfig sizes a bloom filter from the expected item count and target false positive rate.
+type BloomConfig struct {
+	ExpectedItems     int64   `mapstructure:"expectedItems"`     // 预期元素数，默认 100000
+	FalsePositiveRate float64 `mapstructure:"falsePositiveRate"` // 目标误判率，默认 0.01
+}
+
+// SeckillConfig configures seckill order behavior.
+type SeckillConfig struct {
+	PayTimeout          time.Duration `mapstructure:"payTimeout"`          // 默认支付超时时间，秒杀券未单独配置时使用
+	ReconcileInterval   time.Duration `mapstructure:"reconcileInterval"`   // 库存对账周期，< 0 关闭定时对账
+	ReconcileAutoRepair bool          `mapstructure:"reconcileAutoRepair"` // 定时对账发现差异时是否以 DB 为准修复 Redis
+	ConsumeBatchSize    int           `mapstructure:"consumeBatchSize"`    // 订单消费单批最大消息数，1 表示逐条落库
+	ConsumeBatchWait    time.Duration `mapstructure:"consumeBatchWait"`    // 凑批最长等待时间
+	ConsumeConcurrency  int           `mapstructure:"consumeConcurrency"`  // 每个消费者的并行 lane 数，同一秒杀券的消息固定在同一 lane 内顺序处理
+}
+
+// AdminConfig configures who may call the /admin management APIs.
+type AdminConfig struct {
+	UserIDs []int64 `mapstructure:"userIds"` // 管理员用户 ID 白名单
 }
 
 // LoggingConfig controls structured logging output.
@@ -27,7 +27,7 @@ type sqlDB interface {
 	PingContext(ctx context.Context) error
 }
 
-// NewHealthHandler 创建一个新的 HealthHandler 实例
+// NewHealthHandler 创建一个新的 HealthHandler 实例，kafkaBrokers 为 nil 表示未使用 Kafka
 func NewHealthHandler(db sqlDB, redisClient *redis.Client, kafkaBrokers []string, log *zap.Logger) *HealthHandler {
 	return &HealthHandler{
 		db:           db,
@@ -55,8 +55,11 @@ func (h *HealthHandler) Readyz(c *gin.Context) {
 	if err := data.Ping(ctx, h.redis); err != nil {
 		checks["redis"] = err.Error()
 	}
-	if err := checkKafka(ctx, h.kafkaBrokers); err != nil {
-		checks["kafka"] = err.Error()
+	// 未使用 Kafka 作为消息队列时不检查
+	if h.kafkaBrokers != nil {
+		if err := checkKafka(ctx, h.kafkaBrokers); err != nil {
+			checks["kafka"] = err.Error()
+		}
 	}
 
 	if len(checks) > 0 {
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"hmdp-backend/internal/dto/result"
+	"hmdp-backend/internal/middleware"
+	"hmdp-backend/internal/service"
+	"hmdp-backend/internal/utils"
+)
+
+// ListDLQ 分页查询死信订单（管理员），支持按 voucherId/userId/status/error 筛选
+func (h *VoucherOrderHandler) ListDLQ(ctx *gin.Context) {
+	var filter service.DLQFilter
+	var err error
+	if raw := ctx.Query("voucherId"); raw != "" {
+		if filter.VoucherID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			ctx.JSON(http.StatusBadRequest, result.Fail("invalid voucher id"))
+			return
+		}
+	}
+	if raw := ctx.Query("userId"); raw != "" {
+		if filter.UserID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			ctx.JSON(http.StatusBadRequest, result.Fail("invalid user id"))
+			return
+		}
+	}
+	if raw := ctx.Query("status"); raw != "" {
+		status, err := strconv.Atoi(raw)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, result.Fail("invalid status"))
+			return
+		}
+		filter.Status = &status
+	}
+	filter.Error = ctx.Query("error")
+	page := utils.ParsePage(ctx.Query("current"), 1)
+	entries, total, err := h.voucherOrderSvc.ListDLQ(ctx.Request.Context(), filter, page, utils.MAX_PAGE_SIZE)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.OkWithPage(entries, total))
+}
+
+// GetDLQ 查看单条死信订单（管理员）
+func (h *VoucherOrderHandler) GetDLQ(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid dlq id"))
+		return
+	}
+	entry, err := h.voucherOrderSvc.GetDLQ(ctx.Request.Context(), id)
+	if err != nil {
+		writeDLQError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.OkWithData(entry))
+}
+
+// ReplayDLQ 重放死信订单（管理员）：重新预占 Redis 库存并投递到主 Topic
+func (h *VoucherOrderHandler) ReplayDLQ(ctx *gin.Context) {
+	user, ok := middleware.GetLoginUser(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, result.Fail("未登录"))
+		return
+	}
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid dlq id"))
+		return
+	}
+	if err := h.voucherOrderSvc.ReplayDLQ(ctx.Request.Context(), id, user.ID); err != nil {
+		writeDLQError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Ok())
+}
+
+// DiscardDLQ 丢弃死信订单（管理员），必须填写原因
+func (h *VoucherOrderHandler) DiscardDLQ(ctx *gin.Context) {
+	user, ok := middleware.GetLoginUser(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, result.Fail("未登录"))
+		return
+	}
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid dlq id"))
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Reason == "" {
+		ctx.JSON(http.StatusBadRequest, result.Fail("reason is required"))
+		return
+	}
+	if err := h.voucherOrderSvc.DiscardDLQ(ctx.Request.Context(), id, user.ID, req.Reason); err != nil {
+		writeDLQError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Ok())
+}
+
+// writeDLQError 将死信管理的业务错误映射为 HTTP 状态码
+func writeDLQError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrDLQEntryNotFound):
+		ctx.JSON(http.StatusNotFound, result.Fail(err.Error()))
+	case errors.Is(err, service.ErrDLQEntryHandled), errors.Is(err, service.ErrDLQReplayNoStock):
+		ctx.JSON(http.StatusConflict, result.Fail(err.Error()))
+	default:
+		ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+	}
+}
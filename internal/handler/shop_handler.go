@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"hmdp-backend/internal/dto/result"
 	"net/http"
 	"strconv"
@@ -117,3 +118,27 @@ func (h *ShopHandler) QueryShopByName(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, result.OkWithData(shops))
 }
+
+// RebuildShopBloom 重建商铺布隆过滤器（管理员），剔除已删除的商铺 ID
+func (h *ShopHandler) RebuildShopBloom(ctx *gin.Context) {
+	stats, err := h.service.RebuildShopBloom(ctx.Request.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrBloomRebuildRunning) {
+			ctx.JSON(http.StatusConflict, result.Fail(err.Error()))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.OkWithData(stats))
+}
+
+// QueryShopBloomStats 查询商铺布隆过滤器的置位比例与估算误判率（管理员）
+func (h *ShopHandler) QueryShopBloomStats(ctx *gin.Context) {
+	stats, err := h.service.ShopBloomStats(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.OkWithData(stats))
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"hmdp-backend/internal/dto/result"
 	"net/http"
 	"strconv"
@@ -40,7 +41,7 @@ func (h *VoucherHandler) AddSeckillVoucher(ctx *gin.Context) {
 		return
 	}
 	if err := h.service.AddSeckillVoucher(ctx.Request.Context(), &voucher); err != nil {
-		ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+		writeVoucherError(ctx, err)
 		return
 	}
 	ctx.JSON(http.StatusOK, result.OkWithData(voucher.ID))
@@ -60,3 +61,93 @@ func (h *VoucherHandler) QueryVoucherOfShop(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, result.OkWithData(vouchers))
 }
+
+// UpdateSeckillVoucher 修改秒杀券时间、限购与支付超时（管理员）
+func (h *VoucherHandler) UpdateSeckillVoucher(ctx *gin.Context) {
+	voucherID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid voucher id"))
+		return
+	}
+	var req service.SeckillVoucherUpdate
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid payload"))
+		return
+	}
+	if err := h.service.UpdateSeckillVoucher(ctx.Request.Context(), voucherID, req); err != nil {
+		writeVoucherError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Ok())
+}
+
+// AdjustSeckillStock 按增量调整秒杀库存，同步 DB 与 Redis（管理员）
+func (h *VoucherHandler) AdjustSeckillStock(ctx *gin.Context) {
+	voucherID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid voucher id"))
+		return
+	}
+	var req struct {
+		Delta int `json:"delta"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid payload"))
+		return
+	}
+	stock, err := h.service.AdjustSeckillStock(ctx.Request.Context(), voucherID, req.Delta)
+	if err != nil {
+		writeVoucherError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.OkWithData(stock))
+}
+
+// UpdateVoucherStatus 上架/下架优惠券（管理员）
+func (h *VoucherHandler) UpdateVoucherStatus(ctx *gin.Context) {
+	voucherID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid voucher id"))
+		return
+	}
+	var req struct {
+		Status int `json:"status"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid payload"))
+		return
+	}
+	if err := h.service.UpdateVoucherStatus(ctx.Request.Context(), voucherID, req.Status); err != nil {
+		writeVoucherError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Ok())
+}
+
+// DeleteVoucher 删除优惠券并清理 Redis 秒杀数据（管理员）
+func (h *VoucherHandler) DeleteVoucher(ctx *gin.Context) {
+	voucherID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid voucher id"))
+		return
+	}
+	if err := h.service.DeleteVoucher(ctx.Request.Context(), voucherID); err != nil {
+		writeVoucherError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Ok())
+}
+
+// writeVoucherError 将优惠券管理的业务错误映射为 HTTP 状态码
+func writeVoucherError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrVoucherNotFound):
+		ctx.JSON(http.StatusNotFound, result.Fail(err.Error()))
+	case errors.Is(err, service.ErrInvalidVoucher):
+		ctx.JSON(http.StatusBadRequest, result.Fail(err.Error()))
+	case errors.Is(err, service.ErrSeckillStockNotEnough), errors.Is(err, service.ErrVoucherHasActiveOrders):
+		ctx.JSON(http.StatusConflict, result.Fail(err.Error()))
+	default:
+		ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+	}
+}
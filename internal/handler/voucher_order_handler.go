@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"hmdp-backend/internal/dto/result"
 	"hmdp-backend/internal/middleware"
 	"hmdp-backend/internal/service"
+	"hmdp-backend/internal/utils"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -34,12 +39,304 @@ func (h *VoucherOrderHandler) SeckillVoucher(ctx *gin.Context) {
 		return
 	}
 
-	// 调用业务层执行秒杀下单：校验时间/库存、扣减库存、生成订单
-	orderID, svcErr := h.voucherOrderSvc.Seckill(ctx.Request.Context(), voucherID, user.ID)
+	// 购买数量，缺省为 1
+	quantity := 1
+	if raw := ctx.Query("quantity"); raw != "" {
+		quantity, err = strconv.Atoi(raw)
+		if err != nil || quantity <= 0 {
+			ctx.JSON(http.StatusBadRequest, result.Fail("invalid quantity"))
+			return
+		}
+	}
+
+	// 调用业务层执行秒杀下单：校验时间/库存/限购、扣减库存、生成订单
+	orderID, svcErr := h.voucherOrderSvc.Seckill(ctx.Request.Context(), voucherID, user.ID, quantity)
 	if svcErr != nil {
+		if errors.Is(svcErr, service.ErrNotAdmitted) {
+			// 开启等候室的券需先排队，放行后再下单
+			ctx.JSON(http.StatusForbidden, result.Fail(svcErr.Error()))
+			return
+		}
 		ctx.JSON(http.StatusBadRequest, result.Fail(svcErr.Error()))
 		return
 	}
 
 	ctx.JSON(http.StatusOK, result.OkWithData(orderID))
 }
+
+// JoinWaitingRoom 领取秒杀排队号（券开启等候室时使用）
+func (h *VoucherOrderHandler) JoinWaitingRoom(ctx *gin.Context) {
+	h.waitingTicket(ctx, h.voucherOrderSvc.JoinWaitingRoom)
+}
+
+// QueryWaitingTicket 轮询排队位置与预计等待时间
+func (h *VoucherOrderHandler) QueryWaitingTicket(ctx *gin.Context) {
+	h.waitingTicket(ctx, h.voucherOrderSvc.GetWaitingTicket)
+}
+
+// waitingTicket 解析券 ID 与登录用户后执行等候室操作
+func (h *VoucherOrderHandler) waitingTicket(ctx *gin.Context, action func(context.Context, int64, int64) (*service.WaitingTicket, error)) {
+	voucherID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid voucher id"))
+		return
+	}
+	user, ok := middleware.GetLoginUser(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, result.Fail("未登录"))
+		return
+	}
+	ticket, err := action(ctx.Request.Context(), voucherID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWaitingTicketNotFound):
+			ctx.JSON(http.StatusNotFound, result.Fail(err.Error()))
+		case errors.Is(err, service.ErrWaitingRoomDisabled):
+			ctx.JSON(http.StatusConflict, result.Fail(err.Error()))
+		default:
+			ctx.JSON(http.StatusBadRequest, result.Fail(err.Error()))
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, result.OkWithData(ticket))
+}
+
+// payOrderRequest 支付请求体，payType 缺省为 1（余额支付）
+type payOrderRequest struct {
+	PayType int `json:"payType"`
+}
+
+// PayOrder 支付订单
+func (h *VoucherOrderHandler) PayOrder(ctx *gin.Context) {
+	var req payOrderRequest
+	// 请求体可选，解析失败按默认支付方式处理
+	_ = ctx.ShouldBindJSON(&req)
+	h.transitOrder(ctx, func(c context.Context, orderID, userID int64) error {
+		return h.voucherOrderSvc.PayOrder(c, orderID, userID, req.PayType)
+	})
+}
+
+// UseOrder 核销订单
+func (h *VoucherOrderHandler) UseOrder(ctx *gin.Context) {
+	h.transitOrder(ctx, h.voucherOrderSvc.UseOrder)
+}
+
+// RefundOrder 订单退款
+func (h *VoucherOrderHandler) RefundOrder(ctx *gin.Context) {
+	h.transitOrder(ctx, h.voucherOrderSvc.RefundOrder)
+}
+
+// transitOrder 解析订单 ID 与登录用户后执行状态流转，并将业务错误映射为 HTTP 状态码
+func (h *VoucherOrderHandler) transitOrder(ctx *gin.Context, action func(context.Context, int64, int64) error) {
+	orderID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid order id"))
+		return
+	}
+	user, ok := middleware.GetLoginUser(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, result.Fail("未登录"))
+		return
+	}
+	if err := action(ctx.Request.Context(), orderID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrVoucherOrderNotFound):
+			ctx.JSON(http.StatusNotFound, result.Fail(err.Error()))
+		case errors.Is(err, service.ErrIllegalOrderTransition):
+			ctx.JSON(http.StatusConflict, result.Fail(err.Error()))
+		default:
+			ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, result.Ok())
+}
+
+// QueryOrder 查询当前用户的单个订单（含异步落库状态）
+func (h *VoucherOrderHandler) QueryOrder(ctx *gin.Context) {
+	orderID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid order id"))
+		return
+	}
+	user, ok := middleware.GetLoginUser(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, result.Fail("未登录"))
+		return
+	}
+	view, err := h.voucherOrderSvc.GetOrder(ctx.Request.Context(), orderID, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrVoucherOrderNotFound) {
+			ctx.JSON(http.StatusNotFound, result.Fail(err.Error()))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.OkWithData(view))
+}
+
+const (
+	orderEventsRefreshInterval = 15 * time.Second // SSE 心跳间隔，同时回查状态兜底 pub/sub 丢失
+	orderEventsStreamMaxAge    = 5 * time.Minute  // SSE 连接最长保持时间，超时后由客户端重连
+	orderEventsPollDefault     = 25 * time.Second
+	orderEventsPollMax         = 60 * time.Second
+)
+
+// OrderEvents 推送订单异步处理结果（确认落库或失败并归还库存）
+// 请求头 Accept 为 text/event-stream 时使用 SSE，持续推送直到终态；
+// 否则为长轮询：state 为客户端已知状态，状态变化、进入终态或等待 timeout 秒后返回当前状态
+func (h *VoucherOrderHandler) OrderEvents(ctx *gin.Context) {
+	orderID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, result.Fail("invalid order id"))
+		return
+	}
+	user, ok := middleware.GetLoginUser(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, result.Fail("未登录"))
+		return
+	}
+	view, events, stop, err := h.voucherOrderSvc.WatchOrder(ctx.Request.Context(), orderID, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrVoucherOrderNotFound) {
+			ctx.JSON(http.StatusNotFound, result.Fail(err.Error()))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+		return
+	}
+	defer stop()
+
+	if strings.Contains(ctx.GetHeader("Accept"), "text/event-stream") {
+		h.streamOrderEvents(ctx, orderID, user.ID, view, events)
+		return
+	}
+	h.pollOrderEvents(ctx, view, events)
+}
+
+// streamOrderEvents 以 SSE 推送订单状态，每次状态变化发送一条 state 事件
+func (h *VoucherOrderHandler) streamOrderEvents(ctx *gin.Context, orderID, userID int64, view *service.VoucherOrderView, events <-chan *service.VoucherOrderView) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	send := func(v *service.VoucherOrderView) bool {
+		ctx.SSEvent("state", v)
+		ctx.Writer.Flush()
+		view = v
+		return !service.IsFinalOrderState(v.State)
+	}
+	if !send(view) {
+		return
+	}
+
+	ticker := time.NewTicker(orderEventsRefreshInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(orderEventsStreamMaxAge)
+	defer deadline.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case v := <-events:
+			if !send(v) {
+				return
+			}
+		case <-ticker.C:
+			latest, err := h.voucherOrderSvc.GetOrder(ctx.Request.Context(), orderID, userID)
+			if err == nil && (latest.State != view.State || latest.RetryCount != view.RetryCount) {
+				if !send(latest) {
+					return
+				}
+				continue
+			}
+			// 心跳注释，防止代理断开空闲连接
+			_, _ = ctx.Writer.WriteString(": ping\n\n")
+			ctx.Writer.Flush()
+		}
+	}
+}
+
+// pollOrderEvents 长轮询：等待状态与客户端已知状态不同后返回
+func (h *VoucherOrderHandler) pollOrderEvents(ctx *gin.Context, view *service.VoucherOrderView, events <-chan *service.VoucherOrderView) {
+	known := ctx.Query("state")
+	if known == "" || view.State != known || service.IsFinalOrderState(view.State) {
+		ctx.JSON(http.StatusOK, result.OkWithData(view))
+		return
+	}
+	wait := orderEventsPollDefault
+	if raw := ctx.Query("timeout"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds < 0 {
+			ctx.JSON(http.StatusBadRequest, result.Fail("invalid timeout"))
+			return
+		}
+		wait = min(time.Duration(seconds)*time.Second, orderEventsPollMax)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-timer.C:
+			ctx.JSON(http.StatusOK, result.OkWithData(view))
+			return
+		case v := <-events:
+			view = v
+			if v.State != known {
+				ctx.JSON(http.StatusOK, result.OkWithData(view))
+				return
+			}
+		}
+	}
+}
+
+// QueryMyOrders 分页查询当前用户的订单
+func (h *VoucherOrderHandler) QueryMyOrders(ctx *gin.Context) {
+	user, ok := middleware.GetLoginUser(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, result.Fail("未登录"))
+		return
+	}
+	page := utils.ParsePage(ctx.Query("current"), 1)
+	views, err := h.voucherOrderSvc.ListMyOrders(ctx.Request.Context(), user.ID, page, utils.MAX_PAGE_SIZE)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, result.OkWithData(views))
+}
+
+// ReconcileStock 按需执行库存对账（管理员），voucherId 缺省时对账近期所有秒杀券，repair=true 时以 DB 为准修复 Redis
+func (h *VoucherOrderHandler) ReconcileStock(ctx *gin.Context) {
+	var voucherID int64
+	if raw := ctx.Query("voucherId"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			ctx.JSON(http.StatusBadRequest, result.Fail("invalid voucher id"))
+			return
+		}
+		voucherID = id
+	}
+	repair := ctx.Query("repair") == "true"
+	reports, err := h.voucherOrderSvc.ReconcileStock(ctx.Request.Context(), voucherID, repair)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrVoucherNotFound):
+			ctx.JSON(http.StatusNotFound, result.Fail(err.Error()))
+		case errors.Is(err, service.ErrReconcileVoucherSelling):
+			ctx.JSON(http.StatusConflict, result.Fail(err.Error()))
+		default:
+			ctx.JSON(http.StatusInternalServerError, result.Fail(err.Error()))
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, result.OkWithData(reports))
+}
@@ -0,0 +1,111 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Manager 统一管理后台 worker 与需要关闭的资源
+// 关闭顺序：取消 worker 的 context -> 等待 worker 处理完在途消息并提交 offset -> 逆序关闭资源（reader/writer 等）
+type Manager struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	closers []closer
+	stopped bool
+	log     *zap.Logger
+}
+
+type closer struct {
+	name string
+	fn   func() error
+}
+
+// NewManager 创建生命周期管理器
+func NewManager(log *zap.Logger) *Manager {
+	if log == nil {
+		log = zap.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel, log: log}
+}
+
+// Go 启动一个受管 worker，fn 需在 ctx 取消后尽快返回；Stop 之后调用不再启动
+func (m *Manager) Go(name string, fn func(ctx context.Context)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		m.log.Warn("lifecycle stopped, worker not started", zap.String("worker", name))
+		return
+	}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				m.log.Error("worker panic", zap.String("worker", name), zap.Any("panic", r))
+			}
+		}()
+		fn(m.ctx)
+		m.log.Info("worker stopped", zap.String("worker", name))
+	}()
+}
+
+// OnStop 注册关闭函数，在全部 worker 退出后按注册的逆序执行
+func (m *Manager) OnStop(name string, fn func() error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, closer{name: name, fn: fn})
+}
+
+// Stop 通知所有 worker 退出并等待，ctx 超时后不再等待，直接关闭资源
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return nil
+	}
+	m.stopped = true
+	closers := m.closers
+	m.mu.Unlock()
+
+	m.cancel()
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	var errs []error
+	select {
+	case <-done:
+		m.log.Info("all workers stopped")
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("wait workers: %w", ctx.Err()))
+		m.log.Warn("workers did not stop in time", zap.Error(ctx.Err()))
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].fn(); err != nil {
+			errs = append(errs, fmt.Errorf("close %s: %w", closers[i].name, err))
+			m.log.Warn("close resource failed", zap.String("name", closers[i].name), zap.Error(err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Sleep 等待 d 或 ctx 取消，ctx 取消时返回 false
+func Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
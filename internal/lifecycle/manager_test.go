@@ -0,0 +1,65 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManagerStopWaitsWorkersBeforeClose(t *testing.T) {
+	m := NewManager(nil)
+	var order []string
+	done := make(chan struct{})
+	m.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		// 模拟排空在途消息
+		time.Sleep(50 * time.Millisecond)
+		order = append(order, "worker")
+		close(done)
+	})
+	m.OnStop("writer", func() error {
+		order = append(order, "writer")
+		return nil
+	})
+	m.OnStop("reader", func() error {
+		<-done
+		order = append(order, "reader")
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	want := []string{"worker", "reader", "writer"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestManagerStopTimeout(t *testing.T) {
+	m := NewManager(nil)
+	block := make(chan struct{})
+	defer close(block)
+	m.Go("stuck", func(context.Context) { <-block })
+	closed := false
+	m.OnStop("reader", func() error {
+		closed = true
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Stop(ctx); err == nil {
+		t.Fatalf("expected timeout error")
+	}
+	if !closed {
+		t.Fatalf("resources should be closed after timeout")
+	}
+}
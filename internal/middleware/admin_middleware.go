@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"hmdp-backend/internal/dto/result"
+)
+
+// AdminMiddleware 校验当前登录用户是否在管理员白名单中，需挂在 LoginMiddleware 之后
+func AdminMiddleware(adminUserIDs []int64) gin.HandlerFunc {
+	admins := make(map[int64]struct{}, len(adminUserIDs))
+	for _, id := range adminUserIDs {
+		admins[id] = struct{}{}
+	}
+	return func(ctx *gin.Context) {
+		user, ok := GetLoginUser(ctx)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, result.Fail("未登录"))
+			return
+		}
+		if _, ok := admins[user.ID]; !ok {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, result.Fail("无管理权限"))
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/dto/result"
+	"hmdp-backend/internal/utils"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	idempotencyKeyMaxLen      = 128
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyLockTTL = 30 * time.Second
+)
+
+// idempotencyRecord 保存在 Redis 中的请求结果；Status 为 0 表示首个请求仍在处理中
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Idempotency 基于 Idempotency-Key 请求头的幂等中间件：同一用户对同一路由使用相同的 key 重复请求时，
+// 直接返回首次请求的响应（成功结果或业务错误），不再执行处理函数
+type Idempotency struct {
+	rdb     *redis.Client
+	ttl     time.Duration
+	lockTTL time.Duration
+	log     *zap.Logger
+}
+
+// NewIdempotency 创建幂等中间件；rdb 为 nil 时返回 nil，对应路由不做幂等处理
+func NewIdempotency(rdb *redis.Client, cfg config.IdempotencyConfig, log *zap.Logger) *Idempotency {
+	if rdb == nil {
+		return nil
+	}
+	if log == nil {
+		log = zap.NewNop()
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	lockTTL := cfg.LockTTL
+	if lockTTL <= 0 {
+		lockTTL = defaultIdempotencyLockTTL
+	}
+	return &Idempotency{rdb: rdb, ttl: ttl, lockTTL: lockTTL, log: log}
+}
+
+// Middleware 返回幂等中间件，挂在需要幂等的路由上；接收者为 nil 或请求未携带 Idempotency-Key 时直接放行
+// 5xx 与 429 视为未处理，删除记录允许客户端用同一个 key 重试；Redis 不可用时放行
+func (i *Idempotency) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if i == nil {
+			ctx.Next()
+			return
+		}
+		i.handle(ctx)
+	}
+}
+
+// RoutesMiddleware 返回只对指定路由（方法 + 路由模板，如 "POST /blog"）生效的幂等中间件，用于全局注册在限流之前：
+// 重放请求直接返回首次结果，不消耗令牌、不会因限流收到 429；首次请求被限流时 429 不保存，可用同一个 key 重试
+func (i *Idempotency) RoutesMiddleware(routes ...string) gin.HandlerFunc {
+	set := make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		set[rateLimitRoute(method, path)] = struct{}{}
+	}
+	return func(ctx *gin.Context) {
+		if i == nil {
+			ctx.Next()
+			return
+		}
+		if _, ok := set[rateLimitRoute(ctx.Request.Method, ctx.FullPath())]; !ok {
+			ctx.Next()
+			return
+		}
+		i.handle(ctx)
+	}
+}
+
+// handle 执行幂等检查：重复请求返回首次响应，首次请求执行后续处理并保存结果
+func (i *Idempotency) handle(ctx *gin.Context) {
+	key := ctx.GetHeader(IdempotencyKeyHeader)
+	if key == "" {
+		ctx.Next()
+		return
+	}
+	if len(key) > idempotencyKeyMaxLen {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, result.Fail("Idempotency-Key 过长"))
+		return
+	}
+	fingerprint, err := requestFingerprint(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, result.Fail("读取请求失败"))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	redisKey := idempotencyRedisKey(ctx, key)
+	pending, _ := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+	for attempt := 0; ; attempt++ {
+		acquired, err := i.rdb.SetNX(reqCtx, redisKey, pending, i.lockTTL).Result()
+		if err != nil {
+			i.log.Warn("idempotency check failed, processing request", zap.String("key", redisKey), zap.Error(err))
+			ctx.Next()
+			return
+		}
+		if acquired {
+			break
+		}
+		// 记录在 SETNX 与读取之间被首个请求释放时重新抢占一次
+		if i.replay(ctx, redisKey, fingerprint) || attempt > 0 {
+			if !ctx.IsAborted() {
+				ctx.AbortWithStatusJSON(http.StatusConflict, result.Fail("请求正在处理中，请稍后重试"))
+			}
+			return
+		}
+	}
+
+	writer := &idempotencyWriter{ResponseWriter: ctx.Writer}
+	ctx.Writer = writer
+	ctx.Next()
+
+	status := writer.Status()
+	// 请求已处理完毕，客户端可能已断开，保存结果不再受请求 context 影响
+	saveCtx := context.WithoutCancel(reqCtx)
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+		if err := i.rdb.Del(saveCtx, redisKey).Err(); err != nil {
+			i.log.Warn("idempotency release failed", zap.String("key", redisKey), zap.Error(err))
+		}
+		return
+	}
+	record, _ := json.Marshal(idempotencyRecord{
+		Fingerprint: fingerprint,
+		Status:      status,
+		ContentType: writer.Header().Get("Content-Type"),
+		Body:        writer.body.Bytes(),
+	})
+	if err := i.rdb.Set(saveCtx, redisKey, record, i.ttl).Err(); err != nil {
+		i.log.Warn("idempotency save failed", zap.String("key", redisKey), zap.Error(err))
+	}
+}
+
+// replay 返回已保存的响应；首个请求仍在处理中返回 409，同一个 key 用于不同请求返回 422
+// 记录已不存在时返回 false，不写响应
+func (i *Idempotency) replay(ctx *gin.Context, redisKey, fingerprint string) bool {
+	data, err := i.rdb.Get(ctx.Request.Context(), redisKey).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false
+		}
+		i.log.Warn("idempotency load failed", zap.String("key", redisKey), zap.Error(err))
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, result.Fail("幂等校验失败"))
+		return true
+	}
+	var record idempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		i.log.Warn("invalid idempotency record", zap.String("key", redisKey), zap.Error(err))
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, result.Fail("幂等校验失败"))
+		return true
+	}
+	if record.Fingerprint != fingerprint {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, result.Fail("Idempotency-Key 已用于其他请求"))
+		return true
+	}
+	if record.Status == 0 {
+		ctx.AbortWithStatusJSON(http.StatusConflict, result.Fail("请求正在处理中，请稍后重试"))
+		return true
+	}
+	ctx.Header(IdempotentReplayedHeader, "true")
+	ctx.Data(record.Status, record.ContentType, record.Body)
+	ctx.Abort()
+	return true
+}
+
+// idempotencyRedisKey key 按 路由 + 用户 隔离，未登录时按 IP
+func idempotencyRedisKey(ctx *gin.Context, key string) string {
+	scope := "ip:" + ctx.ClientIP()
+	if user, ok := GetLoginUser(ctx); ok {
+		scope = strconv.FormatInt(user.ID, 10)
+	}
+	return utils.IDEMPOTENCY_KEY + ctx.Request.Method + ":" + ctx.FullPath() + ":" + scope + ":" + key
+}
+
+// requestFingerprint 计算 方法 + URI + 请求体 的摘要，用于识别同一个 key 被用于不同请求
+func requestFingerprint(ctx *gin.Context) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(ctx.Request.Method + " " + ctx.Request.URL.RequestURI() + "\n"))
+	if ctx.Request.Body != nil {
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// idempotencyWriter 记录写出的响应体
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
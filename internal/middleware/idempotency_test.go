@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/dto/result"
+	"hmdp-backend/internal/utils"
+)
+
+func TestNilIdempotencyPassesThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var idem *Idempotency
+	if NewIdempotency(nil, config.IdempotencyConfig{}, zap.NewNop()) != nil {
+		t.Fatalf("expected nil middleware without redis")
+	}
+	engine := gin.New()
+	calls := 0
+	engine.Use(idem.RoutesMiddleware("POST /a"))
+	engine.POST("/a", idem.Middleware(), func(ctx *gin.Context) {
+		calls++
+		ctx.Status(http.StatusOK)
+	})
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/a", nil)
+		req.Header.Set(IdempotencyKeyHeader, "k")
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if calls != 2 {
+		t.Fatalf("expected handler called twice, got %d", calls)
+	}
+}
+
+// TestIdempotencyReplaysResponse 相同 key 重复请求返回首次响应，请求体不同返回 422，5xx 不保存（依赖本地 Redis）
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	gin.SetMode(gin.TestMode)
+	idem := NewIdempotency(rdb, config.IdempotencyConfig{TTL: time.Minute}, zap.NewNop())
+	engine := gin.New()
+	calls, fail := 0, true
+	engine.POST("/order/:id", idem.Middleware(), func(ctx *gin.Context) {
+		calls++
+		ctx.JSON(http.StatusOK, result.OkWithData(calls))
+	})
+	engine.POST("/flaky", idem.Middleware(), func(ctx *gin.Context) {
+		calls++
+		if fail {
+			ctx.JSON(http.StatusInternalServerError, result.Fail("boom"))
+			return
+		}
+		ctx.JSON(http.StatusOK, result.Ok())
+	})
+
+	key := "test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	do := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	first := do("/order/1", "a")
+	second := do("/order/1", "a")
+	if calls != 1 || second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Fatalf("expected replay of first response, calls=%d body=%q", calls, second.Body.String())
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("expected replayed header")
+	}
+	if w := do("/order/1", "b"); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for different body, got %d", w.Code)
+	}
+
+	calls = 0
+	if w := do("/flaky", ""); w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	fail = false
+	if w := do("/flaky", ""); w.Code != http.StatusOK || calls != 2 {
+		t.Fatalf("expected retry after 5xx to run handler, code=%d calls=%d", w.Code, calls)
+	}
+}
+
+// TestIdempotencyReplayBypassesRateLimit 幂等中间件注册在限流之前时，重试请求返回首次结果而不是 429（依赖本地 Redis）
+func TestIdempotencyReplayBypassesRateLimit(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	name := "test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	limiter := NewRateLimiter(rdb, config.RateLimitConfig{
+		Enabled: true,
+		Rules: []config.RateLimitRule{
+			{Name: name, Method: http.MethodPost, Path: "/seckill/:id", Key: RateLimitKeyVoucher, Rate: 0.01, Burst: 1},
+		},
+	}, nil, zap.NewNop())
+	defer rdb.Del(context.Background(), utils.RATE_LIMIT_KEY+name+":1")
+
+	gin.SetMode(gin.TestMode)
+	idem := NewIdempotency(rdb, config.IdempotencyConfig{TTL: time.Minute}, zap.NewNop())
+	engine := gin.New()
+	engine.Use(idem.RoutesMiddleware("POST /seckill/:id"))
+	engine.Use(limiter.Middleware())
+	calls := 0
+	engine.POST("/seckill/:id", func(ctx *gin.Context) {
+		calls++
+		ctx.JSON(http.StatusOK, result.OkWithData(calls))
+	})
+
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/seckill/1", nil)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	first := do(name)
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", first.Code)
+	}
+	retry := do(name)
+	if retry.Code != http.StatusOK || retry.Header().Get(IdempotentReplayedHeader) != "true" || calls != 1 {
+		t.Fatalf("expected replay instead of rate limit, code=%d calls=%d", retry.Code, calls)
+	}
+	// 新请求仍受限流
+	if w := do(""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for new request, got %d", w.Code)
+	}
+}
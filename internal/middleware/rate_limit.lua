@@ -0,0 +1,36 @@
+-- 令牌桶限流
+-- KEYS[1] 令牌桶 hash：tokens 剩余令牌，ts 上次补充时间（毫秒）
+-- ARGV[1] 每秒补充的令牌数 ARGV[2] 桶容量
+-- 返回 {是否放行(1/0), 需要等待的毫秒数}
+local key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+-- 使用 Redis 时钟，避免多实例之间的时钟偏差
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local bucket = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+    tokens = burst
+    ts = now
+end
+
+local elapsed = math.max(0, now - ts)
+tokens = math.min(burst, tokens + elapsed * rate / 1000)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+else
+    wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+-- 桶补满后即可过期，等价于重新创建
+redis.call('PEXPIRE', key, math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, wait}
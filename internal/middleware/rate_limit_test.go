@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/utils"
+)
+
+func TestNewRateLimiterSkipsInvalidRules(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Enabled: true,
+		Rules: []config.RateLimitRule{
+			{Name: "bad-key", Path: "/a", Key: "session", Rate: 1, Burst: 1},
+			{Name: "bad-rate", Path: "/a", Key: RateLimitKeyIP, Rate: 0, Burst: 1},
+		},
+	}
+	if l := NewRateLimiter(nil, cfg, nil, zap.NewNop()); l != nil {
+		t.Fatalf("expected nil limiter without valid rules")
+	}
+	cfg.Rules = append(cfg.Rules, config.RateLimitRule{Name: "ok", Method: "post", Path: "/a", Key: RateLimitKeyIP, Rate: 1, Burst: 1})
+	l := NewRateLimiter(nil, cfg, nil, zap.NewNop())
+	if l == nil || len(l.rules[rateLimitRoute(http.MethodPost, "/a")]) != 1 {
+		t.Fatalf("expected one rule for POST /a")
+	}
+	cfg.Enabled = false
+	if l := NewRateLimiter(nil, cfg, nil, zap.NewNop()); l != nil {
+		t.Fatalf("expected nil limiter when disabled")
+	}
+}
+
+// TestRateLimiterRejectsOverBurst 超过桶容量后返回 429 与 Retry-After，不同券互不影响（依赖本地 Redis）
+func TestRateLimiterRejectsOverBurst(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	name := "test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	limiter := NewRateLimiter(rdb, config.RateLimitConfig{
+		Enabled: true,
+		Rules: []config.RateLimitRule{
+			{Name: name, Method: http.MethodPost, Path: "/seckill/:id", Key: RateLimitKeyVoucher, Rate: 0.5, Burst: 2},
+		},
+	}, nil, zap.NewNop())
+	defer rdb.Del(context.Background(), utils.RATE_LIMIT_KEY+name+":1", utils.RATE_LIMIT_KEY+name+":2")
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(limiter.Middleware())
+	engine.POST("/seckill/:id", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	do := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/seckill/"+id, nil))
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := do("1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	w := do("1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); retry < 1 || retry > 2 {
+		t.Fatalf("unexpected Retry-After %q", w.Header().Get("Retry-After"))
+	}
+	if w := do("2"); w.Code != http.StatusOK {
+		t.Fatalf("expected other voucher to pass, got %d", w.Code)
+	}
+}
+
+// TestRateLimitKeyIgnoresSpoofedForwardedFor 未配置可信代理时伪造 X-Forwarded-For 不改变按 IP 限流的 key
+func TestRateLimitKeyIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keyOf := func(trustedProxies []string, remoteAddr, xff string) string {
+		engine := gin.New()
+		if err := engine.SetTrustedProxies(trustedProxies); err != nil {
+			t.Fatalf("set trusted proxies: %v", err)
+		}
+		var value string
+		engine.GET("/shop/:id", func(ctx *gin.Context) {
+			_, value = rateLimitKey(ctx, RateLimitKeyIP)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/shop/1", nil)
+		req.RemoteAddr = remoteAddr
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+		return value
+	}
+
+	if got := keyOf(nil, "203.0.113.7:5000", "1.2.3.4"); got != "203.0.113.7" {
+		t.Fatalf("expected remote addr without trusted proxies, got %q", got)
+	}
+	if keyOf(nil, "203.0.113.7:5000", "1.2.3.4") != keyOf(nil, "203.0.113.7:5000", "5.6.7.8") {
+		t.Fatalf("spoofed X-Forwarded-For changed the rate limit key")
+	}
+	// 来自可信代理的请求使用其转发的客户端 IP
+	if got := keyOf([]string{"10.0.0.0/8"}, "10.0.0.2:5000", "198.51.100.9"); got != "198.51.100.9" {
+		t.Fatalf("expected forwarded client ip behind trusted proxy, got %q", got)
+	}
+	// 非可信代理来源仍忽略请求头
+	if got := keyOf([]string{"10.0.0.0/8"}, "203.0.113.7:5000", "198.51.100.9"); got != "203.0.113.7" {
+		t.Fatalf("expected remote addr from untrusted source, got %q", got)
+	}
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// 死信处理状态：0 待处理 1 已重放 2 已丢弃
+const (
+	SeckillDLQStatusPending   = 0
+	SeckillDLQStatusReplayed  = 1
+	SeckillDLQStatusDiscarded = 2
+)
+
+// SeckillDLQEntry mirrors tb_seckill_dlq.
+type SeckillDLQEntry struct {
+	ID          int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	OrderID     int64      `gorm:"column:order_id" json:"orderId"`
+	UserID      int64      `gorm:"column:user_id" json:"userId"`
+	VoucherID   int64      `gorm:"column:voucher_id" json:"voucherId"`
+	Quantity    int        `gorm:"column:quantity" json:"quantity"`
+	RetryCount  int        `gorm:"column:retry_count" json:"retryCount"`
+	ReplayCount int        `gorm:"column:replay_count" json:"replayCount"` // 已重放次数
+	LastError   string     `gorm:"column:last_error" json:"lastError"`
+	Payload     string     `gorm:"column:payload" json:"payload"` // 原始消息 JSON
+	Status      int        `gorm:"column:status" json:"status"`
+	OperatorID  int64      `gorm:"column:operator_id" json:"operatorId"` // 重放/丢弃的管理员
+	Reason      string     `gorm:"column:reason" json:"reason"`          // 丢弃原因
+	HandledTime *time.Time `gorm:"column:handled_time" json:"handledTime"`
+	CreateTime  time.Time  `gorm:"column:create_time;autoCreateTime" json:"createTime"`
+	UpdateTime  time.Time  `gorm:"column:update_time;autoUpdateTime" json:"updateTime"`
+}
+
+func (SeckillDLQEntry) TableName() string { return "tb_seckill_dlq" }
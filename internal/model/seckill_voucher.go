@@ -4,12 +4,15 @@ import "time"
 
 // SeckillVoucher mirrors tb_seckill_voucher.
 type SeckillVoucher struct {
-	VoucherID  int64     `gorm:"column:voucher_id;primaryKey" json:"voucherId"`
-	Stock      int       `gorm:"column:stock" json:"stock"`
-	CreateTime time.Time `gorm:"column:create_time;autoCreateTime" json:"createTime"`
-	BeginTime  time.Time `gorm:"column:begin_time" json:"beginTime"`
-	EndTime    time.Time `gorm:"column:end_time" json:"endTime"`
-	UpdateTime time.Time `gorm:"column:update_time;autoUpdateTime" json:"updateTime"`
+	VoucherID     int64     `gorm:"column:voucher_id;primaryKey" json:"voucherId"`
+	Stock         int       `gorm:"column:stock" json:"stock"`
+	PayTimeout    int       `gorm:"column:pay_timeout" json:"payTimeout"`       // 支付超时时间（秒），0 表示使用全局默认值
+	LimitPerUser  int       `gorm:"column:limit_per_user" json:"limitPerUser"`  // 每人限购数量，<= 0 表示不限购
+	AdmissionRate int       `gorm:"column:admission_rate" json:"admissionRate"` // 等候室每秒放行人数，0 表示不启用
+	CreateTime    time.Time `gorm:"column:create_time;autoCreateTime" json:"createTime"`
+	BeginTime     time.Time `gorm:"column:begin_time" json:"beginTime"`
+	EndTime       time.Time `gorm:"column:end_time" json:"endTime"`
+	UpdateTime    time.Time `gorm:"column:update_time;autoUpdateTime" json:"updateTime"`
 }
 
 func (SeckillVoucher) TableName() string { return "tb_seckill_voucher" }
@@ -2,22 +2,32 @@ package model
 
 import "time"
 
+// 优惠券状态
+const (
+	VoucherStatusOnline  = 1 // 上架
+	VoucherStatusOffline = 2 // 下架
+	VoucherStatusExpired = 3 // 过期
+)
+
 // Voucher mirrors tb_voucher.
 type Voucher struct {
-	ID          int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	ShopID      int64      `gorm:"column:shop_id" json:"shopId"`
-	Title       string     `gorm:"column:title" json:"title"`
-	SubTitle    string     `gorm:"column:sub_title" json:"subTitle"`
-	Rules       string     `gorm:"column:rules" json:"rules"`
-	PayValue    int64      `gorm:"column:pay_value" json:"payValue"`
-	ActualValue int64      `gorm:"column:actual_value" json:"actualValue"`
-	Type        int        `gorm:"column:type" json:"type"`
-	Status      int        `gorm:"column:status" json:"status"`
-	CreateTime  time.Time  `gorm:"column:create_time;autoCreateTime" json:"createTime"`
-	UpdateTime  time.Time  `gorm:"column:update_time;autoUpdateTime" json:"updateTime"`
-	Stock       *int       `gorm:"-" json:"stock,omitempty"`
-	BeginTime   *time.Time `gorm:"-" json:"beginTime,omitempty"`
-	EndTime     *time.Time `gorm:"-" json:"endTime,omitempty"`
+	ID            int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	ShopID        int64      `gorm:"column:shop_id" json:"shopId"`
+	Title         string     `gorm:"column:title" json:"title"`
+	SubTitle      string     `gorm:"column:sub_title" json:"subTitle"`
+	Rules         string     `gorm:"column:rules" json:"rules"`
+	PayValue      int64      `gorm:"column:pay_value" json:"payValue"`
+	ActualValue   int64      `gorm:"column:actual_value" json:"actualValue"`
+	Type          int        `gorm:"column:type" json:"type"`
+	Status        int        `gorm:"column:status" json:"status"`
+	CreateTime    time.Time  `gorm:"column:create_time;autoCreateTime" json:"createTime"`
+	UpdateTime    time.Time  `gorm:"column:update_time;autoUpdateTime" json:"updateTime"`
+	Stock         *int       `gorm:"-" json:"stock,omitempty"`
+	BeginTime     *time.Time `gorm:"-" json:"beginTime,omitempty"`
+	EndTime       *time.Time `gorm:"-" json:"endTime,omitempty"`
+	PayTimeout    *int       `gorm:"-" json:"payTimeout,omitempty"`
+	LimitPerUser  *int       `gorm:"-" json:"limitPerUser,omitempty"`
+	AdmissionRate *int       `gorm:"-" json:"admissionRate,omitempty"`
 }
 
 func (Voucher) TableName() string { return "tb_voucher" }
@@ -2,11 +2,22 @@ package model
 
 import "time"
 
+// 订单状态：1 未支付 2 已支付 3 已核销 4 已取消 5 退款中 6 已退款
+const (
+	VoucherOrderStatusUnpaid    = 1
+	VoucherOrderStatusPaid      = 2
+	VoucherOrderStatusUsed      = 3
+	VoucherOrderStatusCancelled = 4
+	VoucherOrderStatusRefunding = 5
+	VoucherOrderStatusRefunded  = 6
+)
+
 // VoucherOrder mirrors tb_voucher_order.
 type VoucherOrder struct {
 	ID         int64      `gorm:"column:id;primaryKey" json:"id"`
 	UserID     int64      `gorm:"column:user_id" json:"userId"`
 	VoucherID  int64      `gorm:"column:voucher_id" json:"voucherId"`
+	Quantity   int        `gorm:"column:quantity" json:"quantity"`
 	PayType    int        `gorm:"column:pay_type" json:"payType"`
 	Status     int        `gorm:"column:status" json:"status"`
 	CreateTime time.Time  `gorm:"column:create_time" json:"createTime"`
@@ -17,3 +28,11 @@ type VoucherOrder struct {
 }
 
 func (VoucherOrder) TableName() string { return "tb_voucher_order" }
+
+// OrderQuantity 返回购买数量，兼容新增 quantity 列之前的订单
+func (o *VoucherOrder) OrderQuantity() int {
+	if o.Quantity <= 0 {
+		return 1
+	}
+	return o.Quantity
+}
@@ -0,0 +1,128 @@
+package observability
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CacheMetrics 定义多级缓存相关的指标
+type CacheMetrics struct {
+	invalidations *prometheus.CounterVec   // 本地缓存失效广播（published/received/error），按缓存名区分
+	fanoutLatency *prometheus.HistogramVec // 失效广播从发出到其他实例删除本地缓存的耗时
+	bloomFill     *prometheus.GaugeVec     // 布隆过滤器置位比例
+	bloomFPR      *prometheus.GaugeVec     // 按置位比例估算的误判率
+	bloomItems    *prometheus.GaugeVec     // 最近一次重建写入的元素数
+	bloomRebuilds *prometheus.CounterVec   // 布隆过滤器重建结果
+}
+
+// NewCacheMetrics 创建缓存指标，并注册到给定的 Registry
+func NewCacheMetrics(registry *prometheus.Registry, serviceName string) *CacheMetrics {
+	if registry == nil {
+		registry = NewMetricsRegistry()
+	}
+
+	constLabels := prometheus.Labels{}
+	if serviceName != "" {
+		constLabels["service"] = serviceName
+	}
+
+	invalidations := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "cache",
+		Subsystem:   "local",
+		Name:        "invalidations_total",
+		Help:        "Total local cache invalidation broadcasts by cache and result.",
+		ConstLabels: constLabels,
+	}, []string{"cache", "result"})
+
+	fanoutLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   "cache",
+		Subsystem:   "local",
+		Name:        "invalidation_fanout_seconds",
+		Help:        "Time from publishing a local cache invalidation to evicting it on another instance.",
+		Buckets:     []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		ConstLabels: constLabels,
+	}, []string{"cache"})
+
+	bloomFill := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   "cache",
+		Subsystem:   "bloom",
+		Name:        "fill_ratio",
+		Help:        "Fraction of bits set in the bloom filter.",
+		ConstLabels: constLabels,
+	}, []string{"filter"})
+
+	bloomFPR := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   "cache",
+		Subsystem:   "bloom",
+		Name:        "estimated_false_positive_rate",
+		Help:        "Estimated bloom filter false positive rate (fill_ratio ^ hash_count).",
+		ConstLabels: constLabels,
+	}, []string{"filter"})
+
+	bloomItems := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   "cache",
+		Subsystem:   "bloom",
+		Name:        "items",
+		Help:        "Number of items written by the last bloom filter rebuild.",
+		ConstLabels: constLabels,
+	}, []string{"filter"})
+
+	bloomRebuilds := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "cache",
+		Subsystem:   "bloom",
+		Name:        "rebuilds_total",
+		Help:        "Total bloom filter rebuilds by result.",
+		ConstLabels: constLabels,
+	}, []string{"filter", "result"})
+
+	registry.MustRegister(invalidations, fanoutLatency, bloomFill, bloomFPR, bloomItems, bloomRebuilds)
+
+	return &CacheMetrics{
+		invalidations: invalidations,
+		fanoutLatency: fanoutLatency,
+		bloomFill:     bloomFill,
+		bloomFPR:      bloomFPR,
+		bloomItems:    bloomItems,
+		bloomRebuilds: bloomRebuilds,
+	}
+}
+
+// ObserveInvalidation 记录一次失效广播，result 为 published/received/error
+func (m *CacheMetrics) ObserveInvalidation(cache, result string) {
+	if m == nil {
+		return
+	}
+	m.invalidations.WithLabelValues(cache, result).Inc()
+}
+
+// ObserveFanout 记录失效广播的扇出耗时；依赖各实例时钟同步，负值按 0 记录
+func (m *CacheMetrics) ObserveFanout(cache string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	if d < 0 {
+		d = 0
+	}
+	m.fanoutLatency.WithLabelValues(cache).Observe(d.Seconds())
+}
+
+// ObserveBloom 记录布隆过滤器的置位比例与估算误判率
+func (m *CacheMetrics) ObserveBloom(filter string, fillRatio, estimatedFPR float64) {
+	if m == nil {
+		return
+	}
+	m.bloomFill.WithLabelValues(filter).Set(fillRatio)
+	m.bloomFPR.WithLabelValues(filter).Set(estimatedFPR)
+}
+
+// ObserveBloomRebuild 记录一次布隆过滤器重建，result 为 success/error，成功时记录写入的元素数
+func (m *CacheMetrics) ObserveBloomRebuild(filter, result string, items int64) {
+	if m == nil {
+		return
+	}
+	m.bloomRebuilds.WithLabelValues(filter, result).Inc()
+	if result == "success" {
+		m.bloomItems.WithLabelValues(filter).Set(float64(items))
+	}
+}
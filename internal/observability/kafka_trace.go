@@ -78,3 +78,19 @@ func InjectKafkaBaggage(ctx context.Context, headers *[]kafka.Header, propagator
 	}
 	propagator.Inject(ctx, kafkaHeaderCarrier{headers: headers})
 }
+
+// InjectMessageHeaders 将当前跟踪上下文写入与具体消息队列无关的 headers 中
+func InjectMessageHeaders(ctx context.Context, headers map[string]string) {
+	if headers == nil {
+		return
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+}
+
+// ExtractMessageContext 从与具体消息队列无关的 headers 中读取 trace 上下文
+func ExtractMessageContext(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(headers))
+}
@@ -0,0 +1,57 @@
+package observability
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// QueueMetrics 定义消息队列驱动相关的指标
+type QueueMetrics struct {
+	streamTrimmed *prometheus.CounterVec // Redis Streams 按消费进度裁剪的消息数
+	streamLost    *prometheus.CounterVec // 尚未确认就被删除、无法再投递的消息数
+}
+
+// NewQueueMetrics 创建消息队列指标，并注册到给定的 Registry
+func NewQueueMetrics(registry *prometheus.Registry, serviceName string) *QueueMetrics {
+	if registry == nil {
+		registry = NewMetricsRegistry()
+	}
+
+	constLabels := prometheus.Labels{}
+	if serviceName != "" {
+		constLabels["service"] = serviceName
+	}
+
+	streamTrimmed := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "queue",
+		Subsystem:   "redis_stream",
+		Name:        "trimmed_messages_total",
+		Help:        "Total stream entries trimmed after every consumer group has acknowledged them.",
+		ConstLabels: constLabels,
+	}, []string{"topic"})
+
+	streamLost := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "queue",
+		Subsystem:   "redis_stream",
+		Name:        "lost_messages_total",
+		Help:        "Total pending stream entries whose content was deleted before being processed.",
+		ConstLabels: constLabels,
+	}, []string{"topic"})
+
+	registry.MustRegister(streamTrimmed, streamLost)
+
+	return &QueueMetrics{streamTrimmed: streamTrimmed, streamLost: streamLost}
+}
+
+// ObserveStreamTrimmed 记录一次按消费进度裁剪删除的消息数
+func (m *QueueMetrics) ObserveStreamTrimmed(topic string, n int64) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.streamTrimmed.WithLabelValues(topic).Add(float64(n))
+}
+
+// ObserveStreamLost 记录未处理就已被删除的消息数
+func (m *QueueMetrics) ObserveStreamLost(topic string, n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.streamLost.WithLabelValues(topic).Add(float64(n))
+}
@@ -0,0 +1,40 @@
+package observability
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// RateLimitMetrics 定义接口限流相关的指标
+type RateLimitMetrics struct {
+	decisions *prometheus.CounterVec // 限流判定结果（allowed/rejected/error），按规则与维度区分
+}
+
+// NewRateLimitMetrics 创建限流指标，并注册到给定的 Registry
+func NewRateLimitMetrics(registry *prometheus.Registry, serviceName string) *RateLimitMetrics {
+	if registry == nil {
+		registry = NewMetricsRegistry()
+	}
+
+	constLabels := prometheus.Labels{}
+	if serviceName != "" {
+		constLabels["service"] = serviceName
+	}
+
+	decisions := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "http",
+		Subsystem:   "rate_limit",
+		Name:        "decisions_total",
+		Help:        "Total rate limit decisions by rule, key type and result.",
+		ConstLabels: constLabels,
+	}, []string{"rule", "key", "result"})
+
+	registry.MustRegister(decisions)
+
+	return &RateLimitMetrics{decisions: decisions}
+}
+
+// ObserveDecision 记录一次限流判定，result 为 allowed/rejected/error
+func (m *RateLimitMetrics) ObserveDecision(rule, key, result string) {
+	if m == nil {
+		return
+	}
+	m.decisions.WithLabelValues(rule, key, result).Inc()
+}
@@ -1,6 +1,7 @@
 package observability
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -14,6 +15,13 @@ type SeckillMetrics struct {
 	kafkaConsumeTotal   *prometheus.CounterVec
 	kafkaConsumeLatency *prometheus.HistogramVec // Kafka消费处理耗时分布
 	retryTotal          *prometheus.CounterVec
+	reconcileDrift      *prometheus.GaugeVec   // 库存对账差异，按券与差异类型区分
+	reconcileTotal      *prometheus.CounterVec // 库存对账结果
+	outboxTotal         *prometheus.CounterVec // outbox 写入/重新投递/丢弃次数
+	outboxDepth         prometheus.Gauge       // outbox 积压消息数
+	outboxAge           prometheus.Gauge       // outbox 最老消息等待时间
+	orderBatchTotal     *prometheus.CounterVec   // 订单批量落库结果（batched/fallback）
+	orderBatchSize      *prometheus.HistogramVec // 订单批量落库的批大小
 }
 
 func NewSeckillMetrics(registry *prometheus.Registry, serviceName string) *SeckillMetrics {
@@ -76,7 +84,64 @@ func NewSeckillMetrics(registry *prometheus.Registry, serviceName string) *Secki
 		ConstLabels: constLabels,
 	}, []string{"phase"})
 
-	registry.MustRegister(seckillTotal, seckillLatency, kafkaPublishTotal, kafkaConsumeTotal, kafkaConsumeLatency, retryTotal)
+	reconcileDrift := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   "seckill",
+		Subsystem:   "reconcile",
+		Name:        "drift",
+		Help:        "Stock reconciliation drift between Redis and MySQL per voucher.",
+		ConstLabels: constLabels,
+	}, []string{"voucher_id", "kind"})
+
+	reconcileTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "seckill",
+		Subsystem:   "reconcile",
+		Name:        "runs_total",
+		Help:        "Total stock reconciliation results per voucher.",
+		ConstLabels: constLabels,
+	}, []string{"result"})
+
+	outboxTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "seckill",
+		Subsystem:   "outbox",
+		Name:        "events_total",
+		Help:        "Total order outbox events.",
+		ConstLabels: constLabels,
+	}, []string{"event"})
+
+	outboxDepth := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "seckill",
+		Subsystem:   "outbox",
+		Name:        "depth",
+		Help:        "Number of order messages waiting in the outbox.",
+		ConstLabels: constLabels,
+	})
+
+	outboxAge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "seckill",
+		Subsystem:   "outbox",
+		Name:        "oldest_age_seconds",
+		Help:        "Age of the oldest order message waiting in the outbox.",
+		ConstLabels: constLabels,
+	})
+
+	orderBatchTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "seckill",
+		Subsystem:   "order",
+		Name:        "batch_total",
+		Help:        "Total order persistence batches by result.",
+		ConstLabels: constLabels,
+	}, []string{"result"})
+
+	orderBatchSize := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   "seckill",
+		Subsystem:   "order",
+		Name:        "batch_size",
+		Help:        "Number of orders per persistence batch.",
+		Buckets:     prometheus.ExponentialBuckets(1, 2, 10),
+		ConstLabels: constLabels,
+	}, []string{"result"})
+
+	registry.MustRegister(seckillTotal, seckillLatency, kafkaPublishTotal, kafkaConsumeTotal, kafkaConsumeLatency, retryTotal, reconcileDrift, reconcileTotal, outboxTotal, outboxDepth, outboxAge, orderBatchTotal, orderBatchSize)
 
 	return &SeckillMetrics{
 		seckillTotal:        seckillTotal,
@@ -85,6 +150,13 @@ func NewSeckillMetrics(registry *prometheus.Registry, serviceName string) *Secki
 		kafkaConsumeTotal:   kafkaConsumeTotal,
 		kafkaConsumeLatency: kafkaConsumeLatency,
 		retryTotal:          retryTotal,
+		reconcileDrift:      reconcileDrift,
+		reconcileTotal:      reconcileTotal,
+		outboxTotal:         outboxTotal,
+		outboxDepth:         outboxDepth,
+		outboxAge:           outboxAge,
+		orderBatchTotal:     orderBatchTotal,
+		orderBatchSize:      orderBatchSize,
 	}
 }
 // ObserveSeckill 记录一次秒杀请求的结果与耗时
@@ -120,3 +192,37 @@ func (m *SeckillMetrics) ObserveRetry(phase string) {
 	}
 	m.retryTotal.WithLabelValues(phase).Inc()
 }
+// ObserveReconcile 记录一张券的库存对账结果与各类差异值
+func (m *SeckillMetrics) ObserveReconcile(voucherID int64, result string, drifts map[string]int64) {
+	if m == nil {
+		return
+	}
+	id := strconv.FormatInt(voucherID, 10)
+	for kind, value := range drifts {
+		m.reconcileDrift.WithLabelValues(id, kind).Set(float64(value))
+	}
+	m.reconcileTotal.WithLabelValues(result).Inc()
+}
+// ObserveOutbox 记录一次 outbox 事件（enqueued/relayed/dropped）
+func (m *SeckillMetrics) ObserveOutbox(event string) {
+	if m == nil {
+		return
+	}
+	m.outboxTotal.WithLabelValues(event).Inc()
+}
+// SetOutboxBacklog 更新 outbox 积压深度与最老消息等待时间
+func (m *SeckillMetrics) SetOutboxBacklog(depth int64, age time.Duration) {
+	if m == nil {
+		return
+	}
+	m.outboxDepth.Set(float64(depth))
+	m.outboxAge.Set(age.Seconds())
+}
+// ObserveOrderBatch 记录一次订单批量落库的结果（batched/fallback）与批大小
+func (m *SeckillMetrics) ObserveOrderBatch(result string, size int) {
+	if m == nil {
+		return
+	}
+	m.orderBatchTotal.WithLabelValues(result).Inc()
+	m.orderBatchSize.WithLabelValues(result).Observe(float64(size))
+}
@@ -10,9 +10,20 @@ import (
 )
 
 // RegisterRoutes 统一注册所有模块的路由
-func RegisterRoutes(engine *gin.Engine, services *service.Registry, uploadDir string, rdb *redis.Client) {
+// adminUserIDs 为可访问 /admin 管理接口的用户 ID 白名单，limiter 为 nil 时不限流，idempotency 为 nil 时不做幂等处理
+func RegisterRoutes(engine *gin.Engine, services *service.Registry, uploadDir string, rdb *redis.Client, adminUserIDs []int64, limiter *middleware.RateLimiter, idempotency *middleware.Idempotency) {
 	engine.Use(middleware.CORSMiddleware())
 	engine.Use(middleware.LoginMiddleware(rdb))
+	// 客户端超时重试时凭 Idempotency-Key 返回首次结果；注册在限流之前，重放请求不消耗令牌也不会收到 429
+	engine.Use(idempotency.RoutesMiddleware(
+		"PUT /shop",
+		"POST /blog",
+		"POST /voucher-order/seckill/:id",
+	))
+	if limiter != nil {
+		// 在登录之后按路由限流，可按用户维度计数
+		engine.Use(limiter.Middleware())
+	}
 
 	shopHandler := handler.NewShopHandler(services.Shop)
 	shopTypeHandler := handler.NewShopTypeHandler(services.ShopType)
@@ -34,7 +45,6 @@ func RegisterRoutes(engine *gin.Engine, services *service.Registry, uploadDir st
 
 	voucherGroup := engine.Group("/voucher")
 	voucherGroup.POST("", voucherHandler.AddVoucher)
-	voucherGroup.POST("/seckill", voucherHandler.AddSeckillVoucher)
 	voucherGroup.GET("/list/:shopId", voucherHandler.QueryVoucherOfShop)
 
 	blogGroup := engine.Group("/blog")
@@ -68,5 +78,28 @@ func RegisterRoutes(engine *gin.Engine, services *service.Registry, uploadDir st
 
 	voucherOrderGroup := engine.Group("/voucher-order")
 	voucherOrderGroup.POST("/seckill/:id", voucherOrderHandler.SeckillVoucher)
+	voucherOrderGroup.POST("/seckill/:id/ticket", voucherOrderHandler.JoinWaitingRoom)
+	voucherOrderGroup.GET("/seckill/:id/ticket", voucherOrderHandler.QueryWaitingTicket)
+	voucherOrderGroup.GET("/of/me", voucherOrderHandler.QueryMyOrders)
+	voucherOrderGroup.GET("/:id", voucherOrderHandler.QueryOrder)
+	voucherOrderGroup.GET("/:id/events", voucherOrderHandler.OrderEvents)
+	voucherOrderGroup.POST("/:id/pay", voucherOrderHandler.PayOrder)
+	voucherOrderGroup.POST("/:id/use", voucherOrderHandler.UseOrder)
+	voucherOrderGroup.POST("/:id/refund", voucherOrderHandler.RefundOrder)
+
+	// 管理接口：需登录且在管理员白名单内
+	adminGroup := engine.Group("/admin", middleware.AdminMiddleware(adminUserIDs))
+	adminGroup.POST("/voucher/seckill", voucherHandler.AddSeckillVoucher)
+	adminGroup.PUT("/voucher/seckill/:id", voucherHandler.UpdateSeckillVoucher)
+	adminGroup.PUT("/voucher/seckill/:id/stock", voucherHandler.AdjustSeckillStock)
+	adminGroup.PUT("/voucher/:id/status", voucherHandler.UpdateVoucherStatus)
+	adminGroup.DELETE("/voucher/:id", voucherHandler.DeleteVoucher)
+	adminGroup.POST("/seckill/reconcile", voucherOrderHandler.ReconcileStock)
+	adminGroup.GET("/seckill/dlq", voucherOrderHandler.ListDLQ)
+	adminGroup.GET("/seckill/dlq/:id", voucherOrderHandler.GetDLQ)
+	adminGroup.POST("/seckill/dlq/:id/replay", voucherOrderHandler.ReplayDLQ)
+	adminGroup.POST("/seckill/dlq/:id/discard", voucherOrderHandler.DiscardDLQ)
+	adminGroup.GET("/shop/bloom", shopHandler.QueryShopBloomStats)
+	adminGroup.POST("/shop/bloom/rebuild", shopHandler.RebuildShopBloom)
 
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 
 	"go.uber.org/zap"
@@ -28,9 +29,13 @@ func TestPreheatShopBloom(t *testing.T) {
 	rdb := data.NewRedis(cfg.Redis)
 	defer rdb.Close()
 
-	svc := NewShopService(nil, rdb, nil, nil, nil, nil, utils.SMTPConfig{}, config.ShopCacheConfig{}, zap.NewNop())
+	svc := NewShopService(nil, rdb, nil, nil, nil, nil, utils.SMTPConfig{}, config.ShopCacheConfig{}, nil, nil, zap.NewNop())
+	// Add 不会创建 key，先分配位数组
+	if err := svc.bloom.Reserve(ctx, 0); err != nil {
+		t.Fatalf("bloom reserve: %v", err)
+	}
 	for id := int64(1); id <= 14; id++ {
-		if err := svc.bloomAdd(ctx, utils.SHOP_BLOOM_KEY, id); err != nil {
+		if err := svc.bloom.Add(ctx, strconv.FormatInt(id, 10)); err != nil {
 			t.Fatalf("bloom add id=%d: %v", id, err)
 		}
 	}
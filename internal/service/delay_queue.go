@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	_ "embed"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+//go:embed delay_queue_claim.lua
+var delayQueueClaimLuaSource string
+
+var delayQueueClaimLua = redis.NewScript(delayQueueClaimLuaSource)
+
+// redisDelayQueue 基于 Redis ZSet 的延迟队列：score 为到期时间（毫秒），member 为任务内容
+type redisDelayQueue struct {
+	rdb *redis.Client
+	key string
+}
+
+func newRedisDelayQueue(rdb *redis.Client, key string) *redisDelayQueue {
+	return &redisDelayQueue{rdb: rdb, key: key}
+}
+
+// Push 写入延迟任务；member 已存在时保留原到期时间，保证重复投递幂等
+func (q *redisDelayQueue) Push(ctx context.Context, member string, at time.Time) error {
+	return q.rdb.ZAddNX(ctx, q.key, redis.Z{Score: float64(at.UnixMilli()), Member: member}).Err()
+}
+
+// PushOverwrite 写入延迟任务并覆盖原到期时间，用于处理失败后的重新排期
+func (q *redisDelayQueue) PushOverwrite(ctx context.Context, member string, at time.Time) error {
+	return q.rdb.ZAdd(ctx, q.key, redis.Z{Score: float64(at.UnixMilli()), Member: member}).Err()
+}
+
+// ClaimDue 原子地领取最多 limit 个已到期任务：任务不删除，到期时间推后 lease，
+// 处理成功后调用 Remove；处理失败或实例崩溃时租约到期后任务会被重新领取
+func (q *redisDelayQueue) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	return delayQueueClaimLua.Run(ctx, q.rdb, []string{q.key},
+		strconv.FormatInt(now.UnixMilli(), 10), limit, strconv.FormatInt(now.Add(lease).UnixMilli(), 10),
+	).StringSlice()
+}
+
+// PeekDue 返回最多 limit 个已到期任务但不删除，处理成功后再调用 Remove，保证至少执行一次
+func (q *redisDelayQueue) PeekDue(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	return q.rdb.ZRangeByScore(ctx, q.key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+}
+
+// Remove 删除已处理的任务
+func (q *redisDelayQueue) Remove(ctx context.Context, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	return q.rdb.ZRem(ctx, q.key, args...).Err()
+}
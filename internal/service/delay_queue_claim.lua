@@ -0,0 +1,12 @@
+local key = KEYS[1]
+local now = ARGV[1]
+local limit = tonumber(ARGV[2])
+local leaseUntil = ARGV[3]
+-- 取出已到期的成员（score <= now）
+local items = redis.call("zrangebyscore", key, "-inf", now, "limit", 0, limit)
+-- 不删除，而是把到期时间推后一个租约：多实例下同一成员只会被一个实例拿到，
+-- 处理成功后由调用方 ZREM；实例在处理中崩溃时租约到期后任务重新可见
+for i = 1, #items do
+  redis.call("zadd", key, leaseUntil, items[i])
+end
+return items
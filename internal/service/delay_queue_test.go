@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestRedisDelayQueuePeekDue 验证只返回已到期任务，且 Remove 之前不会被删除
+func TestRedisDelayQueuePeekDue(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", DB: 0})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	const key = "test:delay:queue"
+	_ = rdb.Del(ctx, key).Err()
+	defer rdb.Del(ctx, key)
+
+	q := newRedisDelayQueue(rdb, key)
+	now := time.Now()
+	// 队头是长退避任务，不能挡住后面已到期的任务
+	_ = q.Push(ctx, "late", now.Add(30*time.Second))
+	_ = q.Push(ctx, "due-1", now.Add(-2*time.Second))
+	_ = q.Push(ctx, "due-2", now.Add(-time.Second))
+
+	due, err := q.PeekDue(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("peek due: %v", err)
+	}
+	if len(due) != 2 || due[0] != "due-1" || due[1] != "due-2" {
+		t.Fatalf("expected [due-1 due-2], got %v", due)
+	}
+	// 未 Remove 前再次 Peek 仍能取到
+	if again, _ := q.PeekDue(ctx, now, 10); len(again) != 2 {
+		t.Fatalf("expected due tasks kept before remove, got %v", again)
+	}
+	if err := q.Remove(ctx, due...); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if left, _ := rdb.ZCard(ctx, key).Result(); left != 1 {
+		t.Fatalf("expected only late task left, got %d", left)
+	}
+}
+
+// TestRedisDelayQueueClaimDue 领取后任务对其他实例不可见，未 Remove 的任务在租约到期后重新可领取
+func TestRedisDelayQueueClaimDue(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", DB: 0})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	const key = "test:delay:queue:claim"
+	_ = rdb.Del(ctx, key).Err()
+	defer rdb.Del(ctx, key)
+
+	q := newRedisDelayQueue(rdb, key)
+	now := time.Now()
+	_ = q.Push(ctx, "due", now.Add(-time.Second))
+
+	claimed, err := q.ClaimDue(ctx, now, time.Minute, 10)
+	if err != nil || len(claimed) != 1 || claimed[0] != "due" {
+		t.Fatalf("expected [due], got %v %v", claimed, err)
+	}
+	if again, _ := q.ClaimDue(ctx, now, time.Minute, 10); len(again) != 0 {
+		t.Fatalf("expected claimed task hidden during lease, got %v", again)
+	}
+	// 模拟处理中崩溃：租约到期后重新可领取
+	if again, _ := q.ClaimDue(ctx, now.Add(2*time.Minute), time.Minute, 10); len(again) != 1 {
+		t.Fatalf("expected task visible after lease, got %v", again)
+	}
+	if err := q.Remove(ctx, "due"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if left, _ := rdb.ZCard(ctx, key).Result(); left != 0 {
+		t.Fatalf("expected queue empty, got %d", left)
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import "context"
+
+// 消息队列驱动
+const (
+	QueueDriverKafka  = "kafka"
+	QueueDriverRedis  = "redis"
+	QueueDriverMemory = "memory"
+)
+
+// Message 与具体消息队列实现无关的消息
+type Message struct {
+	Topic     string
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string // 链路追踪等元数据
+	Partition int               // 分区，不支持分区的实现为 0
+	Offset    int64             // 分区内递增的位置，用于按分区连续提交
+	ID        string            // 队列内的消息标识，逐条确认的实现（Redis Streams）使用
+
+	generation uint64 // 拉取时所属分区跟踪状态的代数，由 offsetTracker 登记时写入
+}
+
+// Producer 消息生产者
+type Producer interface {
+	// Topic 返回写入的 topic，用于埋点
+	Topic() string
+	// Publish 同步写入消息，返回 nil 表示已被队列接收
+	Publish(ctx context.Context, msgs ...Message) error
+	Close() error
+}
+
+// Consumer 消息消费者：处理完成后调用 Commit
+// Kafka 与 Redis Streams 实现为至少一次语义，未提交的消息会被重新投递；
+// 内存实现（MemoryBroker）为至多一次，不重新投递，仅用于测试与单机开发
+type Consumer interface {
+	// Fetch 阻塞拉取下一条消息；ctx 取消时返回 ctx 错误，Close 之后返回 io.EOF
+	Fetch(ctx context.Context) (Message, error)
+	// Commit 确认消息处理完成
+	Commit(ctx context.Context, msgs ...Message) error
+	// Lag 返回积压消息数，用于监控
+	Lag() int64
+	Close() error
+}
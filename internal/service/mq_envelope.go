@@ -0,0 +1,166 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 消息类型
+const (
+	messageTypeOrder           = "seckill.order"
+	messageTypeCacheInvalidate = "shop.cache.invalidate"
+	messageTypePoison          = "mq.poison" // 无法解码、转入死信的原始消息
+)
+
+// 消息生产方
+const (
+	producerVoucherOrder = "voucher-order-service"
+	producerShop         = "shop-service"
+)
+
+// 信封版本
+const (
+	// envelopeVersionLegacy 上一版本：不带信封的裸 JSON，整个消息体即 payload
+	envelopeVersionLegacy = 1
+	// envelopeVersion 当前版本
+	envelopeVersion = 2
+)
+
+// errUndecodableMessage 消息无法解码或未通过校验，按毒消息转入死信
+var errUndecodableMessage = errors.New("undecodable message")
+
+// Envelope 队列消息的统一信封
+type Envelope struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	ID        string          `json:"id"`        // 消息 ID，同一业务事件重复投递时不变，可作为幂等键
+	Producer  string          `json:"producer"`  // 生产方服务
+	Timestamp int64           `json:"timestamp"` // 生产时间（毫秒）
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// poisonMessage 毒消息的死信内容，保留原始消息供人工排查
+type poisonMessage struct {
+	SourceTopic string            `json:"sourceTopic"`
+	Key         string            `json:"key,omitempty"`
+	Value       []byte            `json:"value"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Error       string            `json:"error"`
+}
+
+// encodeEnvelope 按当前版本封装 payload；id 为空时生成随机 ID
+func encodeEnvelope(msgType, producer, id string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+	return json.Marshal(Envelope{
+		Type:      msgType,
+		Version:   envelopeVersion,
+		ID:        id,
+		Producer:  producer,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   data,
+	})
+}
+
+// decodeEnvelope 解析信封；不带 type 与 payload 的 JSON 对象视为 legacy 裸消息
+func decodeEnvelope(data []byte) (Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", errUndecodableMessage, err)
+	}
+	if env.Type == "" && env.Payload == nil {
+		return Envelope{Version: envelopeVersionLegacy, Payload: data}, nil
+	}
+	return env, nil
+}
+
+// decodeMessage 解码指定类型的消息，支持当前版本与上一版本（legacy 裸消息），并校验 payload
+// 返回的 Envelope 在类型不符时同样有效，调用方据此识别死信中的毒消息
+func decodeMessage[T any](data []byte, msgType string, validate func(T) error) (T, Envelope, error) {
+	var payload T
+	env, err := decodeEnvelope(data)
+	if err != nil {
+		return payload, env, err
+	}
+	switch env.Version {
+	case envelopeVersionLegacy:
+		// legacy 消息没有 type，按 topic 约定的类型解析
+	case envelopeVersion:
+		if env.Type != msgType {
+			return payload, env, fmt.Errorf("%w: unexpected type %q, want %q", errUndecodableMessage, env.Type, msgType)
+		}
+	default:
+		return payload, env, fmt.Errorf("%w: unsupported version %d", errUndecodableMessage, env.Version)
+	}
+	if err := json.Unmarshal(env.Payload, &payload); err != nil {
+		return payload, env, fmt.Errorf("%w: %v", errUndecodableMessage, err)
+	}
+	if err := validate(payload); err != nil {
+		return payload, env, fmt.Errorf("%w: %v", errUndecodableMessage, err)
+	}
+	return payload, env, nil
+}
+
+// decodeOrderMessage 解码订单消息
+func decodeOrderMessage(data []byte) (orderMessage, Envelope, error) {
+	return decodeMessage(data, messageTypeOrder, func(m orderMessage) error {
+		if m.OrderID <= 0 || m.UserID <= 0 || m.VoucherID <= 0 {
+			return fmt.Errorf("orderId, userId and voucherId are required")
+		}
+		if m.Quantity < 0 {
+			return fmt.Errorf("invalid quantity %d", m.Quantity)
+		}
+		return nil
+	})
+}
+
+// decodeCacheInvalidateMessage 解码缓存补偿消息
+func decodeCacheInvalidateMessage(data []byte) (cacheInvalidateMessage, Envelope, error) {
+	return decodeMessage(data, messageTypeCacheInvalidate, func(m cacheInvalidateMessage) error {
+		if m.CacheKey == "" {
+			return fmt.Errorf("cacheKey is required")
+		}
+		return nil
+	})
+}
+
+// decodePoisonMessage 解码死信中的毒消息
+func decodePoisonMessage(env Envelope) (poisonMessage, error) {
+	var poison poisonMessage
+	if env.Type != messageTypePoison {
+		return poison, fmt.Errorf("%w: not a poison message", errUndecodableMessage)
+	}
+	if err := json.Unmarshal(env.Payload, &poison); err != nil {
+		return poison, fmt.Errorf("%w: %v", errUndecodableMessage, err)
+	}
+	return poison, nil
+}
+
+// newPoisonMessage 将无法解码的消息封装为死信消息，key 保持不变
+func newPoisonMessage(producer string, msg Message, cause error) (Message, error) {
+	data, err := encodeEnvelope(messageTypePoison, producer, "", poisonMessage{
+		SourceTopic: msg.Topic,
+		Key:         string(msg.Key),
+		Value:       msg.Value,
+		Headers:     msg.Headers,
+		Error:       cause.Error(),
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Key: msg.Key, Value: data, Headers: msg.Headers}, nil
+}
+
+// orderMessageID 订单消息 ID：同一订单同一次重试/重放的消息 ID 相同（outbox 补发等重复投递）
+func orderMessageID(payload orderMessage) string {
+	return fmt.Sprintf("order-%d-%d-%d", payload.OrderID, payload.ReplayCount, payload.RetryCount)
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestDecodeOrderMessageVersions(t *testing.T) {
+	want := orderMessage{OrderID: 1, UserID: 2, VoucherID: 3, Quantity: 2, RetryCount: 1}
+
+	current, err := encodeEnvelope(messageTypeOrder, producerVoucherOrder, orderMessageID(want), want)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	got, env, err := decodeOrderMessage(current)
+	if err != nil {
+		t.Fatalf("decode current: %v", err)
+	}
+	if got != want || env.Version != envelopeVersion || env.ID != "order-1-0-1" || env.Producer != producerVoucherOrder {
+		t.Fatalf("unexpected decode %+v %+v", got, env)
+	}
+
+	// 上一版本：不带信封的裸 JSON
+	legacy, _ := json.Marshal(want)
+	got, env, err = decodeOrderMessage(legacy)
+	if err != nil {
+		t.Fatalf("decode legacy: %v", err)
+	}
+	if got != want || env.Version != envelopeVersionLegacy {
+		t.Fatalf("unexpected legacy decode %+v %+v", got, env)
+	}
+
+	cacheMsg, _ := encodeEnvelope(messageTypeCacheInvalidate, producerShop, "", cacheInvalidateMessage{ShopID: 1, CacheKey: "cache:shop:1"})
+	future, _ := json.Marshal(Envelope{Type: messageTypeOrder, Version: envelopeVersion + 1, Payload: legacy})
+	invalid, _ := json.Marshal(orderMessage{OrderID: 1, VoucherID: 3})
+	for name, data := range map[string][]byte{
+		"not json":     []byte("{oops"),
+		"wrong type":   cacheMsg,
+		"future":       future,
+		"missing user": invalid,
+	} {
+		if _, _, err := decodeOrderMessage(data); !errors.Is(err, errUndecodableMessage) {
+			t.Fatalf("%s: expected errUndecodableMessage, got %v", name, err)
+		}
+	}
+}
+
+// TestConsumeLoopSendsPoisonToDLQ 无法解码的消息转入死信 topic 后再提交，不被丢弃
+func TestConsumeLoopSendsPoisonToDLQ(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewMemoryBroker(16)
+	svc := &VoucherOrderService{log: zap.NewNop(), consumeConcurrency: 1, dlqProducer: broker.Producer("orders-dlq")}
+
+	producer := broker.Producer("orders")
+	_ = producer.Publish(ctx, Message{Key: []byte("12"), Value: []byte("{oops")})
+	valid, _ := encodeEnvelope(messageTypeOrder, producerVoucherOrder, "", orderMessage{OrderID: 1, UserID: 2, VoucherID: 12})
+	_ = producer.Publish(ctx, Message{Key: []byte("12"), Value: valid})
+
+	handled := make(chan orderMessage, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.consumeLoop(ctx, broker.Consumer("orders"), "test", func(_ context.Context, payload orderMessage, _ Message, _ string, _ time.Time, _ trace.Span) (consumeOutcome, error) {
+			handled <- payload
+			return consumeSuccess, nil
+		})
+	}()
+
+	select {
+	case payload := <-handled:
+		if payload.OrderID != 1 {
+			t.Fatalf("unexpected payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for valid message")
+	}
+	cancel()
+	<-done
+	if committed := broker.Committed("orders"); committed != 2 {
+		t.Fatalf("expected committed 2, got %d", committed)
+	}
+
+	dlqCtx, dlqCancel := context.WithTimeout(context.Background(), time.Second)
+	defer dlqCancel()
+	msg, err := broker.Consumer("orders-dlq").Fetch(dlqCtx)
+	if err != nil {
+		t.Fatalf("fetch dlq: %v", err)
+	}
+	env, err := decodeEnvelope(msg.Value)
+	if err != nil {
+		t.Fatalf("decode dlq envelope: %v", err)
+	}
+	poison, err := decodePoisonMessage(env)
+	if err != nil {
+		t.Fatalf("decode poison: %v", err)
+	}
+	if poison.SourceTopic != "orders" || string(poison.Value) != "{oops" || poison.Error == "" {
+		t.Fatalf("unexpected poison message %+v", poison)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaProducer 基于 segmentio/kafka-go Writer 的 Producer
+type kafkaProducer struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaProducer 包装 kafka.Writer
+func NewKafkaProducer(writer *kafka.Writer) Producer {
+	return &kafkaProducer{writer: writer}
+}
+
+func (p *kafkaProducer) Topic() string {
+	return p.writer.Topic
+}
+
+func (p *kafkaProducer) Publish(ctx context.Context, msgs ...Message) error {
+	kmsgs := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		kmsgs[i] = kafka.Message{Key: msg.Key, Value: msg.Value}
+		for k, v := range msg.Headers {
+			kmsgs[i].Headers = append(kmsgs[i].Headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+	}
+	return p.writer.WriteMessages(ctx, kmsgs...)
+}
+
+func (p *kafkaProducer) Close() error {
+	return p.writer.Close()
+}
+
+// kafkaConsumer 基于 segmentio/kafka-go Reader（消费者组、手动提交）的 Consumer
+type kafkaConsumer struct {
+	reader *kafka.Reader
+}
+
+// NewKafkaConsumer 包装 kafka.Reader
+func NewKafkaConsumer(reader *kafka.Reader) Consumer {
+	return &kafkaConsumer{reader: reader}
+}
+
+func (c *kafkaConsumer) Fetch(ctx context.Context) (Message, error) {
+	kmsg, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{
+		Topic:     kmsg.Topic,
+		Key:       kmsg.Key,
+		Value:     kmsg.Value,
+		Partition: kmsg.Partition,
+		Offset:    kmsg.Offset,
+	}
+	if len(kmsg.Headers) > 0 {
+		msg.Headers = make(map[string]string, len(kmsg.Headers))
+		for _, h := range kmsg.Headers {
+			msg.Headers[h.Key] = string(h.Value)
+		}
+	}
+	return msg, nil
+}
+
+// Commit 提交 offset；kafka-go 按分区取最大 offset 提交
+func (c *kafkaConsumer) Commit(ctx context.Context, msgs ...Message) error {
+	kmsgs := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		kmsgs[i] = kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+	}
+	return c.reader.CommitMessages(ctx, kmsgs...)
+}
+
+func (c *kafkaConsumer) Lag() int64 {
+	return c.reader.Stats().Lag
+}
+
+func (c *kafkaConsumer) Close() error {
+	return c.reader.Close()
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+const defaultMemoryQueueBuffer = 1024
+
+// ErrMemoryQueueClosed 内存队列已关闭
+var ErrMemoryQueueClosed = errors.New("memory queue closed")
+
+// MemoryBroker 进程内基于 channel 的消息队列，供单元测试与单机开发模式使用
+// 每个 topic 一个有缓冲 channel，多个消费者竞争消费；消息不持久化，进程退出即丢失
+// 投递语义为至多一次：Fetch 取出即出队，未 Commit 的消息不会重新投递，Commit 只记录进度
+type MemoryBroker struct {
+	mu     sync.Mutex
+	buffer int
+	topics map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	name      string
+	pubMu     sync.Mutex // 分配 offset 与写入 channel 在同一临界区，保证 channel 中 offset 递增
+	mu        sync.Mutex // 保护 committed
+	ch        chan Message
+	closed    chan struct{}
+	closeOnce sync.Once
+	next      int64 // 下一条消息的 offset，由 pubMu 保护
+	committed int64 // 已提交的最大 offset + 1
+}
+
+// NewMemoryBroker 创建内存消息队列，buffer 为每个 topic 的缓冲大小
+func NewMemoryBroker(buffer int) *MemoryBroker {
+	if buffer <= 0 {
+		buffer = defaultMemoryQueueBuffer
+	}
+	return &MemoryBroker{buffer: buffer, topics: make(map[string]*memoryTopic)}
+}
+
+func (b *MemoryBroker) topic(name string) *memoryTopic {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memoryTopic{name: name, ch: make(chan Message, b.buffer), closed: make(chan struct{})}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// Producer 返回写入指定 topic 的生产者
+func (b *MemoryBroker) Producer(topic string) Producer {
+	return &memoryProducer{topic: b.topic(topic)}
+}
+
+// Consumer 返回消费指定 topic 的消费者
+func (b *MemoryBroker) Consumer(topic string) Consumer {
+	return &memoryConsumer{topic: b.topic(topic)}
+}
+
+// Committed 返回 topic 已提交的位置（已确认的最大 offset + 1）
+func (b *MemoryBroker) Committed(topic string) int64 {
+	t := b.topic(topic)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.committed
+}
+
+type memoryProducer struct {
+	topic *memoryTopic
+}
+
+func (p *memoryProducer) Topic() string {
+	return p.topic.name
+}
+
+func (p *memoryProducer) Publish(ctx context.Context, msgs ...Message) error {
+	// 持锁写入：并发发布时 offset 的分配顺序与进入 channel 的顺序一致
+	// 使用独立的 pubMu，channel 满时阻塞的发布者不影响消费者 Commit
+	p.topic.pubMu.Lock()
+	defer p.topic.pubMu.Unlock()
+	for _, msg := range msgs {
+		select {
+		case <-p.topic.closed:
+			return ErrMemoryQueueClosed
+		default:
+		}
+		msg.Topic = p.topic.name
+		msg.Partition = 0
+		msg.Offset = p.topic.next
+		select {
+		case p.topic.ch <- msg:
+			p.topic.next++
+		case <-p.topic.closed:
+			return ErrMemoryQueueClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close 生产者不持有资源，关闭由消费者负责
+func (p *memoryProducer) Close() error {
+	return nil
+}
+
+type memoryConsumer struct {
+	topic *memoryTopic
+}
+
+func (c *memoryConsumer) Fetch(ctx context.Context) (Message, error) {
+	select {
+	case msg := <-c.topic.ch:
+		return msg, nil
+	case <-c.topic.closed:
+		return Message{}, io.EOF
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+func (c *memoryConsumer) Commit(_ context.Context, msgs ...Message) error {
+	c.topic.mu.Lock()
+	defer c.topic.mu.Unlock()
+	for _, msg := range msgs {
+		if msg.Offset+1 > c.topic.committed {
+			c.topic.committed = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+func (c *memoryConsumer) Lag() int64 {
+	return int64(len(c.topic.ch))
+}
+
+// Close 关闭 topic，阻塞中的 Fetch 返回 io.EOF
+func (c *memoryConsumer) Close() error {
+	c.topic.closeOnce.Do(func() { close(c.topic.closed) })
+	return nil
+}
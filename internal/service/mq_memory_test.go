@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/lifecycle"
+	"hmdp-backend/internal/model"
+	"hmdp-backend/internal/utils"
+)
+
+func TestMemoryBrokerPublishFetchCommit(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker(8)
+	producer := broker.Producer("orders")
+	consumer := broker.Consumer("orders")
+
+	for i := 0; i < 3; i++ {
+		if err := producer.Publish(ctx, Message{Key: []byte("12"), Value: []byte(strconv.Itoa(i))}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	if lag := consumer.Lag(); lag != 3 {
+		t.Fatalf("expected lag 3, got %d", lag)
+	}
+	var last Message
+	for i := 0; i < 3; i++ {
+		msg, err := consumer.Fetch(ctx)
+		if err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+		if msg.Offset != int64(i) || msg.Topic != "orders" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+		last = msg
+	}
+	if err := consumer.Commit(ctx, last); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if committed := broker.Committed("orders"); committed != 3 {
+		t.Fatalf("expected committed 3, got %d", committed)
+	}
+
+	_ = consumer.Close()
+	if _, err := consumer.Fetch(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF after close, got %v", err)
+	}
+	if err := producer.Publish(ctx, Message{}); !errors.Is(err, ErrMemoryQueueClosed) {
+		t.Fatalf("expected ErrMemoryQueueClosed, got %v", err)
+	}
+}
+
+// TestConsumeLoopKeepsPerVoucherOrder 并行消费时同券消息保持顺序，全部完成后提交到最后一条
+func TestConsumeLoopKeepsPerVoucherOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewMemoryBroker(256)
+	producer := broker.Producer("orders")
+	svc := &VoucherOrderService{log: zap.NewNop(), consumeConcurrency: 4}
+
+	const perVoucher = 30
+	total := 0
+	for i := 0; i < perVoucher; i++ {
+		for voucherID := int64(1); voucherID <= 5; voucherID++ {
+			data, _ := json.Marshal(orderMessage{OrderID: int64(i + 1), UserID: 1, VoucherID: voucherID})
+			if err := producer.Publish(ctx, Message{Key: []byte(strconv.FormatInt(voucherID, 10)), Value: data}); err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+			total++
+		}
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int64][]int64)
+	handled := make(chan struct{}, total)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.consumeLoop(ctx, broker.Consumer("orders"), "test", func(_ context.Context, payload orderMessage, _ Message, _ string, _ time.Time, _ trace.Span) (consumeOutcome, error) {
+			// 不同券耗时不同，打乱完成顺序
+			time.Sleep(time.Duration(payload.VoucherID) * 100 * time.Microsecond)
+			mu.Lock()
+			seen[payload.VoucherID] = append(seen[payload.VoucherID], payload.OrderID)
+			mu.Unlock()
+			handled <- struct{}{}
+			return consumeSuccess, nil
+		})
+	}()
+
+	for i := 0; i < total; i++ {
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout after %d/%d messages", i, total)
+		}
+	}
+	cancel()
+	<-done
+
+	for voucherID, orders := range seen {
+		for i, orderID := range orders {
+			if orderID != int64(i+1) {
+				t.Fatalf("voucher %d out of order: %v", voucherID, orders)
+			}
+		}
+	}
+	if committed := broker.Committed("orders"); committed != int64(total) {
+		t.Fatalf("expected committed %d, got %d", total, committed)
+	}
+}
+
+// TestSeckillRetryToDLQWithMemoryQueue 使用内存队列跑通 下单 -> 重试 -> 死信落表，无需 Kafka（依赖 Redis、MySQL 与已有 voucher_id=12）
+func TestSeckillRetryToDLQWithMemoryQueue(t *testing.T) {
+	ctx := context.Background()
+
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		dsn = "root:root@tcp(127.0.0.1:3306)/hmdp?parseTime=true&loc=Local&charset=utf8mb4"
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Skipf("skip: cannot connect mysql: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err == nil {
+		defer sqlDB.Close()
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	const voucherID = int64(12)
+	if err := db.WithContext(ctx).Model(&model.SeckillVoucher{}).
+		Where("voucher_id = ?", voucherID).
+		Updates(map[string]interface{}{
+			"stock":       100,
+			"begin_time":  time.Now().Add(-time.Minute),
+			"end_time":    time.Now().Add(5 * time.Minute),
+			"update_time": time.Now(),
+		}).Error; err != nil {
+		t.Fatalf("prepare seckill voucher: %v", err)
+	}
+	_ = rdb.Del(ctx, fmt.Sprintf(voucherMetaKeyFmt, voucherID)).Err()
+	_ = rdb.Set(ctx, fmt.Sprintf(stockKeyFmt, voucherID), 100, 0).Err()
+	_ = rdb.Del(ctx, fmt.Sprintf(orderCountKeyFmt, voucherID)).Err()
+
+	// 每次落库都失败，直到重试耗尽进入死信
+	t.Setenv("FORCE_SECKILL_CONSUME_FAIL_COUNT", strconv.Itoa(maxRetryCount+1))
+
+	broker := NewMemoryBroker(64)
+	svc := NewVoucherOrderService(db, rdb,
+		broker.Producer("orders"), broker.Producer("orders-retry"), broker.Producer("orders-dlq"),
+		broker.Consumer("orders"), broker.Consumer("orders-retry"), broker.Consumer("orders-dlq"),
+		utils.SMTPConfig{}, config.SeckillConfig{ReconcileInterval: -1}, nil, newTestLogger(t))
+	lc := lifecycle.NewManager(newTestLogger(t))
+	svc.Start(lc)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = lc.Stop(stopCtx)
+	}()
+
+	orderID, err := svc.Seckill(ctx, voucherID, 9001, 1)
+	if err != nil {
+		t.Fatalf("seckill: %v", err)
+	}
+	defer db.WithContext(ctx).Where("order_id = ?", orderID).Delete(&model.SeckillDLQEntry{})
+
+	// 退避 1s + 2s + 4s
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		var entry model.SeckillDLQEntry
+		err := db.WithContext(ctx).Where("order_id = ?", orderID).Take(&entry).Error
+		if err == nil {
+			if entry.RetryCount != maxRetryCount+1 {
+				t.Fatalf("expected retryCount %d, got %d", maxRetryCount+1, entry.RetryCount)
+			}
+			return
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("query dlq: %v", err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("order %d did not reach dlq", orderID)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// TestMemoryBrokerConcurrentPublishKeepsOffsetOrder 并发发布时消费者看到的 offset 严格递增
+func TestMemoryBrokerConcurrentPublishKeepsOffsetOrder(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker(4)
+	consumer := broker.Consumer("orders")
+	defer consumer.Close()
+
+	const publishers, perPublisher = 8, 200
+	var wg sync.WaitGroup
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			producer := broker.Producer("orders")
+			for j := 0; j < perPublisher; j++ {
+				if err := producer.Publish(ctx, Message{Value: []byte(strconv.Itoa(j))}); err != nil {
+					t.Errorf("publish: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	for want := int64(0); want < publishers*perPublisher; want++ {
+		msg, err := consumer.Fetch(fetchCtx)
+		if err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+		if msg.Offset != want {
+			t.Fatalf("expected offset %d, got %d", want, msg.Offset)
+		}
+	}
+	wg.Wait()
+}
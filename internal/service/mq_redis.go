@@ -0,0 +1,429 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/observability"
+)
+
+const (
+	defaultRedisStreamPrefix        = "stream:"
+	defaultRedisStreamTrimInterval  = time.Minute
+	defaultRedisStreamBatchSize     = 100
+	defaultRedisStreamBlock         = time.Second
+	defaultRedisStreamClaimInterval = 5 * time.Second
+	defaultRedisStreamClaimMinIdle  = 30 * time.Second
+	redisStreamLagTimeout           = 2 * time.Second
+)
+
+// stream entry 字段
+const (
+	redisStreamFieldKey     = "key"
+	redisStreamFieldValue   = "value"
+	redisStreamFieldHeaders = "headers"
+)
+
+// withRedisStreamDefaults 补全 Redis Streams 配置的默认值
+func withRedisStreamDefaults(cfg config.RedisStreamConfig) config.RedisStreamConfig {
+	if cfg.StreamPrefix == "" {
+		cfg.StreamPrefix = defaultRedisStreamPrefix
+	}
+	if cfg.Consumer == "" {
+		host, _ := os.Hostname()
+		cfg.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if cfg.TrimInterval == 0 {
+		cfg.TrimInterval = defaultRedisStreamTrimInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultRedisStreamBatchSize
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = defaultRedisStreamBlock
+	}
+	if cfg.ClaimInterval <= 0 {
+		cfg.ClaimInterval = defaultRedisStreamClaimInterval
+	}
+	if cfg.ClaimMinIdle <= 0 {
+		cfg.ClaimMinIdle = defaultRedisStreamClaimMinIdle
+	}
+	return cfg
+}
+
+// redisStreamProducer 基于 Redis Streams（XADD）的 Producer
+// 写入时不按 MAXLEN 裁剪：近似裁剪会删掉消费者组尚未读取的消息，裁剪由消费者按各组进度执行
+type redisStreamProducer struct {
+	rdb    *redis.Client
+	topic  string
+	stream string
+}
+
+// NewRedisStreamProducer 创建写入 前缀 + topic 的 stream 生产者
+func NewRedisStreamProducer(rdb *redis.Client, cfg config.RedisStreamConfig, topic string) Producer {
+	cfg = withRedisStreamDefaults(cfg)
+	return &redisStreamProducer{rdb: rdb, topic: topic, stream: cfg.StreamPrefix + topic}
+}
+
+func (p *redisStreamProducer) Topic() string {
+	return p.topic
+}
+
+// Publish 在一个 pipeline 内 XADD 全部消息
+func (p *redisStreamProducer) Publish(ctx context.Context, msgs ...Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	pipe := p.rdb.Pipeline()
+	for _, msg := range msgs {
+		values := []interface{}{redisStreamFieldKey, msg.Key, redisStreamFieldValue, msg.Value}
+		if len(msg.Headers) > 0 {
+			headers, err := json.Marshal(msg.Headers)
+			if err != nil {
+				return err
+			}
+			values = append(values, redisStreamFieldHeaders, headers)
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: p.stream,
+			Values: values,
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Close Redis 客户端由调用方管理
+func (p *redisStreamProducer) Close() error {
+	return nil
+}
+
+// redisStreamConsumer 基于 Redis Streams 消费者组的 Consumer
+// XREADGROUP 拉取新消息，Commit 时逐条 XACK；定期扫描 XPENDING，将超过 ClaimMinIdle 未确认的消息
+// （所属实例崩溃或卡住）XCLAIM 到本消费者重新投递，与 Kafka 未提交 offset 重新消费的语义一致
+// 定期按 MINID 裁剪 stream：只删除所有消费者组都已读取且已确认的消息
+// Fetch 只能由单个协程调用
+type redisStreamConsumer struct {
+	rdb     *redis.Client
+	cfg     config.RedisStreamConfig
+	topic   string
+	stream  string
+	group   string
+	log     *zap.Logger
+	metrics *observability.QueueMetrics
+
+	groupReady bool
+	lastClaim  time.Time
+	lastTrim   time.Time
+	buf        []Message
+	seq        int64 // 本地递增序号，作为 Offset 供 offsetTracker 按拉取顺序连续确认
+
+	mu       sync.Mutex
+	inflight map[string]struct{} // 已拉取未确认的消息，扫描 XPENDING 时跳过
+	closed   atomic.Bool
+}
+
+// NewRedisStreamConsumer 创建消费 前缀 + topic 的 stream 消费者，消费者组不存在时自动创建
+func NewRedisStreamConsumer(
+	rdb *redis.Client,
+	cfg config.RedisStreamConfig,
+	topic, group string,
+	metrics *observability.QueueMetrics,
+	log *zap.Logger,
+) Consumer {
+	cfg = withRedisStreamDefaults(cfg)
+	if log == nil {
+		log = zap.NewNop()
+	}
+	return &redisStreamConsumer{
+		rdb:      rdb,
+		cfg:      cfg,
+		topic:    topic,
+		stream:   cfg.StreamPrefix + topic,
+		group:    group,
+		log:      log,
+		metrics:  metrics,
+		inflight: make(map[string]struct{}),
+	}
+}
+
+func (c *redisStreamConsumer) Fetch(ctx context.Context) (Message, error) {
+	for {
+		if c.closed.Load() {
+			return Message{}, io.EOF
+		}
+		if err := ctx.Err(); err != nil {
+			return Message{}, err
+		}
+		if len(c.buf) > 0 {
+			msg := c.buf[0]
+			c.buf = c.buf[1:]
+			return msg, nil
+		}
+		if err := c.ensureGroup(ctx); err != nil {
+			return Message{}, err
+		}
+		if time.Since(c.lastClaim) >= c.cfg.ClaimInterval {
+			c.lastClaim = time.Now()
+			if err := c.claimStuck(ctx); err != nil {
+				return Message{}, err
+			}
+			if len(c.buf) > 0 {
+				continue
+			}
+		}
+		if c.cfg.TrimInterval > 0 && time.Since(c.lastTrim) >= c.cfg.TrimInterval {
+			c.lastTrim = time.Now()
+			// 裁剪失败只影响 stream 占用的内存，不中断消费
+			if err := c.trim(ctx); err != nil {
+				c.log.Warn("trim redis stream failed", zap.String("stream", c.stream), zap.Error(err))
+			}
+		}
+		streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.cfg.Consumer,
+			Streams:  []string{c.stream, ">"},
+			Count:    c.cfg.BatchSize,
+			Block:    c.cfg.Block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if isRedisNoGroup(err) {
+				// stream 被删除后重建消费者组
+				c.groupReady = false
+			}
+			return Message{}, err
+		}
+		for _, s := range streams {
+			c.enqueue(ctx, s.Messages)
+		}
+	}
+}
+
+// ensureGroup 创建消费者组（MKSTREAM），从 stream 起始位置消费，已存在时忽略
+func (c *redisStreamConsumer) ensureGroup(ctx context.Context) error {
+	if c.groupReady {
+		return nil
+	}
+	err := c.rdb.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	c.groupReady = true
+	return nil
+}
+
+// claimStuck 将超过 ClaimMinIdle 未确认的消息转移给本消费者，本实例仍在处理中的消息除外
+func (c *redisStreamConsumer) claimStuck(ctx context.Context) error {
+	c.mu.Lock()
+	inflight := len(c.inflight)
+	c.mu.Unlock()
+	pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Idle:   c.cfg.ClaimMinIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  c.cfg.BatchSize + int64(inflight),
+	}).Result()
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(pending))
+	c.mu.Lock()
+	for _, p := range pending {
+		if _, ok := c.inflight[p.ID]; ok {
+			continue
+		}
+		ids = append(ids, p.ID)
+	}
+	c.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+	claimed, err := c.rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.cfg.Consumer,
+		MinIdle:  c.cfg.ClaimMinIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	c.enqueue(ctx, claimed)
+	return nil
+}
+
+// trim 按 MINID 删除所有消费者组都已处理完的消息：每个组的安全位置为最早未确认的消息与最后投递位置中较小者，
+// 取所有组的最小值。还没有消费者组时不裁剪；之后新建、从头消费的组读不到已裁剪的历史消息
+func (c *redisStreamConsumer) trim(ctx context.Context) error {
+	groups, err := c.rdb.XInfoGroups(ctx, c.stream).Result()
+	if err != nil {
+		return err
+	}
+	minID := ""
+	for _, g := range groups {
+		safe := g.LastDeliveredID
+		if g.Pending > 0 {
+			pending, err := c.rdb.XPending(ctx, c.stream, g.Name).Result()
+			if err != nil {
+				return err
+			}
+			if pending.Count > 0 && compareStreamID(pending.Lower, safe) < 0 {
+				safe = pending.Lower
+			}
+		}
+		if minID == "" || compareStreamID(safe, minID) < 0 {
+			minID = safe
+		}
+	}
+	if minID == "" || minID == "0-0" {
+		return nil
+	}
+	// 近似裁剪只会少删，不会删除 minID 及之后的消息
+	n, err := c.rdb.XTrimMinIDApprox(ctx, c.stream, minID, 0).Result()
+	if err != nil {
+		return err
+	}
+	c.metrics.ObserveStreamTrimmed(c.topic, n)
+	return nil
+}
+
+// compareStreamID 比较两个 stream ID（毫秒时间戳-序号）
+func compareStreamID(a, b string) int {
+	aMs, aSeq := parseStreamID(a)
+	bMs, bSeq := parseStreamID(b)
+	switch {
+	case aMs != bMs:
+		if aMs < bMs {
+			return -1
+		}
+		return 1
+	case aSeq != bSeq:
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	default:
+		return 0
+	}
+}
+
+func parseStreamID(id string) (uint64, uint64) {
+	msPart, seqPart, _ := strings.Cut(id, "-")
+	ms, _ := strconv.ParseUint(msPart, 10, 64)
+	seq, _ := strconv.ParseUint(seqPart, 10, 64)
+	return ms, seq
+}
+
+// enqueue 转换并缓存拉取到的消息；内容已被删除的消息无法再处理，记录错误与指标后确认，避免反复被 XCLAIM
+func (c *redisStreamConsumer) enqueue(ctx context.Context, entries []redis.XMessage) {
+	var trimmed []string
+	c.mu.Lock()
+	for _, entry := range entries {
+		msg, ok := redisStreamMessage(c.topic, entry)
+		if !ok {
+			trimmed = append(trimmed, entry.ID)
+			continue
+		}
+		msg.Offset = c.seq
+		c.seq++
+		c.inflight[msg.ID] = struct{}{}
+		c.buf = append(c.buf, msg)
+	}
+	c.mu.Unlock()
+	if len(trimmed) > 0 {
+		for _, id := range trimmed {
+			c.log.Error("redis stream message deleted before processing, message lost",
+				zap.String("stream", c.stream),
+				zap.String("group", c.group),
+				zap.String("id", id),
+			)
+		}
+		c.metrics.ObserveStreamLost(c.topic, len(trimmed))
+		_ = c.rdb.XAck(ctx, c.stream, c.group, trimmed...).Err()
+	}
+}
+
+// redisStreamMessage 将 stream entry 转换为 Message，缺少消息体时返回 false
+func redisStreamMessage(topic string, entry redis.XMessage) (Message, bool) {
+	value, ok := entry.Values[redisStreamFieldValue].(string)
+	if !ok {
+		return Message{}, false
+	}
+	msg := Message{Topic: topic, ID: entry.ID, Value: []byte(value)}
+	if key, ok := entry.Values[redisStreamFieldKey].(string); ok {
+		msg.Key = []byte(key)
+	}
+	if headers, ok := entry.Values[redisStreamFieldHeaders].(string); ok && headers != "" {
+		_ = json.Unmarshal([]byte(headers), &msg.Headers)
+	}
+	return msg, true
+}
+
+// Commit 逐条 XACK，确认后的消息不会再被重新投递
+func (c *redisStreamConsumer) Commit(ctx context.Context, msgs ...Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		ids = append(ids, msg.ID)
+	}
+	if err := c.rdb.XAck(ctx, c.stream, c.group, ids...).Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	for _, id := range ids {
+		delete(c.inflight, id)
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// Lag 返回消费者组未投递与已投递未确认的消息数之和
+func (c *redisStreamConsumer) Lag() int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), redisStreamLagTimeout)
+	defer cancel()
+	groups, err := c.rdb.XInfoGroups(ctx, c.stream).Result()
+	if err != nil {
+		return 0
+	}
+	for _, g := range groups {
+		if g.Name != c.group {
+			continue
+		}
+		lag := g.Pending
+		if g.Lag > 0 {
+			lag += g.Lag
+		}
+		return lag
+	}
+	return 0
+}
+
+// Close 之后 Fetch 返回 io.EOF；未确认的消息留在 PEL 中，由其他实例 XCLAIM 接管
+func (c *redisStreamConsumer) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func isRedisNoGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
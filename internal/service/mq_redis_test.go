@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/config"
+)
+
+func TestRedisStreamMessage(t *testing.T) {
+	msg, ok := redisStreamMessage("orders", redis.XMessage{
+		ID: "1-0",
+		Values: map[string]interface{}{
+			redisStreamFieldKey:     "12",
+			redisStreamFieldValue:   `{"orderId":1}`,
+			redisStreamFieldHeaders: `{"traceparent":"00-abc"}`,
+		},
+	})
+	if !ok {
+		t.Fatalf("expected message to convert")
+	}
+	if msg.ID != "1-0" || msg.Topic != "orders" || string(msg.Key) != "12" || string(msg.Value) != `{"orderId":1}` {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if msg.Headers["traceparent"] != "00-abc" {
+		t.Fatalf("unexpected headers %v", msg.Headers)
+	}
+	// 被裁剪的 entry 没有字段
+	if _, ok := redisStreamMessage("orders", redis.XMessage{ID: "2-0"}); ok {
+		t.Fatalf("expected trimmed entry to be rejected")
+	}
+}
+
+// TestRedisStreamConsumerClaimsStuckMessages 未确认的消息超过 claimMinIdle 后被组内其他消费者接管（依赖本地 Redis）
+func TestRedisStreamConsumerClaimsStuckMessages(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	topic := fmt.Sprintf("test-orders-%d", time.Now().UnixNano())
+	cfg := config.RedisStreamConfig{
+		StreamPrefix:  "test:stream:",
+		Block:         100 * time.Millisecond,
+		ClaimInterval: 50 * time.Millisecond,
+		ClaimMinIdle:  100 * time.Millisecond,
+	}
+	defer rdb.Del(ctx, cfg.StreamPrefix+topic)
+
+	producer := NewRedisStreamProducer(rdb, cfg, topic)
+	crashedCfg, aliveCfg := cfg, cfg
+	crashedCfg.Consumer = "crashed"
+	aliveCfg.Consumer = "alive"
+	crashed := NewRedisStreamConsumer(rdb, crashedCfg, topic, "test-group", nil, zap.NewNop())
+	alive := NewRedisStreamConsumer(rdb, aliveCfg, topic, "test-group", nil, zap.NewNop())
+
+	fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	// 先建组再写入
+	if err := crashed.(*redisStreamConsumer).ensureGroup(fetchCtx); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if err := producer.Publish(ctx, Message{Key: []byte("12"), Value: []byte("payload"), Headers: map[string]string{"h": "v"}}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	// crashed 拉取后不确认
+	first, err := crashed.Fetch(fetchCtx)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	_ = crashed.Close()
+
+	redelivered, err := alive.Fetch(fetchCtx)
+	if err != nil {
+		t.Fatalf("fetch claimed: %v", err)
+	}
+	if redelivered.ID != first.ID || string(redelivered.Value) != "payload" || redelivered.Headers["h"] != "v" {
+		t.Fatalf("expected claimed %s, got %+v", first.ID, redelivered)
+	}
+	if err := alive.Commit(ctx, redelivered); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	pending, err := rdb.XPending(ctx, cfg.StreamPrefix+topic, "test-group").Result()
+	if err != nil {
+		t.Fatalf("xpending: %v", err)
+	}
+	if pending.Count != 0 {
+		t.Fatalf("expected no pending messages, got %d", pending.Count)
+	}
+	if lag := alive.Lag(); lag != 0 {
+		t.Fatalf("expected lag 0, got %d", lag)
+	}
+}
+
+func TestCompareStreamID(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1-0", "1-0", 0},
+		{"1-1", "1-0", 1},
+		{"9-5", "10-0", -1},
+		{"1700000000000-2", "1700000000000-10", -1},
+		{"0-0", "1-0", -1},
+	}
+	for _, c := range cases {
+		if got := compareStreamID(c.a, c.b); got != c.want {
+			t.Fatalf("compareStreamID(%s, %s) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+// TestRedisStreamTrimKeepsUnackedMessages 裁剪只删除所有消费者组都已确认的消息（依赖本地 Redis）
+func TestRedisStreamTrimKeepsUnackedMessages(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	topic := fmt.Sprintf("test-trim-%d", time.Now().UnixNano())
+	cfg := config.RedisStreamConfig{StreamPrefix: "test:stream:", Block: 100 * time.Millisecond, TrimInterval: -1}
+	stream := cfg.StreamPrefix + topic
+	defer rdb.Del(ctx, stream)
+
+	fast := NewRedisStreamConsumer(rdb, cfg, topic, "fast", nil, zap.NewNop()).(*redisStreamConsumer)
+	slow := NewRedisStreamConsumer(rdb, cfg, topic, "slow", nil, zap.NewNop()).(*redisStreamConsumer)
+	if err := fast.ensureGroup(ctx); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if err := slow.ensureGroup(ctx); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	producer := NewRedisStreamProducer(rdb, cfg, topic)
+	for i := 0; i < 5; i++ {
+		if err := producer.Publish(ctx, Message{Key: []byte("k"), Value: []byte(fmt.Sprint(i))}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	// fast 组全部读取并确认；slow 组只读取两条且未确认
+	for i := 0; i < 5; i++ {
+		msg, err := fast.Fetch(ctx)
+		if err != nil {
+			t.Fatalf("fast fetch: %v", err)
+		}
+		if err := fast.Commit(ctx, msg); err != nil {
+			t.Fatalf("fast commit: %v", err)
+		}
+	}
+	if _, err := slow.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: "slow", Consumer: "c", Streams: []string{stream, ">"}, Count: 2,
+	}).Result(); err != nil {
+		t.Fatalf("slow read: %v", err)
+	}
+
+	if err := fast.trim(ctx); err != nil {
+		t.Fatalf("trim: %v", err)
+	}
+	n, err := rdb.XLen(ctx, stream).Result()
+	if err != nil {
+		t.Fatalf("xlen: %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("expected unacked entries to survive trim, stream length %d", n)
+	}
+}
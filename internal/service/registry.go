@@ -2,11 +2,12 @@ package service
 
 import (
 	"github.com/redis/go-redis/v9"
-	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
+	"hmdp-backend/internal/cache"
 	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/lifecycle"
 	"hmdp-backend/internal/observability"
 	"hmdp-backend/internal/utils"
 )
@@ -21,25 +22,30 @@ type Registry struct {
 	User           *UserService
 	VoucherOrder   *VoucherOrderService
 	Follow         *FollowService
+
+	// 本地缓存跨实例失效广播
+	cacheInvalidator *cache.Invalidator
 }
 
 // NewRegistry 构造服务注册中心
 func NewRegistry(
 	db *gorm.DB,
 	rdb *redis.Client,
-	kafkaWriter *kafka.Writer,
-	kafkaRetryWriter *kafka.Writer,
-	kafkaDLQWriter *kafka.Writer,
-	cacheInvalidateWriter *kafka.Writer,
-	cacheInvalidateDLQWriter *kafka.Writer,
-	kafkaReader *kafka.Reader,
-	kafkaRetryReader *kafka.Reader,
-	kafkaDLQReader *kafka.Reader,
-	cacheInvalidateReader *kafka.Reader,
-	cacheInvalidateDLQReader *kafka.Reader,
+	orderProducer Producer,
+	orderRetryProducer Producer,
+	orderDLQProducer Producer,
+	cacheInvalidateProducer Producer,
+	cacheInvalidateDLQProducer Producer,
+	orderConsumer Consumer,
+	orderRetryConsumer Consumer,
+	orderDLQConsumer Consumer,
+	cacheInvalidateConsumer Consumer,
+	cacheInvalidateDLQConsumer Consumer,
 	smtpCfg utils.SMTPConfig,
 	shopCacheCfg config.ShopCacheConfig,
+	seckillCfg config.SeckillConfig,
 	seckillMetrics *observability.SeckillMetrics,
+	cacheMetrics *observability.CacheMetrics,
 	log *zap.Logger,
 ) *Registry {
 	if log == nil {
@@ -47,14 +53,26 @@ func NewRegistry(
 	}
 	seckillSvc := NewSeckillVoucherService(db)
 	followSvc := NewFollowService(db, rdb)
+	invalidator := cache.NewInvalidator(rdb, cacheMetrics, log)
 	return &Registry{
 		Blog:           NewBlogService(db, rdb, followSvc),
-		Shop:           NewShopService(db, rdb, cacheInvalidateWriter, cacheInvalidateDLQWriter, cacheInvalidateReader, cacheInvalidateDLQReader, smtpCfg, shopCacheCfg, log),
+		Shop:           NewShopService(db, rdb, cacheInvalidateProducer, cacheInvalidateDLQProducer, cacheInvalidateConsumer, cacheInvalidateDLQConsumer, smtpCfg, shopCacheCfg, invalidator, cacheMetrics, log),
 		ShopType:       NewShopTypeService(db, rdb),
 		Voucher:        NewVoucherService(db, seckillSvc, rdb),
 		SeckillVoucher: seckillSvc,
 		User:           NewUserService(db, rdb),
-		VoucherOrder:   NewVoucherOrderService(db, rdb, kafkaWriter, kafkaRetryWriter, kafkaDLQWriter, kafkaReader, kafkaRetryReader, kafkaDLQReader, smtpCfg, seckillMetrics, log),
+		VoucherOrder:   NewVoucherOrderService(db, rdb, orderProducer, orderRetryProducer, orderDLQProducer, orderConsumer, orderRetryConsumer, orderDLQConsumer, smtpCfg, seckillCfg, seckillMetrics, log),
 		Follow:         followSvc,
+
+		cacheInvalidator: invalidator,
+	}
+}
+
+// Start 启动各 Service 的后台消费者与定时任务，由生命周期管理器统一停止
+func (r *Registry) Start(lc *lifecycle.Manager) {
+	if r.cacheInvalidator != nil {
+		lc.Go("cacheInvalidations", r.cacheInvalidator.Run)
 	}
+	r.Shop.Start(lc)
+	r.VoucherOrder.Start(lc)
 }
@@ -1,18 +1,70 @@
 local stockKey = KEYS[1]
-local orderSetKey = KEYS[2]
+local orderCountKey = KEYS[2]
+local metaKey = KEYS[3]
+local roomKey = KEYS[4]
+local ticketKey = KEYS[5]
+local legacyOrderKey = KEYS[6]
 local userId = ARGV[1]
+local quantity = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+-- 读取秒杀券元数据：返回 {状态码, 支付超时秒数}
+local meta = redis.call("hmget", metaKey, "missing", "status", "beginAt", "endAt", "limit", "payTimeout", "admissionRate")
+-- 元数据未缓存，由调用方从 DB 加载后重试
+if not meta[1] and not meta[2] then
+  return {9, 0}
+end
+-- 空标记：券不存在
+if meta[1] then
+  return {3, 0}
+end
+-- 状态 1 表示上架
+if tonumber(meta[2]) ~= 1 then
+  return {4, 0}
+end
+if now < tonumber(meta[3]) then
+  return {5, 0}
+end
+if now > tonumber(meta[4]) then
+  return {6, 0}
+end
+-- 等候室：放行速率 > 0 时只有排队号已被放行的用户可以下单
+-- 放行进度与 seckill_waiting_room.lua 按同一公式计算，这里只读不写
+local rate = tonumber(meta[7]) or 0
+if rate > 0 then
+  local ticket = tonumber(redis.call("hget", ticketKey, userId))
+  if not ticket then
+    return {7, 0}
+  end
+  local room = redis.call("hmget", roomKey, "seq", "admitted", "ts")
+  local seq = tonumber(room[1]) or 0
+  local admitted = tonumber(room[2]) or 0
+  local ts = math.max(tonumber(room[3]) or 0, tonumber(meta[3]))
+  if now > ts then
+    admitted = math.min(seq, admitted + math.floor((now - ts) * rate / 1000))
+  end
+  if ticket > admitted then
+    return {7, 0}
+  end
+end
+local limit = tonumber(meta[5])
 -- 获取voucher的库存值
 local stock = tonumber(redis.call("get", stockKey))
--- 判断库存是否存在或已小于0
-if not stock or stock <= 0 then
-  return 1
-end
--- 检查orderSetKey中是否已包含userId 用来判断用户是否重复下单
-if redis.call("sismember", orderSetKey, userId) == 1 then
-  return 2
-end
--- 库存值减一
-redis.call("decr", stockKey)
--- 将userId添加到集合中
-redis.call("sadd", orderSetKey, userId)
-return 0
+-- 判断库存是否存在或不足本次购买数量
+if not stock or stock < quantity then
+  return {1, 0}
+end
+-- 读取用户已购数量 判断是否超出每人限购（limit <= 0 表示不限购）
+local bought = tonumber(redis.call("hget", orderCountKey, userId) or "0")
+-- 兼容旧版 Set order:vid（每人一单）：迁移窗口内用户仍在旧 Set 中则记为已购 1，并迁移到新 Hash
+if bought == 0 and redis.call("srem", legacyOrderKey, userId) == 1 then
+  bought = 1
+  redis.call("hset", orderCountKey, userId, 1)
+end
+if limit > 0 and bought + quantity > limit then
+  return {2, 0}
+end
+-- 扣减库存
+redis.call("decrby", stockKey, quantity)
+-- 累加用户已购数量
+redis.call("hincrby", orderCountKey, userId, quantity)
+return {0, tonumber(meta[6])}
@@ -0,0 +1,26 @@
+local stockKey = KEYS[1]
+local orderCountKey = KEYS[2]
+local legacyOrderKey = KEYS[3]
+local userId = ARGV[1]
+local quantity = tonumber(ARGV[2])
+-- 可选的补偿标记：KEYS[4] 存在时同一标记只补偿一次，消息重复消费或原地重试不会重复归还库存
+local markerKey = KEYS[4]
+if markerKey and redis.call("set", markerKey, 1, "NX", "EX", ARGV[3]) == false then
+  return 0
+end
+-- 库存 key 不存在说明秒杀券已被删除，无需归还
+if redis.call("exists", stockKey) == 0 then
+  return 0
+end
+-- 归还库存
+redis.call("incrby", stockKey, quantity)
+-- 旧版 Set order:vid 中的用户尚未迁移，说明这是升级前的订单，从旧 Set 中移除即可恢复下单资格
+if redis.call("srem", legacyOrderKey, userId) == 1 then
+  return 0
+end
+-- 扣回用户已购数量，归零后删除字段恢复下单资格
+local left = redis.call("hincrby", orderCountKey, userId, -quantity)
+if left <= 0 then
+  redis.call("hdel", orderCountKey, userId)
+end
+return left
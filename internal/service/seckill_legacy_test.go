@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestSeckillLuaReadsLegacyOrderSet 升级前已下单的用户（旧版 Set order:vid）不能再次购买，补偿时从旧 Set 恢复资格（依赖本地 Redis）
+func TestSeckillLuaReadsLegacyOrderSet(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", DB: 0})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	voucherID := time.Now().UnixNano()
+	keys := []string{
+		fmt.Sprintf(stockKeyFmt, voucherID),
+		fmt.Sprintf(orderCountKeyFmt, voucherID),
+		fmt.Sprintf(voucherMetaKeyFmt, voucherID),
+		fmt.Sprintf(waitingRoomKeyFmt, voucherID),
+		fmt.Sprintf(waitingTicketKeyFmt, voucherID),
+		fmt.Sprintf(legacyOrderKeyFmt, voucherID),
+	}
+	defer rdb.Del(ctx, keys...)
+
+	now := time.Now()
+	rdb.Set(ctx, keys[0], 10, 0)
+	rdb.HSet(ctx, keys[2], "status", 1, "beginAt", now.Add(-time.Hour).UnixMilli(), "endAt", now.Add(time.Hour).UnixMilli(),
+		"limit", 1, "payTimeout", 900, "admissionRate", 0)
+	rdb.SAdd(ctx, keys[5], 1, 2)
+
+	script := redis.NewScript(seckillLuaSource)
+	res, err := script.Run(ctx, rdb, keys, 1, 1, now.UnixMilli()).Int64Slice()
+	if err != nil {
+		t.Fatalf("run seckill lua: %v", err)
+	}
+	if res[0] != 2 {
+		t.Fatalf("expected legacy buyer rejected by limit, got %v", res)
+	}
+	if n, _ := rdb.HGet(ctx, keys[1], "1").Int64(); n != 1 {
+		t.Fatalf("expected legacy purchase migrated to hash, got %d", n)
+	}
+	if ok, _ := rdb.SIsMember(ctx, keys[5], 1).Result(); ok {
+		t.Fatalf("expected user removed from legacy set")
+	}
+
+	// 用户 2 的升级前订单被取消：归还库存并从旧 Set 移除后可以再次购买
+	if err := seckillCompensateLua.Run(ctx, rdb, []string{keys[0], keys[1], keys[5]}, 2, 1).Err(); err != nil {
+		t.Fatalf("run compensate lua: %v", err)
+	}
+	if stock, _ := rdb.Get(ctx, keys[0]).Int64(); stock != 11 {
+		t.Fatalf("expected stock 11 after compensation, got %d", stock)
+	}
+	res, err = script.Run(ctx, rdb, keys, 2, 1, now.UnixMilli()).Int64Slice()
+	if err != nil || res[0] != 0 {
+		t.Fatalf("expected user 2 to buy again, got %v %v", res, err)
+	}
+}
@@ -0,0 +1,12 @@
+local stockKey = KEYS[1]
+local orderCountKey = KEYS[2]
+local userId = ARGV[1]
+local quantity = tonumber(ARGV[2])
+-- 死信重放时重新预占库存：只校验库存，不校验限购与时间窗口
+local stock = tonumber(redis.call("get", stockKey))
+if not stock or stock < quantity then
+  return 1
+end
+redis.call("decrby", stockKey, quantity)
+redis.call("hincrby", orderCountKey, userId, quantity)
+return 0
@@ -0,0 +1,14 @@
+local stockKey = KEYS[1]
+local delta = tonumber(ARGV[1])
+local dbStock = tonumber(ARGV[2])
+local stock = tonumber(redis.call("get", stockKey))
+-- Redis 库存不存在（未预热或被清理），以调整后的 DB 库存为准重建
+if stock == nil then
+  redis.call("set", stockKey, dbStock)
+  return dbStock
+end
+-- 调整后库存不能为负
+if stock + delta < 0 then
+  return -1
+end
+return redis.call("incrby", stockKey, delta)
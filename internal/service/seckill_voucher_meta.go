@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	voucherMetaKeyFmt  = "seckill:voucher:vid:%d" // 秒杀券元数据（Hash），供秒杀脚本校验
+	voucherMetaTTL     = time.Hour
+	voucherMetaNullTTL = time.Minute // 不存在的券缓存空标记，防止穿透到 MySQL
+)
+
+// loadVoucherMeta 从 DB 加载秒杀券状态、时间窗口、限购、支付超时与等候室放行速率并写入 Redis
+// 同一券的并发未命中通过 singleflight 合并为一次查询
+func (s *VoucherOrderService) loadVoucherMeta(ctx context.Context, voucherID int64) error {
+	_, err, _ := s.metaGroup.Do(strconv.FormatInt(voucherID, 10), func() (interface{}, error) {
+		var info struct {
+			ID            int64
+			Status        int
+			BeginTime     time.Time
+			EndTime       time.Time
+			PayTimeout    int
+			LimitPerUser  int
+			AdmissionRate int
+		}
+		key := fmt.Sprintf(voucherMetaKeyFmt, voucherID)
+		err := s.db.WithContext(ctx).Table("tb_voucher AS v").
+			Select("v.id, v.status, sv.begin_time, sv.end_time, sv.pay_timeout, sv.limit_per_user, sv.admission_rate").
+			Joins("JOIN tb_seckill_voucher sv ON v.id = sv.voucher_id").
+			Where("v.id = ?", voucherID).
+			Take(&info).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, key)
+				pipe.HSet(ctx, key, "missing", 1)
+				pipe.Expire(ctx, key, voucherMetaNullTTL)
+				return nil
+			})
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.HSet(ctx, key,
+				"status", info.Status,
+				"beginAt", info.BeginTime.UnixMilli(),
+				"endAt", info.EndTime.UnixMilli(),
+				"limit", info.LimitPerUser,
+				"payTimeout", info.PayTimeout,
+				"admissionRate", info.AdmissionRate,
+			)
+			pipe.Expire(ctx, key, voucherMetaTTL)
+			return nil
+		})
+		return nil, err
+	})
+	return err
+}
+
+// invalidateVoucherMeta 秒杀券被修改后删除元数据缓存，下次秒杀时重新加载
+func invalidateVoucherMeta(ctx context.Context, rdb *redis.Client, voucherID int64) error {
+	return rdb.Del(ctx, fmt.Sprintf(voucherMetaKeyFmt, voucherID)).Err()
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	waitingRoomKeyFmt   = "seckill:room:vid:%d"        // 等候室发号与放行进度（Hash）
+	waitingTicketKeyFmt = "seckill:room:ticket:vid:%d" // 用户排队号（Hash：userId -> 排队号）
+)
+
+//go:embed seckill_waiting_room.lua
+var waitingRoomLuaSource string
+
+var waitingRoomLua = redis.NewScript(waitingRoomLuaSource)
+
+var (
+	// ErrNotAdmitted 券开启了等候室，用户未排队或尚未被放行
+	ErrNotAdmitted = errors.New("排队中，请等待放行后再抢购")
+	// ErrWaitingRoomDisabled 券未开启等候室，可直接秒杀
+	ErrWaitingRoomDisabled = errors.New("该券未开启排队，可直接抢购")
+	// ErrWaitingTicketNotFound 用户尚未领取排队号
+	ErrWaitingTicketNotFound = errors.New("尚未排队")
+)
+
+// WaitingTicket 等候室排队进度
+type WaitingTicket struct {
+	VoucherID  int64 `json:"voucherId"`
+	Ticket     int64 `json:"ticket"`     // 排队号，从 1 开始
+	Position   int64 `json:"position"`   // 前方仍在等待的人数（含自己），0 表示已放行
+	Admitted   bool  `json:"admitted"`   // 已放行，可以调用秒杀接口
+	EtaSeconds int64 `json:"etaSeconds"` // 预计还需等待的秒数
+	Rate       int64 `json:"rate"`       // 每秒放行人数
+	SoldOut    bool  `json:"soldOut"`    // 库存已抢完，无需继续等待
+}
+
+// JoinWaitingRoom 领取排队号；同一用户重复领取返回原排队号
+func (s *VoucherOrderService) JoinWaitingRoom(ctx context.Context, voucherID, userID int64) (*WaitingTicket, error) {
+	return s.runWaitingRoom(ctx, "join", voucherID, userID)
+}
+
+// GetWaitingTicket 查询排队进度，供客户端轮询
+func (s *VoucherOrderService) GetWaitingTicket(ctx context.Context, voucherID, userID int64) (*WaitingTicket, error) {
+	return s.runWaitingRoom(ctx, "status", voucherID, userID)
+}
+
+// runWaitingRoom 执行等候室脚本：按券的放行速率推进放行进度，并返回用户的排队号与进度
+func (s *VoucherOrderService) runWaitingRoom(ctx context.Context, op string, voucherID, userID int64) (*WaitingTicket, error) {
+	keys := []string{
+		fmt.Sprintf(voucherMetaKeyFmt, voucherID),
+		fmt.Sprintf(waitingRoomKeyFmt, voucherID),
+		fmt.Sprintf(waitingTicketKeyFmt, voucherID),
+		fmt.Sprintf(stockKeyFmt, voucherID),
+	}
+	var res []int64
+	for attempt := 0; ; attempt++ {
+		now := time.Now().UnixMilli()
+		var err error
+		res, err = waitingRoomLua.Run(ctx, s.rdb, keys, op, userID, now).Int64Slice()
+		if err != nil {
+			return nil, err
+		}
+		if res[0] != 9 || attempt > 0 {
+			break
+		}
+		if err := s.loadVoucherMeta(ctx, voucherID); err != nil {
+			return nil, err
+		}
+	}
+
+	switch res[0] {
+	case 0:
+		return newWaitingTicket(voucherID, res[1], res[2], res[3], res[4], res[5], time.Now()), nil
+	case 3:
+		return nil, errors.New("优惠券不存在")
+	case 4:
+		return nil, errors.New("优惠券已下架或过期")
+	case 6:
+		return nil, errors.New("秒杀已结束")
+	case 8:
+		return nil, ErrWaitingRoomDisabled
+	case 10:
+		return nil, ErrWaitingTicketNotFound
+	default:
+		return nil, errors.New("排队失败")
+	}
+}
+
+// newWaitingTicket 根据排队号与放行进度计算位置与预计等待时间；未开始时加上距开始的时间
+func newWaitingTicket(voucherID, ticket, admitted, rate, beginAt, stock int64, now time.Time) *WaitingTicket {
+	t := &WaitingTicket{
+		VoucherID: voucherID,
+		Ticket:    ticket,
+		Rate:      rate,
+		SoldOut:   stock <= 0,
+	}
+	if ticket <= admitted {
+		t.Admitted = true
+		return t
+	}
+	t.Position = ticket - admitted
+	eta := time.Duration(math.Ceil(float64(t.Position)/float64(rate)*1000)) * time.Millisecond
+	if wait := time.UnixMilli(beginAt).Sub(now); wait > 0 {
+		eta += wait
+	}
+	t.EtaSeconds = int64(math.Ceil(eta.Seconds()))
+	return t
+}
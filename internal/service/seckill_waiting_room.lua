@@ -0,0 +1,72 @@
+-- 秒杀等候室：领取排队号与查询排队进度
+-- KEYS[1] 券元数据 KEYS[2] 等候室（Hash：seq 已发号数，admitted 已放行到的号，ts 放行进度对应的时间）
+-- KEYS[3] 排队号（Hash：userId -> 排队号） KEYS[4] 库存
+-- ARGV[1] join | status ARGV[2] userId ARGV[3] 当前毫秒
+-- 返回 {状态码, 排队号, 已放行到的号, 每秒放行人数, 开始时间, 剩余库存}
+local metaKey = KEYS[1]
+local roomKey = KEYS[2]
+local ticketKey = KEYS[3]
+local stockKey = KEYS[4]
+local op = ARGV[1]
+local userId = ARGV[2]
+local now = tonumber(ARGV[3])
+
+local meta = redis.call("hmget", metaKey, "missing", "status", "beginAt", "endAt", "admissionRate")
+-- 元数据未缓存，由调用方从 DB 加载后重试
+if not meta[1] and not meta[2] then
+  return {9, 0, 0, 0, 0, 0}
+end
+if meta[1] then
+  return {3, 0, 0, 0, 0, 0}
+end
+if tonumber(meta[2]) ~= 1 then
+  return {4, 0, 0, 0, 0, 0}
+end
+local beginAt = tonumber(meta[3])
+local endAt = tonumber(meta[4])
+if now > endAt then
+  return {6, 0, 0, 0, 0, 0}
+end
+local rate = tonumber(meta[5]) or 0
+if rate <= 0 then
+  return {8, 0, 0, 0, 0, 0}
+end
+
+-- 按速率推进放行进度：开始时间之前不放行；排队的人全部放行后不累积额度，避免空闲后突发放行
+local room = redis.call("hmget", roomKey, "seq", "admitted", "ts")
+local seq = tonumber(room[1]) or 0
+local admitted = tonumber(room[2]) or 0
+local ts = math.max(tonumber(room[3]) or 0, beginAt)
+local changed = false
+if now > ts then
+  local n = math.floor((now - ts) * rate / 1000)
+  if n > 0 then
+    if admitted + n >= seq then
+      admitted = seq
+      ts = now
+    else
+      admitted = admitted + n
+      ts = ts + n * 1000 / rate
+    end
+    redis.call("hset", roomKey, "admitted", admitted, "ts", tostring(ts))
+    changed = true
+  end
+end
+
+local ticket = tonumber(redis.call("hget", ticketKey, userId))
+if not ticket then
+  if op ~= "join" then
+    return {10, 0, admitted, rate, beginAt, 0}
+  end
+  -- 发号，同一用户重复领取返回原排队号
+  ticket = redis.call("hincrby", roomKey, "seq", 1)
+  redis.call("hset", ticketKey, userId, ticket)
+  changed = true
+end
+if changed then
+  -- 秒杀结束一小时后清理
+  redis.call("pexpireat", roomKey, endAt + 3600000)
+  redis.call("pexpireat", ticketKey, endAt + 3600000)
+end
+local stock = tonumber(redis.call("get", stockKey)) or 0
+return {0, ticket, admitted, rate, beginAt, stock}
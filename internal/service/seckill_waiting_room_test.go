@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/utils"
+)
+
+func TestNewWaitingTicket(t *testing.T) {
+	now := time.Now()
+	admitted := newWaitingTicket(1, 3, 5, 2, now.Add(-time.Minute).UnixMilli(), 10, now)
+	if !admitted.Admitted || admitted.Position != 0 || admitted.EtaSeconds != 0 {
+		t.Fatalf("expected admitted ticket, got %+v", admitted)
+	}
+	waiting := newWaitingTicket(1, 10, 5, 2, now.Add(-time.Minute).UnixMilli(), 0, now)
+	if waiting.Admitted || waiting.Position != 5 || waiting.EtaSeconds != 3 || !waiting.SoldOut {
+		t.Fatalf("unexpected waiting ticket %+v", waiting)
+	}
+	// 未开始时预计等待包含距开始的时间
+	early := newWaitingTicket(1, 2, 0, 1, now.Add(10*time.Second).UnixMilli(), 10, now)
+	if early.EtaSeconds != 12 {
+		t.Fatalf("expected eta 12s before begin, got %+v", early)
+	}
+}
+
+// TestWaitingRoomAdmitsAtRate 等候室按速率放行，未放行的用户无法秒杀（依赖本地 Redis）
+func TestWaitingRoomAdmitsAtRate(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	voucherID := time.Now().UnixNano() % 1_000_000_000
+	keys := []string{
+		fmt.Sprintf(voucherMetaKeyFmt, voucherID),
+		fmt.Sprintf(waitingRoomKeyFmt, voucherID),
+		fmt.Sprintf(waitingTicketKeyFmt, voucherID),
+		fmt.Sprintf(stockKeyFmt, voucherID),
+		fmt.Sprintf(orderCountKeyFmt, voucherID),
+	}
+	defer rdb.Del(ctx, keys...)
+	now := time.Now()
+	if err := rdb.HSet(ctx, keys[0],
+		"status", 1,
+		"beginAt", now.UnixMilli(),
+		"endAt", now.Add(time.Minute).UnixMilli(),
+		"limit", 1,
+		"payTimeout", 0,
+		"admissionRate", 2,
+	).Err(); err != nil {
+		t.Fatalf("prepare meta: %v", err)
+	}
+	_ = rdb.Set(ctx, keys[3], 10, time.Minute).Err()
+
+	broker := NewMemoryBroker(16)
+	svc := NewVoucherOrderService(nil, rdb,
+		broker.Producer("orders"), broker.Producer("orders-retry"), broker.Producer("orders-dlq"),
+		nil, nil, nil, utils.SMTPConfig{}, config.SeckillConfig{}, nil, newTestLogger(t))
+
+	if _, err := svc.Seckill(ctx, voucherID, 1, 1); !errors.Is(err, ErrNotAdmitted) {
+		t.Fatalf("expected ErrNotAdmitted without ticket, got %v", err)
+	}
+	first, err := svc.JoinWaitingRoom(ctx, voucherID, 1)
+	if err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	second, err := svc.JoinWaitingRoom(ctx, voucherID, 2)
+	if err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	again, _ := svc.JoinWaitingRoom(ctx, voucherID, 1)
+	if first.Ticket != 1 || second.Ticket != 2 || again.Ticket != 1 {
+		t.Fatalf("unexpected tickets %d %d %d", first.Ticket, second.Ticket, again.Ticket)
+	}
+
+	// 2 人/秒：约 500ms 放行 1 人
+	time.Sleep(600 * time.Millisecond)
+	status, err := svc.GetWaitingTicket(ctx, voucherID, 2)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if status.Admitted || status.Position != 1 {
+		t.Fatalf("expected user 2 waiting at position 1, got %+v", status)
+	}
+	if _, err := svc.Seckill(ctx, voucherID, 2, 1); !errors.Is(err, ErrNotAdmitted) {
+		t.Fatalf("expected user 2 not admitted, got %v", err)
+	}
+	if _, err := svc.Seckill(ctx, voucherID, 1, 1); err != nil {
+		t.Fatalf("expected admitted user 1 to seckill, got %v", err)
+	}
+	if _, err := svc.GetWaitingTicket(ctx, voucherID, 3); !errors.Is(err, ErrWaitingTicketNotFound) {
+		t.Fatalf("expected ErrWaitingTicketNotFound, got %v", err)
+	}
+}
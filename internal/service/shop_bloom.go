@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/bloom"
+	"hmdp-backend/internal/model"
+	"hmdp-backend/internal/utils"
+)
+
+const (
+	shopBloomFilterName             = "shop"
+	shopBloomLockKey                = "lock:" + utils.SHOP_BLOOM_KEY // 重建锁，多实例同一时刻只有一个实例重建
+	shopBloomLockTTL                = 10 * time.Minute
+	shopBloomBuildKeyTTL            = time.Hour // 临时 key 的过期时间，重建中断时自动清理
+	shopBloomBatchSize              = 1000
+	shopBloomMetricsInterval        = time.Minute
+	defaultShopBloomRebuildInterval = 6 * time.Hour
+)
+
+// ErrBloomRebuildRunning 其他实例或请求正在重建布隆过滤器
+var ErrBloomRebuildRunning = errors.New("布隆过滤器正在重建，请稍后再试")
+
+// BloomStats 布隆过滤器状态，重建时附带写入的元素数与耗时
+type BloomStats struct {
+	bloom.Stats
+	Items      int64 `json:"items,omitempty"` // 本次重建写入的元素数，仅重建时返回
+	DurationMs int64 `json:"durationMs,omitempty"`
+}
+
+// runShopBloomWorker 启动时布隆过滤器不存在则全量预热，之后定期重建并刷新指标
+func (s *ShopService) runShopBloomWorker(ctx context.Context) {
+	exists, err := s.bloom.Exists(ctx)
+	if err != nil {
+		s.log.Warn("check shop bloom failed", zap.Error(err))
+	}
+	if err == nil && !exists {
+		s.rebuildShopBloomInBackground(ctx, "preheat")
+	}
+
+	var rebuildC <-chan time.Time
+	if s.bloomRebuildInterval > 0 {
+		rebuildTicker := time.NewTicker(s.bloomRebuildInterval)
+		defer rebuildTicker.Stop()
+		rebuildC = rebuildTicker.C
+	}
+	metricsTicker := time.NewTicker(shopBloomMetricsInterval)
+	defer metricsTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rebuildC:
+			s.rebuildShopBloomInBackground(ctx, "scheduled")
+		case <-metricsTicker.C:
+			if _, err := s.ShopBloomStats(ctx); err != nil {
+				s.log.Warn("refresh shop bloom stats failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// rebuildShopBloomInBackground 后台任务中重建，已有实例在重建时跳过
+func (s *ShopService) rebuildShopBloomInBackground(ctx context.Context, reason string) {
+	stats, err := s.RebuildShopBloom(ctx)
+	if errors.Is(err, ErrBloomRebuildRunning) {
+		return
+	}
+	if err != nil {
+		s.log.Error("rebuild shop bloom failed", zap.String("reason", reason), zap.Error(err))
+		return
+	}
+	s.log.Info("shop bloom rebuilt",
+		zap.String("reason", reason),
+		zap.Int64("items", stats.Items),
+		zap.Float64("fillRatio", stats.FillRatio),
+		zap.Float64("estimatedFpr", stats.EstimatedFPR),
+		zap.Int64("durationMs", stats.DurationMs),
+	)
+}
+
+// RebuildShopBloom 从 MySQL 按 ID 分批读取全部商铺写入新的临时 key，完成后 RENAME 原子替换线上布隆过滤器，
+// 已删除商铺的 ID 随旧 key 一起丢弃。替换后补写重建期间新增的商铺（ID 大于已读取的最大 ID），
+// 新增商铺在替换前写入旧 key 的部分由此补齐
+func (s *ShopService) RebuildShopBloom(ctx context.Context) (*BloomStats, error) {
+	start := time.Now()
+	lock := utils.NewRedisLock(s.rdb, shopBloomLockKey, shopBloomLockTTL)
+	locked, err := lock.TryLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrBloomRebuildRunning
+	}
+	// 重建超过锁 TTL 时锁可能已被其他实例持有，按 token 释放不会删除别人的锁
+	defer func() {
+		if err := lock.Unlock(context.WithoutCancel(ctx)); err != nil {
+			s.log.Warn("release shop bloom lock failed", zap.Error(err))
+		}
+	}()
+
+	stats, err := s.rebuildShopBloom(ctx)
+	if err != nil {
+		s.metrics.ObserveBloomRebuild(shopBloomFilterName, "error", 0)
+		return nil, err
+	}
+	stats.DurationMs = time.Since(start).Milliseconds()
+	s.metrics.ObserveBloomRebuild(shopBloomFilterName, "success", stats.Items)
+	return stats, nil
+}
+
+func (s *ShopService) rebuildShopBloom(ctx context.Context) (*BloomStats, error) {
+	build := s.bloom.WithKey(s.bloom.Key() + ":build:" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	// 先分配完整的位数组，没有商铺时也能替换成空过滤器
+	if err := build.Reserve(ctx, shopBloomBuildKeyTTL); err != nil {
+		return nil, err
+	}
+
+	var lastID, items int64
+	for {
+		ids, err := s.shopIDsAfter(ctx, lastID, shopBloomBatchSize)
+		if err != nil {
+			s.rdb.Del(context.WithoutCancel(ctx), build.Key())
+			return nil, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if err := build.Add(ctx, formatIDs(ids)...); err != nil {
+			s.rdb.Del(context.WithoutCancel(ctx), build.Key())
+			return nil, err
+		}
+		items += int64(len(ids))
+		lastID = ids[len(ids)-1]
+	}
+
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Rename(ctx, build.Key(), s.bloom.Key())
+		pipe.Persist(ctx, s.bloom.Key())
+		return nil
+	})
+	if err != nil {
+		s.rdb.Del(context.WithoutCancel(ctx), build.Key())
+		return nil, err
+	}
+
+	// 补写重建期间新增的商铺
+	for {
+		ids, err := s.shopIDsAfter(ctx, lastID, shopBloomBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if err := s.bloom.Add(ctx, formatIDs(ids)...); err != nil {
+			return nil, err
+		}
+		items += int64(len(ids))
+		lastID = ids[len(ids)-1]
+	}
+
+	stats, err := s.ShopBloomStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.Items = items
+	return stats, nil
+}
+
+// ShopBloomStats 统计线上布隆过滤器的置位比例与估算误判率，并更新指标
+func (s *ShopService) ShopBloomStats(ctx context.Context) (*BloomStats, error) {
+	stats, err := s.bloom.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.metrics.ObserveBloom(shopBloomFilterName, stats.FillRatio, stats.EstimatedFPR)
+	return &BloomStats{Stats: *stats}, nil
+}
+
+// shopIDsAfter 按 ID 升序读取一批商铺 ID
+func (s *ShopService) shopIDsAfter(ctx context.Context, lastID int64, limit int) ([]int64, error) {
+	var ids []int64
+	err := s.db.WithContext(ctx).Model(&model.Shop{}).
+		Where("id > ?", lastID).
+		Order("id ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// formatIDs 将 ID 转为布隆过滤器的元素
+func formatIDs(ids []int64) []string {
+	res := make([]string, len(ids))
+	for i, id := range ids {
+		res[i] = strconv.FormatInt(id, 10)
+	}
+	return res
+}
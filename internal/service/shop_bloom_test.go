@@ -0,0 +1,29 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/bloom"
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/utils"
+)
+
+// TestShopBloomSizedFromConfig 商铺布隆过滤器按配置的容量与误判率计算位数与哈希个数
+func TestShopBloomSizedFromConfig(t *testing.T) {
+	cfg := config.ShopCacheConfig{Bloom: config.BloomConfig{ExpectedItems: 1000000, FalsePositiveRate: 0.001}}
+	svc := NewShopService(nil, nil, nil, nil, nil, nil, utils.SMTPConfig{}, cfg, nil, nil, zap.NewNop())
+
+	m, k := bloom.OptimalParams(1000000, 0.001)
+	if svc.bloom.Bits() != m || svc.bloom.Hashes() != k {
+		t.Fatalf("expected m=%d k=%d, got m=%d k=%d", m, k, svc.bloom.Bits(), svc.bloom.Hashes())
+	}
+	if !strings.HasPrefix(svc.bloom.Key(), utils.SHOP_BLOOM_KEY+":") {
+		t.Fatalf("unexpected bloom key %s", svc.bloom.Key())
+	}
+	if ids := formatIDs([]int64{1, 23}); len(ids) != 2 || ids[0] != "1" || ids[1] != "23" {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+}
@@ -5,24 +5,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"hash/fnv"
 	"strconv"
 	"time"
 
 	"github.com/allegro/bigcache/v3"
 	"github.com/redis/go-redis/v9"
-	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
+	"hmdp-backend/internal/bloom"
+	"hmdp-backend/internal/cache"
 	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/lifecycle"
 	"hmdp-backend/internal/model"
+	"hmdp-backend/internal/observability"
 	"hmdp-backend/internal/utils"
 )
 
-const lockRetryDelay = 50 * time.Millisecond // 拿不到互斥锁时的短暂休眠时间，避免热点击穿
-const shopBloomSize = 1 << 20                // 约 1M 位布隆过滤器
-var shopBloomSeeds = []uint32{17, 29, 37}    // 多哈希种子（相当于多哈希函数）- 每个ID会设置3个bit
 const defaultLocalShopCacheTTL = 30 * time.Second
 const defaultShopCacheDeleteRetryCount = 3
 const defaultShopCacheDeleteRetryDelay = 20 * time.Millisecond
@@ -36,32 +35,42 @@ type cacheInvalidateMessage struct {
 
 // ShopService 处理商铺相关业务逻辑
 type ShopService struct {
-	db                 *gorm.DB
-	rdb                *redis.Client
-	log                *zap.Logger
-	localCache         *bigcache.BigCache
-	cacheWriter        *kafka.Writer
-	cacheDLQWriter     *kafka.Writer
-	cacheReader        *kafka.Reader
-	cacheDLQReader     *kafka.Reader
-	smtpCfg            utils.SMTPConfig
-	deleteRetryCount   int
-	deleteRetryDelay   time.Duration
+	db               *gorm.DB
+	rdb              *redis.Client
+	log              *zap.Logger
+	localCache       *bigcache.BigCache
+	cache            *cache.Client[model.Shop]
+	bloom            *bloom.Filter
+	cacheProducer    Producer
+	cacheDLQProducer Producer
+	cacheConsumer    Consumer
+	cacheDLQConsumer Consumer
+	smtpCfg          utils.SMTPConfig
+	deleteRetryCount int
+	deleteRetryDelay time.Duration
+	// 布隆过滤器定期重建间隔，<= 0 时只在启动时预热
+	bloomRebuildInterval time.Duration
+	metrics              *observability.CacheMetrics
 }
 
 // NewShopService 创建 ShopService 实例
 func NewShopService(
 	db *gorm.DB,
 	rdb *redis.Client,
-	cacheWriter *kafka.Writer,
-	cacheDLQWriter *kafka.Writer,
-	cacheReader *kafka.Reader,
-	cacheDLQReader *kafka.Reader,
+	cacheProducer Producer,
+	cacheDLQProducer Producer,
+	cacheConsumer Consumer,
+	cacheDLQConsumer Consumer,
 	smtpCfg utils.SMTPConfig,
 	cfg config.ShopCacheConfig,
+	invalidator *cache.Invalidator,
+	metrics *observability.CacheMetrics,
 	log *zap.Logger,
 ) *ShopService {
-	cache := initShopLocalCache(cfg.LocalTTL, log)
+	if log == nil {
+		log = zap.NewNop()
+	}
+	localCache := initShopLocalCache(cfg.LocalTTL, log)
 	retryCount := cfg.DeleteRetryCount
 	if retryCount <= 0 {
 		retryCount = defaultShopCacheDeleteRetryCount
@@ -70,97 +79,67 @@ func NewShopService(
 	if retryDelay <= 0 {
 		retryDelay = defaultShopCacheDeleteRetryDelay
 	}
-	svc := &ShopService{
-		db:                 db,
-		rdb:                rdb,
-		log:                log,
-		localCache:         cache,
-		cacheWriter:        cacheWriter,
-		cacheDLQWriter:     cacheDLQWriter,
-		cacheReader:        cacheReader,
-		cacheDLQReader:     cacheDLQReader,
-		smtpCfg:            smtpCfg,
-		deleteRetryCount:   retryCount,
-		deleteRetryDelay:   retryDelay,
+	bloomRebuildInterval := cfg.BloomRebuildInterval
+	if bloomRebuildInterval == 0 {
+		bloomRebuildInterval = defaultShopBloomRebuildInterval
 	}
+	svc := &ShopService{
+		db:               db,
+		rdb:              rdb,
+		log:              log,
+		localCache:       localCache,
+		cacheProducer:    cacheProducer,
+		cacheDLQProducer: cacheDLQProducer,
+		cacheConsumer:    cacheConsumer,
+		cacheDLQConsumer: cacheDLQConsumer,
+		smtpCfg:          smtpCfg,
+		deleteRetryCount: retryCount,
+		deleteRetryDelay: retryDelay,
+
+		bloom: bloom.New(rdb, bloom.Options{
+			Key:               utils.SHOP_BLOOM_KEY,
+			ExpectedItems:     cfg.Bloom.ExpectedItems,
+			FalsePositiveRate: cfg.Bloom.FalsePositiveRate,
+		}),
+		bloomRebuildInterval: bloomRebuildInterval,
+		metrics:              metrics,
+	}
+	svc.cache = cache.New(rdb, localCache, cache.Options[model.Shop]{
+		Name:       "shop",
+		KeyPrefix:  utils.CACHE_SHOP_KEY,
+		LockPrefix: utils.LOCK_SHOP_KEY,
+		TTL:        time.Duration(utils.CACHE_SHOP_TTL) * time.Minute,
+		LockTTL:    time.Duration(utils.LOCK_SHOP_TTL) * time.Second,
+		NullTTL:    time.Duration(utils.CACHE_NULL_TTL) * time.Minute, // 不存在的商铺缓存空值，布隆误判或关闭时也不会每次穿透到 MySQL
+		Loader:     svc.loadShop,
+		// 修改商铺后通知所有实例删除本地缓存
+		Invalidator: invalidator,
+	}, log)
+	return svc
+}
+
+// Start 将缓存补偿消费者交给生命周期管理器
+func (s *ShopService) Start(lc *lifecycle.Manager) {
 	// 启动缓存补偿消费者协程
-	if svc.cacheReader != nil {
-		go svc.consumeCacheInvalidations(context.Background())
+	if s.cacheConsumer != nil {
+		lc.Go("consumeCacheInvalidations", s.consumeCacheInvalidations)
 	}
 	// 启动缓存补偿死信消费者协程
-	if svc.cacheDLQReader != nil {
-		go svc.consumeCacheInvalidateDLQ(context.Background())
+	if s.cacheDLQConsumer != nil {
+		lc.Go("consumeCacheInvalidateDLQ", s.consumeCacheInvalidateDLQ)
 	}
-	return svc
+	// 布隆过滤器启动预热与定期重建
+	lc.Go("runShopBloomWorker", s.runShopBloomWorker)
 }
 
 // GetByIDWithMutex 根据id查询热点商铺信息
-// 使用互斥锁解决热点Key缓存击穿问题
+// 使用互斥锁解决热点Key缓存击穿问题：本地缓存 -> Redis -> 拿到锁的请求查询数据库并回填
 func (s *ShopService) GetByIDWithMutex(ctx context.Context, id int64) (*model.Shop, error) {
-	key := utils.CACHE_SHOP_KEY + strconv.FormatInt(id, 10)
-	lockKey := utils.LOCK_SHOP_KEY + strconv.FormatInt(id, 10)
-
-	// 从本地缓存查询
-	if shop, ok := s.getLocalShop(key); ok {
-		if s.log != nil {
-			s.log.Info("shop cache hit (local)", zap.Int64("shopId", id))
-		}
-		return shop, nil
-	}
-
-	for {
-		// 1.从 Redis 查询商铺缓存 - 缓存命中
-		cached, err := s.rdb.Get(ctx, key).Result()
-		// err为空 说明查询到了缓存
-		if err == nil {
-			var shop model.Shop
-			if unmarshalErr := json.Unmarshal([]byte(cached), &shop); unmarshalErr != nil {
-				return nil, unmarshalErr
-			}
-			// 设置本地缓存
-			s.setLocalShop(key, []byte(cached))
-			return &shop, nil
-		}
-		// 如果err不是redis.Nil，说明是其他错误，直接返回
-		if !errors.Is(err, redis.Nil) {
-			return nil, err
-		}
-
-		// 2.缓存未命中，尝试获取互斥锁；若失败则短暂休眠后重试，避免热点 Key 的缓存击穿
-		locked, lockErr := s.tryLock(ctx, lockKey)
-		if lockErr != nil {
-			return nil, lockErr
-		}
-		// 获取锁失败，继续循环等待
-		if !locked {
-			time.Sleep(lockRetryDelay)
-			continue
-		}
-		// DoubleCheck 拿到锁后再次查询缓存：先查本地，再查 Redis，避免重复查询数据库和写缓存
-		if shop, ok := s.getLocalShop(key); ok {
-			_ = s.unlock(ctx, lockKey)
-			return shop, nil
-		}
-		cached, err = s.rdb.Get(ctx, key).Result()
-		if err == nil {
-			var shop model.Shop
-			if unmarshalErr := json.Unmarshal([]byte(cached), &shop); unmarshalErr != nil {
-				return nil, unmarshalErr
-			}
-			s.setLocalShop(key, []byte(cached))
-			_ = s.unlock(ctx, lockKey)
-			return &shop, nil
-		}
-		if !errors.Is(err, redis.Nil) {
-			_ = s.unlock(ctx, lockKey)
-			return nil, err
-		}
-
-		// 3.成功获取锁且缓存仍未构建，查询数据库并回填缓存，最后释放互斥锁
-		shop, loadErr := s.loadShopAndCache(ctx, id, key)
-		_ = s.unlock(ctx, lockKey)
-		return shop, loadErr
+	shop, err := s.cache.GetWithMutex(ctx, strconv.FormatInt(id, 10))
+	if errors.Is(err, cache.ErrNotFound) {
+		return nil, errors.New("shop not found")
 	}
+	return shop, err
 }
 
 // GetByIDWithLogicalExpire 根据id查询热点商铺信息
@@ -168,71 +147,19 @@ func (s *ShopService) GetByIDWithMutex(ctx context.Context, id int64) (*model.Sh
 
 // 逻辑过期前提是：Redis 里必须有旧值可以返回
 // 启动或定时预先将热点数据加载到 Redis，并设置逻辑过期时间
-// 自动兜底方案：也可以在未命中时查询数据库并写入逻辑过期缓存
+// 已过期时返回旧数据，由拿到锁的请求异步重建；未预热时返回空
 func (s *ShopService) GetByIDWithLogicalExpire(ctx context.Context, id int64) (*model.Shop, error) {
-	key := utils.CACHE_SHOP_KEY + strconv.FormatInt(id, 10)
-	lockKey := utils.LOCK_SHOP_KEY + strconv.FormatInt(id, 10)
-
-	// 1.从 Redis 查询缓存，未命中则直接返回空
-	cached, err := s.rdb.Get(ctx, key).Result()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return nil, nil
-		}
-		return nil, err
-	}
-	if cached == "" {
+	shop, err := s.cache.GetWithLogicalExpire(ctx, strconv.FormatInt(id, 10))
+	if errors.Is(err, cache.ErrNotFound) {
 		return nil, nil
 	}
-
-	// 2.反序列化逻辑过期包装数据
-	var redisData utils.RedisData
-	// 先将redis中数据反序列化为redisData
-	if unmarshalErr := json.Unmarshal([]byte(cached), &redisData); unmarshalErr != nil {
-		return nil, unmarshalErr
-	}
-	// redisData.Data 是 interface{}，先二次序列化为 JSON 再反序列化成 Shop
-	dataBytes, marshalErr := json.Marshal(redisData.Data)
-	if marshalErr != nil {
-		return nil, marshalErr
-	}
-	var shop model.Shop
-	// 将通用 data 还原为具体的 Shop 结构
-	if unmarshalErr := json.Unmarshal(dataBytes, &shop); unmarshalErr != nil {
-		return nil, unmarshalErr
-	}
-
-	// 3.未过期，直接返回商铺信息
-	if redisData.ExpireTime.After(time.Now()) {
-		return &shop, nil
-	}
-
-	// 4.已过期：尝试获取互斥锁，获取失败直接返回旧数据
-	locked, lockErr := s.tryLock(ctx, lockKey)
-	if lockErr != nil {
-		return nil, lockErr
-	}
-	// 失败 直接返回redis中的旧数据
-	if !locked {
-		return &shop, nil
-	}
-
-	// 5.获取锁成功：异步重建缓存，避免阻塞当前请求
-	go func() {
-		defer func() {
-			_ = s.unlock(context.Background(), lockKey)
-		}()
-		_ = s.rebuildShopCacheWithLogicalExpire(id, key)
-	}()
-	// 先返回旧数据
-	return &shop, nil
+	return shop, err
 }
 
 // GetByIDWithBloom 使用布隆过滤器先拦截不存在的 ID，降低缓存穿透风险
 // Bloom 判定“可能存在”才继续后续缓存/数据库流程；判定“不存在”直接返回 nil
 func (s *ShopService) GetByIDWithBloom(ctx context.Context, id int64) (*model.Shop, error) {
-	bloomKey := utils.SHOP_BLOOM_KEY
-	maybe, err := s.bloomMightContain(ctx, bloomKey, id)
+	maybe, err := s.bloom.MightContain(ctx, strconv.FormatInt(id, 10))
 	if err != nil {
 		return nil, err
 	}
@@ -248,41 +175,21 @@ func (s *ShopService) GetByIDWithBloom(ctx context.Context, id int64) (*model.Sh
 	return shop, nil
 }
 
-// loadShopAndCache 查询数据库并将结果写入 Redis，配合互斥锁使用
-func (s *ShopService) loadShopAndCache(ctx context.Context, id int64, key string) (*model.Shop, error) {
-	var shop model.Shop
-	err := s.db.WithContext(ctx).First(&shop, id).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, errors.New("shop not found")
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	data, err := json.Marshal(&shop)
+// loadShop 缓存回源：从数据库查询商铺
+func (s *ShopService) loadShop(ctx context.Context, id string) (*model.Shop, error) {
+	shopID, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
 		return nil, err
 	}
-	// 使用string类型缓存商铺信息 添加上过期时间
-	if err := s.rdb.Set(ctx, key, data, time.Duration(utils.CACHE_SHOP_TTL)*time.Minute).Err(); err != nil {
-		return nil, err
-	}
-	// 设置本地缓存
-	s.setLocalShop(key, data)
-	return &shop, nil
-}
-
-// rebuildShopCacheWithLogicalExpire 查询数据库并写入逻辑过期缓存
-func (s *ShopService) rebuildShopCacheWithLogicalExpire(id int64, key string) error {
 	var shop model.Shop
-	err := s.db.WithContext(context.Background()).First(&shop, id).Error
+	err = s.db.WithContext(ctx).First(&shop, shopID).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil
+		return nil, cache.ErrNotFound
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return s.saveShopWithLogicalExpire(key, &shop, time.Duration(utils.CACHE_SHOP_TTL)*time.Minute)
+	return &shop, nil
 }
 
 // saveShopWithLogicalExpire 将数据和逻辑过期时间一起写入 Redis
@@ -298,19 +205,21 @@ func (s *ShopService) saveShopWithLogicalExpire(key string, shop *model.Shop, tt
 	return s.rdb.Set(context.Background(), key, data, 0).Err()
 }
 
-// tryLock 尝试获取锁
-func (s *ShopService) tryLock(ctx context.Context, key string) (bool, error) {
-	// 利用 Redis SETNX 实现简单互斥锁，并设置 TTL 防止死锁
-	return s.rdb.SetNX(ctx, key, "1", time.Duration(utils.LOCK_SHOP_TTL)*time.Second).Result()
-}
-
-// unlock 释放锁
-func (s *ShopService) unlock(ctx context.Context, key string) error {
-	return s.rdb.Del(ctx, key).Err()
-}
-
+// Create 新增商铺，成功后写入布隆过滤器，并清理该 ID 可能存在的空值缓存
 func (s *ShopService) Create(ctx context.Context, shop *model.Shop) error {
-	return s.db.WithContext(ctx).Create(shop).Error
+	if err := s.db.WithContext(ctx).Create(shop).Error; err != nil {
+		return err
+	}
+	// 布隆过滤器未预热时 Add 不写入，预热会从 MySQL 全量读取
+	if err := s.bloom.Add(ctx, strconv.FormatInt(shop.ID, 10)); err != nil && s.log != nil {
+		// 写入失败时新商铺会被布隆拦截，直到下次重建
+		s.log.Error("shop bloom add failed", zap.Int64("shopId", shop.ID), zap.Error(err))
+	}
+	if err := s.cache.Delete(ctx, strconv.FormatInt(shop.ID, 10)); err != nil && s.log != nil {
+		// 空值缓存很快过期，删除失败不影响新增结果
+		s.log.Warn("shop null cache delete failed", zap.Int64("shopId", shop.ID), zap.Error(err))
+	}
+	return nil
 }
 
 // Update 更新商铺信息
@@ -319,24 +228,24 @@ func (s *ShopService) Update(ctx context.Context, shop *model.Shop) error {
 		return errors.New("invalid shop id")
 	}
 	key := utils.CACHE_SHOP_KEY + strconv.FormatInt(shop.ID, 10)
-	// 通过事务保证先更新数据库再删除缓存，出现错误时整体回滚
-	// 更新操作 先更新数据库 删除redis缓存 保证redis和数据库数据一致性
-	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	// 先更新数据库再删除缓存：删除与广播放在事务提交之后，避免并发读在提交前把旧值重新写回缓存
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// 使用 Updates 忽略零值字段，避免覆盖 create_time 等只读列
-		if err := tx.Model(&model.Shop{ID: shop.ID}).Updates(shop).Error; err != nil {
-			return err
-		}
-		// 先删一次缓存，降低并发读命中旧值的窗口；失败时走补偿通道
-		if err := s.deleteShopCacheWithRetry(ctx, key); err != nil {
-			if s.log != nil {
-				s.log.Warn("shop cache delete failed, enqueue compensate", zap.Int64("shopId", shop.ID), zap.Error(err))
-			}
-			// 发布缓存失效消息
-			_ = s.publishCacheInvalidate(ctx, shop.ID, key, err)
-		}
-		s.deleteLocalShop(key)
-		return nil
+		return tx.Model(&model.Shop{ID: shop.ID}).Updates(shop).Error
 	})
+	if err != nil {
+		return err
+	}
+	// 删除 Redis 缓存，失败时走补偿通道
+	if err := s.deleteShopCacheWithRetry(ctx, key); err != nil {
+		if s.log != nil {
+			s.log.Warn("shop cache delete failed, enqueue compensate", zap.Int64("shopId", shop.ID), zap.Error(err))
+		}
+		// 发布缓存失效消息
+		_ = s.publishCacheInvalidate(ctx, shop.ID, key, err)
+	}
+	s.deleteLocalShop(ctx, key)
+	return nil
 }
 
 func (s *ShopService) QueryByType(ctx context.Context, typeID int64, page, size int) ([]model.Shop, error) {
@@ -368,52 +277,6 @@ func (s *ShopService) QueryByName(ctx context.Context, name string, page, size i
 	return shops, err
 }
 
-// bloomMightContain 检查布隆过滤器是否可能包含该 ID
-func (s *ShopService) bloomMightContain(ctx context.Context, key string, id int64) (bool, error) {
-	// 获取该id对应的多个位偏移
-	offsets := bloomOffsets(id)
-	// 检查这些偏移位是否都为1
-	for _, off := range offsets {
-		bit, err := s.rdb.GetBit(ctx, key, int64(off)).Result()
-		if err != nil {
-			return false, err
-		}
-		if bit == 0 {
-			return false, nil
-		}
-	}
-	return true, nil
-}
-
-// bloomAdd 将 ID 写入布隆过滤器
-func (s *ShopService) bloomAdd(ctx context.Context, key string, id int64) error {
-	offsets := bloomOffsets(id)
-	// 使用管道批量写位 减少往返
-	pipe := s.rdb.Pipeline()
-	for _, off := range offsets {
-		// 将对应偏移的位设置为1
-		pipe.SetBit(ctx, key, int64(off), 1)
-	}
-	// 提交管道命令
-	_, err := pipe.Exec(ctx)
-	return err
-}
-
-// bloomOffsets 生成布隆过滤器位偏移
-func bloomOffsets(id int64) []uint32 {
-	res := make([]uint32, 0, len(shopBloomSeeds))
-	// 遍历每个哈希种子 生成多组哈希
-	for _, seed := range shopBloomSeeds {
-		// 创建 FNV-1a 哈希算法实例
-		h := fnv.New32a()
-		// 将id转为字符串写入哈希计算
-		_, _ = h.Write([]byte(strconv.FormatInt(id, 10)))
-		// 返回哈希值加上种子后的偏移位置
-		sum := h.Sum32() + seed
-		res = append(res, sum%shopBloomSize)
-	}
-	return res
-}
 // initShopLocalCache 初始化本地缓存
 func initShopLocalCache(ttl time.Duration, log *zap.Logger) *bigcache.BigCache {
 	// 设置本地缓存的默认 TTL，并使用清理窗口控制过期扫描频率
@@ -432,38 +295,13 @@ func initShopLocalCache(ttl time.Duration, log *zap.Logger) *bigcache.BigCache {
 	}
 	return cache
 }
-// getLocalShop 从本地缓存获取店铺信息
-func (s *ShopService) getLocalShop(key string) (*model.Shop, bool) {
-	if s.localCache == nil {
-		return nil, false
-	}
-	data, err := s.localCache.Get(key)
-	if err != nil {
-		return nil, false
-	}
-	var shop model.Shop
-	if unmarshalErr := json.Unmarshal(data, &shop); unmarshalErr != nil {
-		s.localCache.Delete(key)
-		return nil, false
-	}
-	return &shop, true
-}
-// setLocalShop 将店铺信息存入本地缓存
-func (s *ShopService) setLocalShop(key string, data []byte) {
-	if s.localCache == nil || len(data) == 0 {
-		return
-	}
-	_ = s.localCache.Set(key, data)
-	if s.log != nil {
-		s.log.Info("shop cache set (local)", zap.String("key", key))
-	}
-}
-// deleteLocalShop 从本地缓存删除店铺信息
-func (s *ShopService) deleteLocalShop(key string) {
+
+// deleteLocalShop 删除本机缓存中的店铺信息，并通过 Redis pub/sub 通知其他实例删除各自的副本
+func (s *ShopService) deleteLocalShop(ctx context.Context, key string) {
 	if s.localCache == nil {
 		return
 	}
-	s.localCache.Delete(key)
+	s.cache.InvalidateLocal(ctx, key)
 	if s.log != nil {
 		s.log.Info("shop cache delete (local)", zap.String("key", key))
 	}
@@ -486,14 +324,14 @@ func (s *ShopService) deleteShopCacheOnce(ctx context.Context, key string) error
 	if err := s.rdb.Del(ctx, key).Err(); err != nil {
 		return err
 	}
-	s.deleteLocalShop(key)
+	s.deleteLocalShop(ctx, key)
 	return nil
 }
 
 // publishCacheInvalidate 发送缓存补偿消息
 func (s *ShopService) publishCacheInvalidate(ctx context.Context, shopID int64, key string, err error) error {
-	if s.cacheWriter == nil {
-		return errors.New("cache invalidate writer not configured")
+	if s.cacheProducer == nil {
+		return errors.New("cache invalidate producer not configured")
 	}
 	payload := cacheInvalidateMessage{
 		ShopID:    shopID,
@@ -503,34 +341,34 @@ func (s *ShopService) publishCacheInvalidate(ctx context.Context, shopID int64,
 	if err != nil {
 		payload.LastError = err.Error()
 	}
-	data, marshalErr := json.Marshal(payload)
+	data, marshalErr := encodeEnvelope(messageTypeCacheInvalidate, producerShop, "", payload)
 	if marshalErr != nil {
 		return marshalErr
 	}
-	message := kafka.Message{
+	message := Message{
 		Key:   []byte(strconv.FormatInt(shopID, 10)),
 		Value: data,
 	}
-	return s.cacheWriter.WriteMessages(ctx, message)
+	return s.cacheProducer.Publish(ctx, message)
 }
 
 // publishCacheInvalidateDLQ 发送缓存补偿死信
 func (s *ShopService) publishCacheInvalidateDLQ(ctx context.Context, payload cacheInvalidateMessage, err error) error {
-	if s.cacheDLQWriter == nil {
-		return errors.New("cache invalidate dlq writer not configured")
+	if s.cacheDLQProducer == nil {
+		return errors.New("cache invalidate dlq producer not configured")
 	}
 	if err != nil {
 		payload.LastError = err.Error()
 	}
-	data, marshalErr := json.Marshal(payload)
+	data, marshalErr := encodeEnvelope(messageTypeCacheInvalidate, producerShop, "", payload)
 	if marshalErr != nil {
 		return marshalErr
 	}
-	message := kafka.Message{
+	message := Message{
 		Key:   []byte(strconv.FormatInt(payload.ShopID, 10)),
 		Value: data,
 	}
-	return s.cacheDLQWriter.WriteMessages(ctx, message)
+	return s.cacheDLQProducer.Publish(ctx, message)
 }
 
 // consumeCacheInvalidations 消费补偿消息，删除缓存；失败直接进入 DLQ
@@ -539,37 +377,38 @@ func (s *ShopService) consumeCacheInvalidations(ctx context.Context) {
 		s.log.Info("cache invalidate consumer started")
 	}
 	for {
-		msg, err := s.cacheReader.FetchMessage(ctx)
+		msg, err := s.cacheConsumer.Fetch(ctx)
 		if err != nil {
+			if isFetchStopped(ctx, err) {
+				return
+			}
 			if s.log != nil {
 				s.log.Error("cache invalidate fetch error", zap.Error(err))
 			}
-			time.Sleep(time.Second)
-			continue
-		}
-		var payload cacheInvalidateMessage
-		if err := json.Unmarshal(msg.Value, &payload); err != nil {
-			if s.log != nil {
-				s.log.Error("cache invalidate parse error", zap.Error(err))
+			if !lifecycle.Sleep(ctx, time.Second) {
+				return
 			}
-			_ = s.cacheReader.CommitMessages(ctx, msg)
 			continue
 		}
-		if payload.CacheKey == "" {
-			if s.log != nil {
-				s.log.Warn("cache invalidate missing key", zap.Int64("shopId", payload.ShopID))
+		// 已拉取的消息在停机时也要处理完并提交 offset
+		msgCtx := context.WithoutCancel(ctx)
+		payload, _, err := decodeCacheInvalidateMessage(msg.Value)
+		if err != nil {
+			// 无法解码的消息转入死信，投递成功后再提交
+			if !s.sendPoisonToCacheDLQ(ctx, msgCtx, msg, err) {
+				return
 			}
-			_ = s.cacheReader.CommitMessages(ctx, msg)
+			_ = s.cacheConsumer.Commit(msgCtx, msg)
 			continue
 		}
-		if err := s.deleteShopCacheOnce(ctx, payload.CacheKey); err != nil {
+		if err := s.deleteShopCacheOnce(msgCtx, payload.CacheKey); err != nil {
 			if s.log != nil {
 				s.log.Error("cache invalidate delete failed", zap.Int64("shopId", payload.ShopID), zap.Error(err))
 			}
 			// 失败直接进入死信队列
-			_ = s.publishCacheInvalidateDLQ(ctx, payload, err)
+			_ = s.publishCacheInvalidateDLQ(msgCtx, payload, err)
 		}
-		if err := s.cacheReader.CommitMessages(ctx, msg); err != nil && s.log != nil {
+		if err := s.cacheConsumer.Commit(msgCtx, msg); err != nil && s.log != nil {
 			s.log.Error("cache invalidate commit error", zap.Error(err))
 		}
 	}
@@ -581,20 +420,26 @@ func (s *ShopService) consumeCacheInvalidateDLQ(ctx context.Context) {
 		s.log.Info("cache invalidate dlq consumer started")
 	}
 	for {
-		msg, err := s.cacheDLQReader.FetchMessage(ctx)
+		msg, err := s.cacheDLQConsumer.Fetch(ctx)
 		if err != nil {
+			if isFetchStopped(ctx, err) {
+				return
+			}
 			if s.log != nil {
 				s.log.Error("cache invalidate dlq fetch error", zap.Error(err))
 			}
-			time.Sleep(time.Second)
+			if !lifecycle.Sleep(ctx, time.Second) {
+				return
+			}
 			continue
 		}
-		var payload cacheInvalidateMessage
-		if err := json.Unmarshal(msg.Value, &payload); err != nil {
-			if s.log != nil {
-				s.log.Error("cache invalidate dlq parse error", zap.Error(err))
-			}
-			_ = s.cacheDLQReader.CommitMessages(ctx, msg)
+		// 已拉取的消息在停机时也要处理完并提交 offset
+		msgCtx := context.WithoutCancel(ctx)
+		payload, env, err := decodeCacheInvalidateMessage(msg.Value)
+		if err != nil {
+			// 死信是链路终点：毒消息与无法解码的消息告警后提交
+			s.alertCacheInvalidatePoison(msg, env, err)
+			_ = s.cacheDLQConsumer.Commit(msgCtx, msg)
 			continue
 		}
 		if s.smtpCfg.Host != "" {
@@ -612,12 +457,75 @@ func (s *ShopService) consumeCacheInvalidateDLQ(ctx context.Context) {
 		} else if s.log != nil {
 			s.log.Warn("cache invalidate dlq email skipped: smtp not configured", zap.Int64("shopId", payload.ShopID))
 		}
-		if err := s.cacheDLQReader.CommitMessages(ctx, msg); err != nil && s.log != nil {
+		if err := s.cacheDLQConsumer.Commit(msgCtx, msg); err != nil && s.log != nil {
 			s.log.Error("cache invalidate dlq commit error", zap.Error(err))
 		}
 	}
 }
 
+// sendPoisonToCacheDLQ 将无法解码的补偿消息连同原始内容转入补偿死信，投递失败时原地重试；停机时返回 false
+func (s *ShopService) sendPoisonToCacheDLQ(ctx, msgCtx context.Context, msg Message, cause error) bool {
+	if s.log != nil {
+		s.log.Warn("cache invalidate poison message, sending to dlq", zap.String("key", string(msg.Key)), zap.Error(cause))
+	}
+	if s.cacheDLQProducer == nil {
+		if s.log != nil {
+			s.log.Error("cache invalidate poison message dropped: dlq producer not configured")
+		}
+		return true
+	}
+	poisonMsg, err := newPoisonMessage(producerShop, msg, cause)
+	if err != nil {
+		if s.log != nil {
+			s.log.Error("cache invalidate encode poison message error", zap.Error(err))
+		}
+		return true
+	}
+	for {
+		err := s.cacheDLQProducer.Publish(msgCtx, poisonMsg)
+		if err == nil {
+			return true
+		}
+		if s.log != nil {
+			s.log.Error("cache invalidate publish poison message error", zap.Error(err))
+		}
+		if !lifecycle.Sleep(ctx, time.Second) {
+			return false
+		}
+	}
+}
+
+// alertCacheInvalidatePoison 补偿死信中的毒消息告警
+func (s *ShopService) alertCacheInvalidatePoison(msg Message, env Envelope, cause error) {
+	poison, err := decodePoisonMessage(env)
+	if err != nil {
+		// 直接写入死信的无法解码消息
+		poison = poisonMessage{SourceTopic: msg.Topic, Key: string(msg.Key), Value: msg.Value, Error: cause.Error()}
+	}
+	if s.log != nil {
+		s.log.Error("cache invalidate dlq poison message",
+			zap.String("sourceTopic", poison.SourceTopic),
+			zap.String("key", poison.Key),
+			zap.String("error", poison.Error),
+			zap.ByteString("value", poison.Value),
+		)
+	}
+	if s.smtpCfg.Host == "" {
+		return
+	}
+	subject := fmt.Sprintf("[DLQ] undecodable shop cache message from %s", poison.SourceTopic)
+	body := fmt.Sprintf(
+		"缓存补偿消息无法解码，请人工处理。\n\nsourceTopic: %s\nkey: %s\nerror: %s\nvalue: %s\n",
+		poison.SourceTopic,
+		poison.Key,
+		poison.Error,
+		poison.Value,
+	)
+	if err := utils.SendEmail(s.smtpCfg, subject, body); err != nil && s.log != nil {
+		s.log.Error("cache invalidate dlq poison email failed", zap.Error(err))
+	}
+}
+
 // QueryByTypeWithLocation 根据类型 + 坐标查询店铺，按距离排序
 // x、y 为用户经纬度，page/size 用于分页，优先使用 Redis GEO，缺少坐标时可退回 QueryByType。
 func (s *ShopService) QueryByTypeWithLocation(ctx context.Context, typeID int64, page, size int, x, y float64) ([]model.Shop, error) {
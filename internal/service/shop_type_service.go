@@ -2,52 +2,48 @@ package service
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
+	"time"
+
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 
+	"hmdp-backend/internal/cache"
 	"hmdp-backend/internal/model"
 	"hmdp-backend/internal/utils"
 )
 
 type ShopTypeService struct {
-	db  *gorm.DB
-	rdb *redis.Client
+	db    *gorm.DB
+	rdb   *redis.Client
+	cache *cache.Client[[]model.ShopType]
 }
 
 func NewShopTypeService(db *gorm.DB, rdb *redis.Client) *ShopTypeService {
-	return &ShopTypeService{db: db, rdb: rdb}
+	svc := &ShopTypeService{db: db, rdb: rdb}
+	// 类型列表只有一个 key，进程内合并回源即可
+	svc.cache = cache.New(rdb, nil, cache.Options[[]model.ShopType]{
+		Name:      "shop_type",
+		KeyPrefix: utils.CACHE_SHOP_TYPE_KEY,
+		Strategy:  cache.StrategySingleflight,
+		TTL:       time.Duration(utils.CACHE_SHOP_TYPE_TTL) * time.Minute,
+		Loader:    svc.loadTypes,
+	}, nil)
+	return svc
 }
 
 func (s *ShopTypeService) List(ctx context.Context) ([]model.ShopType, error) {
-	key := utils.CACHE_SHOP_TYPE_KEY
-	cached, err := s.rdb.Get(ctx, key).Result()
-	if err == nil {
-		var types []model.ShopType
-		if unmarshalErr := json.Unmarshal([]byte(cached), &types); unmarshalErr != nil {
-			return nil, unmarshalErr
-		}
-		return types, nil
-	}
-	if !errors.Is(err, redis.Nil) {
-		return nil, err
-	}
-
-	var types []model.ShopType
-	err = s.db.WithContext(ctx).
-		Order("sort ASC").
-		Find(&types).Error
+	types, err := s.cache.Get(ctx, "")
 	if err != nil {
 		return nil, err
 	}
+	return *types, nil
+}
 
-	data, err := json.Marshal(types)
-	if err != nil {
+// loadTypes 缓存回源：按 sort 查询全部商铺类型
+func (s *ShopTypeService) loadTypes(ctx context.Context, _ string) (*[]model.ShopType, error) {
+	var types []model.ShopType
+	if err := s.db.WithContext(ctx).Order("sort ASC").Find(&types).Error; err != nil {
 		return nil, err
 	}
-	if cacheErr := s.rdb.Set(ctx, key, data, 0).Err(); cacheErr != nil {
-		return nil, cacheErr
-	}
-	return types, nil
+	return &types, nil
 }
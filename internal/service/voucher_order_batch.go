@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"hmdp-backend/internal/lifecycle"
+	"hmdp-backend/internal/model"
+	"hmdp-backend/internal/observability"
+)
+
+const (
+	defaultConsumeBatchSize = 100
+	defaultConsumeBatchWait = 20 * time.Millisecond
+	consumeErrorBackoff     = 200 * time.Millisecond
+)
+
+// orderDelivery 一条已拉取的订单消息及其消费链路信息
+type orderDelivery struct {
+	index   int // 在所属分区批次中的位置，用于计算可提交的前缀
+	msg     Message
+	payload orderMessage
+	topic   string
+	ctx     context.Context
+	span    trace.Span
+	start   time.Time
+}
+
+// consumeOrders 异步创建订单（Kafka 消费端）
+// 消息按 voucherId 分发到多个 lane，每个 lane 凑批后按分区处理：多行插入订单、按券聚合扣减库存，处理完成后再提交 offset
+func (s *VoucherOrderService) consumeOrders(ctx context.Context) {
+	s.dispatchLoop(ctx, s.consumer, "consumeOrders", s.batchSize, func(ctx, msgCtx context.Context, msgs []Message) []Message {
+		done := make([]Message, 0, len(msgs))
+		for _, group := range groupByPartition(msgs) {
+			n := s.handleOrderBatch(ctx, msgCtx, group)
+			done = append(done, group[:n]...)
+			if n < len(group) {
+				// 仅在停机时出现：未完成的消息不提交，由下一个实例重新消费
+				return done
+			}
+		}
+		return done
+	})
+}
+
+// groupByPartition 按分区拆分批次，保持分区内的拉取顺序
+func groupByPartition(msgs []Message) [][]Message {
+	index := make(map[int]int)
+	var groups [][]Message
+	for _, msg := range msgs {
+		i, ok := index[msg.Partition]
+		if !ok {
+			i = len(groups)
+			index[msg.Partition] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], msg)
+	}
+	return groups
+}
+
+// handleOrderBatch 处理同一分区的一批消息，返回从头开始已处理完成（可提交）的消息数
+// 批量落库失败（重复订单、库存冲突等）时退回逐条处理，逐条处理沿用重试/死信逻辑
+func (s *VoucherOrderService) handleOrderBatch(ctx, msgCtx context.Context, msgs []Message) int {
+	deliveries := make([]*orderDelivery, 0, len(msgs))
+	for i, msg := range msgs {
+		payload, env, err := decodeOrderMessage(msg.Value)
+		if err != nil {
+			// 无法解码的消息转入死信后随批次提交
+			if !s.handlePoison(ctx, msgCtx, "consumeOrders", msg, env, err) {
+				// 停机：只提交此前已转入死信的消息
+				if len(deliveries) == 0 {
+					return i
+				}
+				for _, d := range deliveries {
+					d.span.End()
+				}
+				return deliveries[0].index
+			}
+			continue
+		}
+		topic := msg.Topic
+		if topic == "" {
+			topic = "unknown"
+		}
+		consumeCtx := observability.ExtractMessageContext(msgCtx, msg.Headers)
+		consumeCtx, span := s.startKafkaConsumeSpan(consumeCtx, topic)
+		deliveries = append(deliveries, &orderDelivery{
+			index:   i,
+			msg:     msg,
+			payload: payload,
+			topic:   topic,
+			ctx:     consumeCtx,
+			span:    span,
+			start:   time.Now(),
+		})
+	}
+
+	if len(deliveries) > 1 {
+		payloads := make([]orderMessage, len(deliveries))
+		for i, d := range deliveries {
+			payloads[i] = d.payload
+		}
+		err := s.createOrdersBatch(msgCtx, payloads)
+		if err == nil {
+			s.metrics.ObserveOrderBatch("batched", len(deliveries))
+			for i, d := range deliveries {
+				if err := s.onOrderPersisted(d.ctx, d.payload, d.start); err != nil {
+					// 订单已落库但超时任务登记失败，逐条重试（重复插入按已处理返回）
+					s.log.Warn("consumeOrders schedule timeout failed, retry per-message", zap.Error(err), zap.Int64("orderId", d.payload.OrderID))
+					if !s.consumeOrderDelivery(ctx, d) {
+						for _, rest := range deliveries[i+1:] {
+							rest.span.End()
+						}
+						return d.index
+					}
+					continue
+				}
+				s.metrics.ObserveKafkaConsume(d.topic, "success", time.Since(d.start))
+				d.span.End()
+			}
+			return len(msgs)
+		}
+		s.metrics.ObserveOrderBatch("fallback", len(deliveries))
+		s.log.Warn("consumeOrders batch persist failed, fallback to per-message",
+			zap.Error(err),
+			zap.Int("size", len(deliveries)),
+			zap.Bool("duplicate", isDuplicateKey(err)),
+			zap.Bool("stockConflict", errors.Is(err, errDBStockNotEnough)),
+		)
+	}
+
+	for i, d := range deliveries {
+		if !s.consumeOrderDelivery(ctx, d) {
+			for _, rest := range deliveries[i+1:] {
+				rest.span.End()
+			}
+			return d.index
+		}
+	}
+	return len(msgs)
+}
+
+// consumeOrderDelivery 逐条处理一条订单消息；重试/死信也投递失败时原地退避重试，
+// 不越过该消息提交 offset。停机时返回 false
+func (s *VoucherOrderService) consumeOrderDelivery(ctx context.Context, d *orderDelivery) bool {
+	defer d.span.End()
+	for {
+		err := s.handleConsume(d.ctx, d.payload)
+		if err == nil {
+			s.metrics.ObserveKafkaConsume(d.topic, "success", time.Since(d.start))
+			return true
+		}
+		if errors.Is(err, errRetryEnqueued) {
+			s.metrics.ObserveKafkaConsume(d.topic, "retry", time.Since(d.start))
+			s.log.Info("consumeOrders retry enqueued, committing offset",
+				zap.Int64("orderId", d.payload.OrderID),
+				zap.Int64("voucherId", d.payload.VoucherID),
+			)
+			return true
+		}
+		d.span.RecordError(err)
+		s.metrics.ObserveKafkaConsume(d.topic, "error", time.Since(d.start))
+		s.log.Error("consumeOrders handle error", zap.Error(err), zap.Int64("orderId", d.payload.OrderID), zap.Int64("voucherId", d.payload.VoucherID))
+		if !lifecycle.Sleep(ctx, consumeErrorBackoff) {
+			return false
+		}
+	}
+}
+
+// createOrdersBatch 在一个事务内多行插入订单，并按券聚合后各执行一次库存扣减
+// 任一订单重复或任一券库存不足都会整体回滚，由调用方退回逐条处理
+func (s *VoucherOrderService) createOrdersBatch(ctx context.Context, payloads []orderMessage) error {
+	for _, payload := range payloads {
+		if err := forcedConsumeFailure(payload); err != nil {
+			return err
+		}
+	}
+	nowTime := time.Now()
+	orders := make([]model.VoucherOrder, 0, len(payloads))
+	need := make(map[int64]int)
+	for _, payload := range payloads {
+		quantity := payload.orderQuantity()
+		orders = append(orders, model.VoucherOrder{
+			ID:         payload.OrderID,
+			UserID:     payload.UserID,
+			VoucherID:  payload.VoucherID,
+			Quantity:   quantity,
+			PayType:    1,
+			Status:     model.VoucherOrderStatusUnpaid,
+			CreateTime: nowTime,
+			UpdateTime: nowTime,
+		})
+		need[payload.VoucherID] += quantity
+	}
+	// 固定加锁顺序，避免并发批次之间死锁
+	voucherIDs := make([]int64, 0, len(need))
+	for id := range need {
+		voucherIDs = append(voucherIDs, id)
+	}
+	sort.Slice(voucherIDs, func(i, j int) bool { return voucherIDs[i] < voucherIDs[j] })
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&orders).Error; err != nil {
+			return err
+		}
+		for _, id := range voucherIDs {
+			res := tx.Model(&model.SeckillVoucher{}).
+				Where("voucher_id = ? AND stock >= ?", id, need[id]).
+				Update("stock", gorm.Expr("stock - ?", need[id]))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errDBStockNotEnough
+			}
+		}
+		return nil
+	})
+}
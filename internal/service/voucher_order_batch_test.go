@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"hmdp-backend/internal/model"
+)
+
+func TestGroupByPartition(t *testing.T) {
+	msgs := []Message{
+		{Partition: 1, Offset: 10},
+		{Partition: 0, Offset: 5},
+		{Partition: 1, Offset: 11},
+		{Partition: 0, Offset: 6},
+		{Partition: 2, Offset: 1},
+	}
+	groups := groupByPartition(msgs)
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(groups))
+	}
+	want := [][]int64{{10, 11}, {5, 6}, {1}}
+	for i, group := range groups {
+		if len(group) != len(want[i]) {
+			t.Fatalf("group %d: expected %d messages, got %d", i, len(want[i]), len(group))
+		}
+		for j, msg := range group {
+			if msg.Offset != want[i][j] {
+				t.Fatalf("group %d: expected offset %d at %d, got %d", i, want[i][j], j, msg.Offset)
+			}
+		}
+	}
+}
+
+// TestCreateOrdersBatchDuplicateRollsBack 验证批量落库遇到重复订单时整体回滚，库存不被扣减
+func TestCreateOrdersBatchDuplicateRollsBack(t *testing.T) {
+	ctx := context.Background()
+
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		dsn = "root:root@tcp(127.0.0.1:3306)/hmdp?parseTime=true&loc=Local&charset=utf8mb4"
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Skipf("skip: cannot connect mysql: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err == nil {
+		defer sqlDB.Close()
+	}
+
+	const voucherID = int64(12)
+	base := time.Now().UnixNano()
+	now := time.Now()
+	existing := &model.VoucherOrder{ID: base, UserID: 4, VoucherID: voucherID, CreateTime: now, UpdateTime: now}
+	_ = db.WithContext(ctx).Where("id IN ?", []int64{base, base + 1}).Delete(&model.VoucherOrder{}).Error
+	if err := db.WithContext(ctx).Create(existing).Error; err != nil {
+		t.Fatalf("seed order failed: %v", err)
+	}
+	defer db.WithContext(ctx).Where("id IN ?", []int64{base, base + 1}).Delete(&model.VoucherOrder{})
+
+	var before model.SeckillVoucher
+	if err := db.WithContext(ctx).Where("voucher_id = ?", voucherID).Take(&before).Error; err != nil {
+		t.Skipf("skip: seckill voucher %d not found: %v", voucherID, err)
+	}
+
+	svc := &VoucherOrderService{db: db}
+	payloads := []orderMessage{
+		{OrderID: base + 1, UserID: 5, VoucherID: voucherID, CreatedAt: now.Unix()},
+		{OrderID: base, UserID: 4, VoucherID: voucherID, CreatedAt: now.Unix()},
+	}
+	err = svc.createOrdersBatch(ctx, payloads)
+	if err == nil || !isDuplicateKey(err) {
+		t.Fatalf("expected duplicate key error, got %v", err)
+	}
+
+	var count int64
+	if err := db.WithContext(ctx).Model(&model.VoucherOrder{}).Where("id = ?", base+1).Count(&count).Error; err != nil {
+		t.Fatalf("count orders: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected batch to roll back, found %d orders", count)
+	}
+	var after model.SeckillVoucher
+	if err := db.WithContext(ctx).Where("voucher_id = ?", voucherID).Take(&after).Error; err != nil {
+		t.Fatalf("load seckill voucher: %v", err)
+	}
+	if after.Stock != before.Stock {
+		t.Fatalf("expected stock unchanged %d, got %d", before.Stock, after.Stock)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/model"
+	"hmdp-backend/internal/utils"
+)
+
+// flakyProducer 前 failures 次发布失败
+type flakyProducer struct {
+	failures  int
+	published int
+}
+
+func (p *flakyProducer) Topic() string { return "test-dlq" }
+
+func (p *flakyProducer) Publish(ctx context.Context, msgs ...Message) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("dlq unavailable")
+	}
+	p.published += len(msgs)
+	return nil
+}
+
+func (p *flakyProducer) Close() error { return nil }
+
+// TestDLQCompensatesStockOnce 死信发布持续失败时不归还库存，发布成功后只归还一次，重复消费也不会再归还（依赖本地 Redis）
+func TestDLQCompensatesStockOnce(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", DB: 0})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	dlq := &flakyProducer{failures: 5}
+	svc := NewVoucherOrderService(nil, rdb, nil, nil, dlq, nil, nil, nil, utils.SMTPConfig{}, config.SeckillConfig{}, nil, zap.NewNop())
+
+	voucherID := time.Now().UnixNano()
+	payload := orderMessage{OrderID: voucherID, UserID: 7, VoucherID: voucherID, Quantity: 2, RetryCount: maxRetryCount}
+	stockKey := fmt.Sprintf(stockKeyFmt, voucherID)
+	countKey := fmt.Sprintf(orderCountKeyFmt, voucherID)
+	markerKey := fmt.Sprintf(orderCompensatedKeyFmt, payload.OrderID, payload.ReplayCount)
+	defer rdb.Del(ctx, stockKey, countKey, markerKey, fmt.Sprintf(orderStateKeyFmt, payload.OrderID))
+	rdb.Set(ctx, stockKey, 8, 0)
+	rdb.HSet(ctx, countKey, payload.UserID, 2)
+
+	// 消费端对 consumeError 原地重试：每次都会重新走到死信分支
+	for i := 0; i < 5; i++ {
+		if err := svc.publishRetryOrDLQ(ctx, payload, errors.New("db down")); err == nil || errors.Is(err, errRetryEnqueued) {
+			t.Fatalf("expected dlq publish error, got %v", err)
+		}
+	}
+	if stock, _ := rdb.Get(ctx, stockKey).Int64(); stock != 8 {
+		t.Fatalf("expected stock untouched while dlq publish fails, got %d", stock)
+	}
+	// 发布成功后补偿；之后同一消息重复消费不再补偿
+	for i := 0; i < 2; i++ {
+		if err := svc.publishRetryOrDLQ(ctx, payload, errors.New("db down")); !errors.Is(err, errRetryEnqueued) {
+			t.Fatalf("expected dlq enqueued, got %v", err)
+		}
+	}
+	if stock, _ := rdb.Get(ctx, stockKey).Int64(); stock != 10 {
+		t.Fatalf("expected stock restored exactly once, got %d", stock)
+	}
+	if bought, err := rdb.HGet(ctx, countKey, "7").Result(); err != redis.Nil {
+		t.Fatalf("expected purchase count cleared, got %q %v", bought, err)
+	}
+	if dlq.published != 2 {
+		t.Fatalf("expected 2 dlq messages, got %d", dlq.published)
+	}
+}
+
+// TestCancelledOrderRestoreOnce 超时取消后的 Redis 归还按订单标记只生效一次，重复执行不会多归还（依赖本地 Redis）
+func TestCancelledOrderRestoreOnce(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", DB: 0})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	svc := NewVoucherOrderService(nil, rdb, nil, nil, nil, nil, nil, nil, utils.SMTPConfig{}, config.SeckillConfig{}, nil, zap.NewNop())
+	voucherID := time.Now().UnixNano()
+	order := &model.VoucherOrder{ID: voucherID, UserID: 7, VoucherID: voucherID, Quantity: 2}
+	stockKey := fmt.Sprintf(stockKeyFmt, voucherID)
+	countKey := fmt.Sprintf(orderCountKeyFmt, voucherID)
+	defer rdb.Del(ctx, stockKey, countKey, fmt.Sprintf(orderCancelRestoredKeyFmt, order.ID))
+	rdb.Set(ctx, stockKey, 8, 0)
+	rdb.HSet(ctx, countKey, order.UserID, 2)
+
+	for i := 0; i < 3; i++ {
+		if err := svc.restoreCancelledOrder(ctx, order); err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+	}
+	if stock, _ := rdb.Get(ctx, stockKey).Int64(); stock != 10 {
+		t.Fatalf("expected stock restored exactly once, got %d", stock)
+	}
+}
+
+// TestOrderTimeoutErrorsPropagate Redis 不可用时超时任务登记与取消后归还返回错误，由调用方重试而不是静默丢弃
+func TestOrderTimeoutErrorsPropagate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer rdb.Close()
+
+	svc := NewVoucherOrderService(nil, rdb, nil, nil, nil, nil, nil, nil, utils.SMTPConfig{}, config.SeckillConfig{}, nil, zap.NewNop())
+	payload := orderMessage{OrderID: 1, UserID: 7, VoucherID: 2, Quantity: 1, PayDeadline: time.Now().Unix()}
+	if err := svc.onOrderPersisted(ctx, payload, time.Now()); err == nil {
+		t.Fatalf("expected schedule error to be returned")
+	}
+	if err := svc.restoreCancelledOrder(ctx, &model.VoucherOrder{ID: 1, UserID: 7, VoucherID: 2}); err == nil {
+		t.Fatalf("expected restore error to be returned")
+	}
+}
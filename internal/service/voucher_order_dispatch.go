@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/lifecycle"
+)
+
+const defaultConsumeConcurrency = 4
+
+// laneHandler 处理一个 lane 取出的一批消息，返回已处理完成、可以提交的消息
+// 返回数量少于输入时表示停机，lane 随即退出
+type laneHandler func(ctx, msgCtx context.Context, msgs []Message) []Message
+
+// dispatchLoop 拉取消息并按 key（voucherId）分发到固定的 lane 并行处理
+// 同一 key 的消息总在同一 lane 内按顺序处理，不同 key 并行；offset 由 offsetTracker 按分区连续提交，
+// 不会越过尚未处理完成的消息
+func (s *VoucherOrderService) dispatchLoop(ctx context.Context, consumer Consumer, name string, batchSize int, handle laneHandler) {
+	lanes := s.consumeConcurrency
+	if lanes <= 0 {
+		lanes = 1
+	}
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	s.log.Info(fmt.Sprintf("%s started", name), zap.Int("concurrency", lanes), zap.Int("batchSize", batchSize))
+
+	// 已拉取的消息在停机时也要处理完并提交 offset，不随 ctx 取消而中断
+	msgCtx := context.WithoutCancel(ctx)
+	tracker := newOffsetTracker()
+	chans := make([]chan Message, lanes)
+	var wg sync.WaitGroup
+	for i := range chans {
+		chans[i] = make(chan Message, batchSize)
+		wg.Add(1)
+		go func(ch <-chan Message) {
+			defer wg.Done()
+			s.runLane(ctx, msgCtx, consumer, name, ch, batchSize, tracker, handle)
+		}(chans[i])
+	}
+	defer func() {
+		// 关闭 lane 并等待已分发的消息处理完成
+		for _, ch := range chans {
+			close(ch)
+		}
+		wg.Wait()
+		s.log.Info(fmt.Sprintf("%s stopped", name))
+	}()
+
+	for {
+		msg, err := consumer.Fetch(ctx)
+		if err != nil {
+			if isFetchStopped(ctx, err) {
+				return
+			}
+			s.log.Error(fmt.Sprintf("%s fetch message error", name), zap.Error(err))
+			if !lifecycle.Sleep(ctx, time.Second) {
+				return
+			}
+			continue
+		}
+		msg = tracker.add(msg)
+		select {
+		case chans[laneFor(msg.Key, lanes)] <- msg:
+		case <-ctx.Done():
+			// 未分发的消息不提交，由下一个实例重新消费
+			return
+		}
+	}
+}
+
+// runLane 顺序处理一个 lane 的消息；batchSize > 1 时在 batchWait 内尽量凑批
+func (s *VoucherOrderService) runLane(
+	ctx, msgCtx context.Context,
+	consumer Consumer,
+	name string,
+	ch <-chan Message,
+	batchSize int,
+	tracker *offsetTracker,
+	handle laneHandler,
+) {
+	for first := range ch {
+		batch := []Message{first}
+		if batchSize > 1 {
+			batch = s.collectLaneBatch(ch, batch, batchSize)
+		}
+		done := handle(ctx, msgCtx, batch)
+		s.commitDone(msgCtx, consumer, name, tracker, done)
+		if len(done) < len(batch) {
+			return
+		}
+	}
+}
+
+// collectLaneBatch 从 lane 中继续取消息直到凑满一批、等待超过 batchWait 或 lane 关闭
+func (s *VoucherOrderService) collectLaneBatch(ch <-chan Message, batch []Message, batchSize int) []Message {
+	timer := time.NewTimer(s.batchWait)
+	defer timer.Stop()
+	for len(batch) < batchSize {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, msg)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+// commitDone 标记消息完成并提交各分区新的连续完成位置
+func (s *VoucherOrderService) commitDone(ctx context.Context, consumer Consumer, name string, tracker *offsetTracker, msgs []Message) {
+	if len(msgs) == 0 {
+		return
+	}
+	tracker.commitMu.Lock()
+	defer tracker.commitMu.Unlock()
+	commits := tracker.markDone(msgs)
+	if len(commits) == 0 {
+		return
+	}
+	if err := consumer.Commit(ctx, commits...); err != nil {
+		s.log.Error(fmt.Sprintf("%s commit error", name), zap.Error(err))
+	}
+}
+
+// laneFor 按消息 key 选择 lane，同一 key 固定落在同一 lane
+func laneFor(key []byte, lanes int) int {
+	if lanes <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(lanes))
+}
+
+// offsetTracker 记录各分区已拉取未完成的 offset，只有某个 offset 之前的消息全部完成才推进提交位置
+type offsetTracker struct {
+	mu         sync.Mutex
+	commitMu   sync.Mutex // 串行化提交，避免并发 lane 提交时位置回退
+	partitions map[int]*partitionOffsets
+	generation uint64 // 分区状态每次重置递增
+}
+
+type partitionOffsets struct {
+	generation uint64
+	pending    []int64 // 已拉取未提交的 offset，按拉取顺序递增
+	done       map[int64]Message
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// add 登记一条已拉取的消息，返回带上分区状态代数的消息，分发与 markDone 都应使用返回值
+// offset 回退（rebalance 后从已提交位置重新拉取）时以新的代数重置该分区
+func (t *offsetTracker) add(msg Message) Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.partitions[msg.Partition]
+	if !ok || (len(p.pending) > 0 && msg.Offset <= p.pending[len(p.pending)-1]) {
+		t.generation++
+		p = &partitionOffsets{generation: t.generation, done: make(map[int64]Message)}
+		t.partitions[msg.Partition] = p
+	}
+	p.pending = append(p.pending, msg.Offset)
+	msg.generation = p.generation
+	return msg
+}
+
+// markDone 标记消息完成，返回各分区新增的连续完成消息（按 offset 递增）
+// 按位置提交的实现（Kafka）取各分区最大值，逐条确认的实现（Redis Streams）逐条确认
+// 分区重置前拉取的消息（代数较旧）直接忽略：相同 offset 已重新拉取，须等重新处理完成后才能提交
+func (t *offsetTracker) markDone(msgs []Message) []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	touched := make(map[int]struct{})
+	for _, msg := range msgs {
+		p, ok := t.partitions[msg.Partition]
+		if !ok || p.generation != msg.generation {
+			continue
+		}
+		p.done[msg.Offset] = msg
+		touched[msg.Partition] = struct{}{}
+	}
+	var commits []Message
+	for partition := range touched {
+		p := t.partitions[partition]
+		for len(p.pending) > 0 {
+			msg, ok := p.done[p.pending[0]]
+			if !ok {
+				break
+			}
+			delete(p.done, p.pending[0])
+			p.pending = p.pending[1:]
+			commits = append(commits, msg)
+		}
+	}
+	return commits
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestOffsetTrackerCommitsContiguousOnly(t *testing.T) {
+	tracker := newOffsetTracker()
+	msgs := make([]Message, 0, 4)
+	for offset := int64(10); offset < 14; offset++ {
+		msgs = append(msgs, tracker.add(Message{Partition: 0, Offset: offset}))
+	}
+	other := tracker.add(Message{Partition: 1, Offset: 3})
+
+	// 11、12 先完成，10 未完成时不能提交
+	if commits := tracker.markDone([]Message{msgs[1], msgs[2]}); len(commits) != 0 {
+		t.Fatalf("expected no commit before offset 10 is done, got %v", commits)
+	}
+	commits := tracker.markDone([]Message{msgs[0], other})
+	var got []int64
+	for _, c := range commits {
+		if c.Partition == 0 {
+			got = append(got, c.Offset)
+		} else if c.Offset != 3 {
+			t.Fatalf("expected partition 1 commit offset 3, got %d", c.Offset)
+		}
+	}
+	if len(commits) != 4 || len(got) != 3 || got[0] != 10 || got[2] != 12 {
+		t.Fatalf("expected partition 0 commits 10..12 and partition 1 commit 3, got %v", commits)
+	}
+	commits = tracker.markDone([]Message{msgs[3]})
+	if len(commits) != 1 || commits[0].Offset != 13 {
+		t.Fatalf("expected commit offset 13, got %v", commits)
+	}
+}
+
+func TestOffsetTrackerResetOnRewind(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.add(Message{Partition: 0, Offset: 5})
+	tracker.add(Message{Partition: 0, Offset: 6})
+	// rebalance 后从已提交位置重新拉取
+	rewound := tracker.add(Message{Partition: 0, Offset: 5})
+	commits := tracker.markDone([]Message{rewound})
+	if len(commits) != 1 || commits[0].Offset != 5 {
+		t.Fatalf("expected commit offset 5 after rewind, got %v", commits)
+	}
+}
+
+// TestOffsetTrackerIgnoresStaleGeneration 重置前拉取、仍在 lane 中处理的消息完成时不能提交重新拉取的同一 offset
+func TestOffsetTrackerIgnoresStaleGeneration(t *testing.T) {
+	tracker := newOffsetTracker()
+	old5 := tracker.add(Message{Partition: 0, Offset: 5})
+	old6 := tracker.add(Message{Partition: 0, Offset: 6})
+	// rebalance 后从已提交位置重新拉取 5、6，旧消息仍在处理
+	new5 := tracker.add(Message{Partition: 0, Offset: 5})
+	new6 := tracker.add(Message{Partition: 0, Offset: 6})
+
+	if commits := tracker.markDone([]Message{old5, old6}); len(commits) != 0 {
+		t.Fatalf("expected stale messages ignored, got %v", commits)
+	}
+	if p := tracker.partitions[0]; len(p.done) != 0 {
+		t.Fatalf("expected no stale entries kept, got %v", p.done)
+	}
+	commits := tracker.markDone([]Message{new5, new6})
+	if len(commits) != 2 || commits[0].Offset != 5 || commits[1].Offset != 6 {
+		t.Fatalf("expected re-fetched offsets committed after reprocessing, got %v", commits)
+	}
+}
+
+func TestLaneForStableByKey(t *testing.T) {
+	const lanes = 8
+	key := []byte("12")
+	lane := laneFor(key, lanes)
+	for i := 0; i < 10; i++ {
+		if got := laneFor(key, lanes); got != lane {
+			t.Fatalf("expected stable lane %d, got %d", lane, got)
+		}
+	}
+	if lane < 0 || lane >= lanes {
+		t.Fatalf("lane %d out of range", lane)
+	}
+	if laneFor(key, 1) != 0 {
+		t.Fatalf("expected lane 0 when concurrency is 1")
+	}
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"hmdp-backend/internal/lifecycle"
+	"hmdp-backend/internal/model"
+	"hmdp-backend/internal/utils"
+)
+
+//go:embed seckill_reserve.lua
+var seckillReserveLuaSource string
+
+var seckillReserveLua = redis.NewScript(seckillReserveLuaSource)
+
+const dlqLastErrorMaxLen = 1024
+
+var (
+	// ErrDLQEntryNotFound 死信记录不存在
+	ErrDLQEntryNotFound = errors.New("死信记录不存在")
+	// ErrDLQEntryHandled 死信记录已被重放或丢弃
+	ErrDLQEntryHandled = errors.New("死信记录已处理")
+	// ErrDLQReplayNoStock 重放时 Redis 库存不足，无法重新预占
+	ErrDLQReplayNoStock = errors.New("库存不足，无法重放")
+)
+
+// DLQFilter 死信列表筛选条件，零值表示不筛选
+type DLQFilter struct {
+	VoucherID int64
+	UserID    int64
+	Status    *int
+	Error     string // 按 last_error 模糊匹配
+}
+
+// handlePoison 处理无法解码或未通过校验的消息，返回 true 表示可以提交
+// 毒消息连同原始内容封装后转入死信 topic，投递失败时原地退避重试，不会被丢弃；
+// 死信 topic 中的毒消息无法落表（没有订单 ID），告警后提交
+func (s *VoucherOrderService) handlePoison(ctx, msgCtx context.Context, name string, msg Message, env Envelope, cause error) bool {
+	topic := msg.Topic
+	if topic == "" {
+		topic = "unknown"
+	}
+	s.metrics.ObserveKafkaConsume(topic, "poison", 0)
+	if poison, err := decodePoisonMessage(env); err == nil {
+		s.alertPoison(poison)
+		return true
+	}
+	s.log.Warn(fmt.Sprintf("%s poison message, sending to dlq", name),
+		zap.String("topic", topic),
+		zap.String("key", string(msg.Key)),
+		zap.Error(cause),
+	)
+	if s.dlqProducer == nil {
+		s.log.Error(fmt.Sprintf("%s poison message dropped: dlq producer not configured", name), zap.String("topic", topic))
+		return true
+	}
+	poisonMsg, err := newPoisonMessage(producerVoucherOrder, msg, cause)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s encode poison message error", name), zap.Error(err))
+		return true
+	}
+	dlqTopic := s.dlqProducer.Topic()
+	for {
+		err := s.dlqProducer.Publish(msgCtx, poisonMsg)
+		if err == nil {
+			s.metrics.ObserveKafkaPublish(dlqTopic, "success")
+			return true
+		}
+		s.metrics.ObserveKafkaPublish(dlqTopic, "error")
+		s.log.Error(fmt.Sprintf("%s publish poison message error", name), zap.Error(err))
+		if !lifecycle.Sleep(ctx, consumeErrorBackoff) {
+			return false
+		}
+	}
+}
+
+// alertPoison 死信中的毒消息告警
+func (s *VoucherOrderService) alertPoison(poison poisonMessage) {
+	s.log.Error("consumeDLQ poison message",
+		zap.String("sourceTopic", poison.SourceTopic),
+		zap.String("key", poison.Key),
+		zap.String("error", poison.Error),
+		zap.ByteString("value", poison.Value),
+	)
+	if s.smtpCfg.Host == "" {
+		return
+	}
+	subject := fmt.Sprintf("[DLQ] undecodable message from %s", poison.SourceTopic)
+	body := fmt.Sprintf(
+		"消息无法解码，已转入死信，请人工处理。\n\nsourceTopic: %s\nkey: %s\nerror: %s\nvalue: %s\n",
+		poison.SourceTopic,
+		poison.Key,
+		poison.Error,
+		poison.Value,
+	)
+	if err := utils.SendEmail(s.smtpCfg, subject, body); err != nil {
+		s.log.Error("consumeDLQ poison email failed", zap.Error(err))
+	}
+}
+
+// persistDLQ 将死信消息写入 tb_seckill_dlq，按订单 ID 去重，重复投递不会产生多条记录
+// 重放后再次进入死信（replayCount 更大）时恢复为待处理并刷新错误信息，同一消息重复投递则保持原状
+func (s *VoucherOrderService) persistDLQ(ctx context.Context, payload orderMessage, raw []byte) error {
+	lastError := truncateUTF8(payload.LastError, dlqLastErrorMaxLen)
+	entry := &model.SeckillDLQEntry{
+		OrderID:     payload.OrderID,
+		UserID:      payload.UserID,
+		VoucherID:   payload.VoucherID,
+		Quantity:    payload.orderQuantity(),
+		RetryCount:  payload.RetryCount,
+		ReplayCount: payload.ReplayCount,
+		LastError:   lastError,
+		Payload:     string(raw),
+		Status:      model.SeckillDLQStatusPending,
+	}
+	newer := func(column string) clause.Assignment {
+		return clause.Assignment{
+			Column: clause.Column{Name: column},
+			Value:  gorm.Expr(fmt.Sprintf("IF(VALUES(replay_count) > replay_count, VALUES(%s), %s)", column, column)),
+		}
+	}
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "order_id"}},
+			// MySQL 按顺序赋值，replay_count 必须最后更新
+			DoUpdates: clause.Set{
+				newer("status"),
+				newer("retry_count"),
+				newer("last_error"),
+				newer("payload"),
+				newer("operator_id"),
+				newer("reason"),
+				newer("handled_time"),
+				{Column: clause.Column{Name: "replay_count"}, Value: gorm.Expr("GREATEST(replay_count, VALUES(replay_count))")},
+			},
+		}).
+		Create(entry).Error
+}
+
+// ListDLQ 分页查询死信记录，按创建时间倒序
+func (s *VoucherOrderService) ListDLQ(ctx context.Context, filter DLQFilter, page, size int) ([]model.SeckillDLQEntry, int64, error) {
+	query := s.db.WithContext(ctx).Model(&model.SeckillDLQEntry{})
+	if filter.VoucherID > 0 {
+		query = query.Where("voucher_id = ?", filter.VoucherID)
+	}
+	if filter.UserID > 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.Error != "" {
+		query = query.Where("last_error LIKE ?", "%"+filter.Error+"%")
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * size
+	if offset < 0 {
+		offset = 0
+	}
+	var entries []model.SeckillDLQEntry
+	if err := query.Order("id DESC").Offset(offset).Limit(size).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// GetDLQ 查询单条死信记录
+func (s *VoucherOrderService) GetDLQ(ctx context.Context, id int64) (*model.SeckillDLQEntry, error) {
+	var entry model.SeckillDLQEntry
+	err := s.db.WithContext(ctx).Where("id = ?", id).Take(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDLQEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ReplayDLQ 重放死信订单：标记已重放并原子地重新预占 Redis 库存与用户已购数量，提交后重新投递到主 Topic
+// 投递失败时写入 outbox；outbox 也失败则归还预占并恢复为待处理
+func (s *VoucherOrderService) ReplayDLQ(ctx context.Context, id, operatorID int64) error {
+	var payload orderMessage
+	reserved := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var entry model.SeckillDLQEntry
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Take(&entry).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDLQEntryNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if entry.Status != model.SeckillDLQStatusPending {
+			return ErrDLQEntryHandled
+		}
+		decoded, _, err := decodeOrderMessage([]byte(entry.Payload))
+		if err != nil {
+			return fmt.Errorf("decode dlq payload: %w", err)
+		}
+		payload = decoded
+		if err := s.markDLQHandled(tx, id, model.SeckillDLQStatusReplayed, operatorID, ""); err != nil {
+			return err
+		}
+		res, err := seckillReserveLua.Run(ctx, s.rdb,
+			[]string{fmt.Sprintf(stockKeyFmt, payload.VoucherID), fmt.Sprintf(orderCountKeyFmt, payload.VoucherID)},
+			payload.UserID, payload.orderQuantity()).Int()
+		if err != nil {
+			return err
+		}
+		if res != 0 {
+			return ErrDLQReplayNoStock
+		}
+		reserved = true
+		return nil
+	})
+	if err != nil {
+		if reserved {
+			// 预占成功但事务提交失败
+			s.compensateRedis(ctx, payload)
+		}
+		return err
+	}
+
+	// 作为新消息重新投递：清空重试信息，支付截止时间按原时长从现在重新计算
+	if payload.PayDeadline > 0 && payload.CreatedAt > 0 {
+		payload.PayDeadline = time.Now().Unix() + (payload.PayDeadline - payload.CreatedAt)
+	}
+	payload.ReplayCount++
+	payload.RetryCount = 0
+	payload.NextRetryAt = 0
+	payload.LastError = ""
+	s.trackOrderState(ctx, payload, OrderStatePending)
+	if err := s.publishOrder(ctx, payload); err != nil {
+		if outboxErr := s.enqueueOutbox(ctx, payload); outboxErr != nil {
+			s.compensateRedis(ctx, payload)
+			if revertErr := s.db.WithContext(ctx).Model(&model.SeckillDLQEntry{}).
+				Where("id = ?", id).
+				Updates(map[string]interface{}{"status": model.SeckillDLQStatusPending, "handled_time": nil}).Error; revertErr != nil {
+				s.log.Error("revert dlq entry failed", zap.Error(revertErr), zap.Int64("id", id))
+			}
+			payload.LastError = err.Error()
+			s.trackOrderState(ctx, payload, OrderStateDeadLettered)
+			return errors.Join(err, outboxErr)
+		}
+	}
+	s.log.Info("dlq order replayed", zap.Int64("id", id), zap.Int64("orderId", payload.OrderID), zap.Int64("operatorId", operatorID))
+	return nil
+}
+
+// DiscardDLQ 丢弃死信记录，记录操作人与原因；库存已在进入死信时归还，无需处理 Redis
+func (s *VoucherOrderService) DiscardDLQ(ctx context.Context, id, operatorID int64, reason string) error {
+	if err := s.markDLQHandled(s.db.WithContext(ctx), id, model.SeckillDLQStatusDiscarded, operatorID, reason); err != nil {
+		return err
+	}
+	s.log.Info("dlq order discarded", zap.Int64("id", id), zap.Int64("operatorId", operatorID), zap.String("reason", reason))
+	return nil
+}
+
+// markDLQHandled 条件更新：只有待处理的记录才能被重放或丢弃
+func (s *VoucherOrderService) markDLQHandled(tx *gorm.DB, id int64, status int, operatorID int64, reason string) error {
+	res := tx.Model(&model.SeckillDLQEntry{}).
+		Where("id = ? AND status = ?", id, model.SeckillDLQStatusPending).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"operator_id":  operatorID,
+			"reason":       reason,
+			"handled_time": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&model.SeckillDLQEntry{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrDLQEntryNotFound
+	}
+	return ErrDLQEntryHandled
+}
+
+// truncateUTF8 按字节上限截断并保证不截断多字节字符，非法的 UTF-8 字节替换为 U+FFFD，避免 utf8mb4 严格模式拒绝写入
+func truncateUTF8(s string, maxBytes int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) <= maxBytes {
+		return s
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
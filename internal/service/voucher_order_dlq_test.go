@@ -0,0 +1,28 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestTruncateUTF8 多字节错误信息按字节上限截断时不能拆开字符
+func TestTruncateUTF8(t *testing.T) {
+	msg := strings.Repeat("库存不足", 200) // 每个汉字 3 字节
+	got := truncateUTF8(msg, dlqLastErrorMaxLen)
+	if len(got) > dlqLastErrorMaxLen || !utf8.ValidString(got) {
+		t.Fatalf("invalid truncation: len=%d valid=%v", len(got), utf8.ValidString(got))
+	}
+	if len(got) != dlqLastErrorMaxLen-dlqLastErrorMaxLen%3 {
+		t.Fatalf("expected truncation at last full rune, got len=%d", len(got))
+	}
+	if got := truncateUTF8("kafka: 超时", 9); got != "kafka: " {
+		t.Fatalf("unexpected truncation %q", got)
+	}
+	if got := truncateUTF8("bad\xffbyte", 100); !utf8.ValidString(got) {
+		t.Fatalf("expected invalid bytes replaced, got %q", got)
+	}
+	if got := truncateUTF8("short", 100); got != "short" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
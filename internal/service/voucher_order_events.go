@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// orderEventChannel 订单异步处理结果的 Redis pub/sub 频道，所有实例订阅后按订单 ID 分发给本机的等待连接
+const orderEventChannel = "seckill:order:events"
+
+// IsFinalOrderState 订单异步处理是否已有结果（落库成功或失败并归还库存），之后状态不再变化
+func IsFinalOrderState(state string) bool {
+	switch state {
+	case OrderStatePersisted, OrderStateDeadLettered, OrderStateCompensated:
+		return true
+	default:
+		return false
+	}
+}
+
+// orderEventHub 本机等待订单结果的连接，按订单 ID 索引
+type orderEventHub struct {
+	mu       sync.Mutex
+	watchers map[int64]map[chan *VoucherOrderView]struct{}
+}
+
+func newOrderEventHub() *orderEventHub {
+	return &orderEventHub{watchers: make(map[int64]map[chan *VoucherOrderView]struct{})}
+}
+
+// watch 注册一个等待者，返回的 channel 只保留最新一次状态；stop 用于注销
+func (h *orderEventHub) watch(orderID int64) (<-chan *VoucherOrderView, func()) {
+	ch := make(chan *VoucherOrderView, 1)
+	h.mu.Lock()
+	set := h.watchers[orderID]
+	if set == nil {
+		set = make(map[chan *VoucherOrderView]struct{})
+		h.watchers[orderID] = set
+	}
+	set[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.watchers[orderID], ch)
+			if len(h.watchers[orderID]) == 0 {
+				delete(h.watchers, orderID)
+			}
+		})
+	}
+}
+
+// dispatch 将状态推给该订单的所有等待者；等待者未及时读取时丢弃旧状态只保留最新的
+func (h *orderEventHub) dispatch(view *VoucherOrderView) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.watchers[view.OrderID] {
+		select {
+		case ch <- view:
+			continue
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- view:
+		default:
+		}
+	}
+}
+
+// runOrderEvents 订阅订单结果频道并分发给本机等待者，go-redis 断线后会自动重连并重新订阅
+// pub/sub 不保证送达，等待方需定期回查状态兜底
+func (s *VoucherOrderService) runOrderEvents(ctx context.Context) {
+	pubsub := s.rdb.Subscribe(ctx, orderEventChannel)
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var view VoucherOrderView
+			if err := json.Unmarshal([]byte(msg.Payload), &view); err != nil || view.OrderID == 0 {
+				s.log.Warn("invalid order event", zap.String("payload", msg.Payload), zap.Error(err))
+				continue
+			}
+			s.events.dispatch(&view)
+		}
+	}
+}
+
+// WatchOrder 订阅当前用户订单的异步处理结果：返回当前状态，之后的状态变化从 channel 推送，stop 用于取消订阅
+// 先注册再查询当前状态，避免查询与订阅之间的状态变化丢失
+func (s *VoucherOrderService) WatchOrder(ctx context.Context, orderID, userID int64) (*VoucherOrderView, <-chan *VoucherOrderView, func(), error) {
+	ch, stop := s.events.watch(orderID)
+	view, err := s.GetOrder(ctx, orderID, userID)
+	if err != nil {
+		stop()
+		return nil, nil, nil, err
+	}
+	return view, ch, stop, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/utils"
+)
+
+func TestOrderEventHubKeepsLatest(t *testing.T) {
+	hub := newOrderEventHub()
+	ch, stop := hub.watch(1)
+	other, stopOther := hub.watch(2)
+	defer stopOther()
+
+	hub.dispatch(&VoucherOrderView{OrderID: 1, State: OrderStateRetrying})
+	hub.dispatch(&VoucherOrderView{OrderID: 1, State: OrderStatePersisted})
+	if v := <-ch; v.State != OrderStatePersisted {
+		t.Fatalf("expected latest state persisted, got %s", v.State)
+	}
+	select {
+	case v := <-other:
+		t.Fatalf("unexpected event for other order: %+v", v)
+	default:
+	}
+
+	stop()
+	stop()
+	hub.dispatch(&VoucherOrderView{OrderID: 1, State: OrderStateCompensated})
+	select {
+	case v := <-ch:
+		t.Fatalf("unexpected event after stop: %+v", v)
+	default:
+	}
+	if _, ok := hub.watchers[1]; ok {
+		t.Fatalf("expected watchers of order 1 removed")
+	}
+}
+
+// TestOrderEventsAcrossInstances 一个实例记录的消费结果经 Redis pub/sub 推送给另一个实例的等待者（依赖本地 Redis）
+func TestOrderEventsAcrossInstances(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("skip: cannot connect redis: %v", err)
+	}
+	defer rdb.Close()
+
+	newSvc := func() *VoucherOrderService {
+		return NewVoucherOrderService(nil, rdb, nil, nil, nil, nil, nil, nil,
+			utils.SMTPConfig{}, config.SeckillConfig{}, nil, newTestLogger(t))
+	}
+	consumer, waiter := newSvc(), newSvc()
+	go waiter.runOrderEvents(ctx)
+
+	orderID := time.Now().UnixNano()
+	defer rdb.Del(ctx, fmt.Sprintf(orderStateKeyFmt, orderID))
+	events, stop := waiter.events.watch(orderID)
+	defer stop()
+
+	payload := orderMessage{OrderID: orderID, UserID: 1, VoucherID: 1, CreatedAt: time.Now().Unix(), RetryCount: 2, LastError: "boom"}
+	deadline := time.After(3 * time.Second)
+	for {
+		// 订阅建立前发布的消息会丢失，重复发布直到收到
+		consumer.trackOrderState(ctx, payload, OrderStateDeadLettered)
+		select {
+		case v := <-events:
+			if v.State != OrderStateDeadLettered || v.RetryCount != 2 || v.LastError != "boom" || v.UserID != 1 {
+				t.Fatalf("unexpected event %+v", v)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("order event not received")
+		}
+	}
+}
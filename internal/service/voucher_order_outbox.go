@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/utils"
+)
+
+const (
+	orderOutboxKey           = "seckill:outbox"       // 发布 Kafka 失败的订单消息（Stream）
+	orderOutboxLockKey       = "seckill:outbox:relay" // 多实例下同一时刻只有一个 relay 工作
+	orderOutboxPollInterval  = time.Second
+	orderOutboxBatchSize     = 100
+	orderOutboxLockTTL       = 30 * time.Second
+	orderOutboxPayloadField  = "payload"
+	orderOutboxEnqueuedField = "enqueuedAt"
+)
+
+// enqueueOutbox 将发布失败的订单消息写入本地 outbox，由 relay 在 Kafka 恢复后重新投递
+func (s *VoucherOrderService) enqueueOutbox(ctx context.Context, payload orderMessage) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	err = s.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: orderOutboxKey,
+		Values: map[string]interface{}{
+			orderOutboxPayloadField:  data,
+			orderOutboxEnqueuedField: time.Now().UnixMilli(),
+		},
+	}).Err()
+	if err != nil {
+		return err
+	}
+	s.metrics.ObserveOutbox("enqueued")
+	return nil
+}
+
+// runOutboxRelay 定时把 outbox 中的消息重新发布到主 Topic，并上报积压深度与最老消息年龄
+func (s *VoucherOrderService) runOutboxRelay(ctx context.Context) {
+	s.log.Info("order outbox relay started")
+	ticker := time.NewTicker(orderOutboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 本轮投递与释放锁不随停机中断
+			tickCtx := context.WithoutCancel(ctx)
+			s.reportOutboxBacklog(tickCtx)
+			lock := utils.NewRedisLock(s.rdb, orderOutboxLockKey, orderOutboxLockTTL)
+			ok, err := lock.TryLock(tickCtx)
+			if err != nil || !ok {
+				continue
+			}
+			s.relayOutbox(tickCtx)
+			_ = lock.Unlock(tickCtx)
+		}
+	}
+}
+
+// relayOutbox 按写入顺序重新发布一批消息，发布成功后删除；遇到发布失败说明 Kafka 仍不可用，停止本轮
+// 发布成功但删除前宕机会导致重复投递，消费端以订单 ID 幂等
+func (s *VoucherOrderService) relayOutbox(ctx context.Context) {
+	entries, err := s.rdb.XRangeN(ctx, orderOutboxKey, "-", "+", orderOutboxBatchSize).Result()
+	if err != nil {
+		s.log.Error("read order outbox failed", zap.Error(err))
+		return
+	}
+	for _, entry := range entries {
+		raw, _ := entry.Values[orderOutboxPayloadField].(string)
+		var payload orderMessage
+		if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+			s.log.Error("drop invalid outbox entry", zap.Error(err), zap.String("id", entry.ID), zap.String("payload", raw))
+			_ = s.rdb.XDel(ctx, orderOutboxKey, entry.ID).Err()
+			s.metrics.ObserveOutbox("dropped")
+			continue
+		}
+		if err := s.publishOrder(ctx, payload); err != nil {
+			s.log.Warn("relay outbox order failed, will retry", zap.Error(err), zap.Int64("orderId", payload.OrderID))
+			return
+		}
+		if err := s.rdb.XDel(ctx, orderOutboxKey, entry.ID).Err(); err != nil {
+			s.log.Error("delete relayed outbox entry failed", zap.Error(err), zap.String("id", entry.ID))
+			return
+		}
+		s.metrics.ObserveOutbox("relayed")
+		s.log.Info("outbox order relayed", zap.Int64("orderId", payload.OrderID), zap.String("id", entry.ID))
+	}
+}
+
+// reportOutboxBacklog 上报 outbox 积压深度与最老消息的等待时间
+func (s *VoucherOrderService) reportOutboxBacklog(ctx context.Context) {
+	depth, err := s.rdb.XLen(ctx, orderOutboxKey).Result()
+	if err != nil {
+		return
+	}
+	var age time.Duration
+	if depth > 0 {
+		oldest, err := s.rdb.XRangeN(ctx, orderOutboxKey, "-", "+", 1).Result()
+		if err == nil && len(oldest) > 0 {
+			age = time.Since(streamIDTime(oldest[0].ID))
+		}
+	}
+	s.metrics.SetOutboxBacklog(depth, age)
+}
+
+// streamIDTime 解析 Stream 消息 ID（<毫秒时间戳>-<序号>）中的写入时间
+func streamIDTime(id string) time.Time {
+	ms, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.UnixMilli(ms)
+}
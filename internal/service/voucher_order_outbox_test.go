@@ -0,0 +1,18 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// TestStreamIDTime 验证从 Stream 消息 ID 解析写入时间
+func TestStreamIDTime(t *testing.T) {
+	got := streamIDTime("1700000000123-7")
+	if want := time.UnixMilli(1700000000123); !got.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	// 非法 ID 返回当前时间，年龄按 0 处理
+	if d := time.Since(streamIDTime("bad-id")); d < 0 || d > time.Second {
+		t.Fatalf("expected now for invalid id, got %v ago", d)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+
+	"hmdp-backend/internal/utils"
+)
+
+const (
+	orderRetryQueueKey     = "seckill:order:retry"       // 等待重试的订单消息（ZSet，score 为到期时间）
+	orderRetryLockKey      = "seckill:order:retry:relay" // 多实例下同一时刻只有一个实例搬运到期消息
+	orderRetryPollInterval = 200 * time.Millisecond
+	orderRetryBatchSize    = 100
+	orderRetryLockTTL      = 30 * time.Second
+)
+
+// scheduleRetry 将待重试消息写入延迟队列，到期后由 runRetryScheduler 投递到重试 Topic
+// 重试 Topic 中的消息都已到期，消费端无需等待，不会被队头的长退避阻塞
+func (s *VoucherOrderService) scheduleRetry(ctx context.Context, payload orderMessage, at time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.retryQueue.Push(ctx, string(data), at)
+}
+
+// runRetryScheduler 轮询延迟队列，把到期的重试消息投递到重试 Topic
+func (s *VoucherOrderService) runRetryScheduler(ctx context.Context) {
+	s.log.Info("order retry scheduler started")
+	ticker := time.NewTicker(orderRetryPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 本轮投递与释放锁不随停机中断
+			tickCtx := context.WithoutCancel(ctx)
+			lock := utils.NewRedisLock(s.rdb, orderRetryLockKey, orderRetryLockTTL)
+			ok, err := lock.TryLock(tickCtx)
+			if err != nil || !ok {
+				continue
+			}
+			s.relayDueRetries(tickCtx)
+			_ = lock.Unlock(tickCtx)
+		}
+	}
+}
+
+// relayDueRetries 投递一批到期消息，投递成功后才从延迟队列删除
+// 投递成功但删除前宕机会重复投递，消费端以订单 ID 幂等
+func (s *VoucherOrderService) relayDueRetries(ctx context.Context) {
+	members, err := s.retryQueue.PeekDue(ctx, time.Now(), orderRetryBatchSize)
+	if err != nil {
+		s.log.Error("peek due retries failed", zap.Error(err))
+		return
+	}
+	for _, member := range members {
+		var payload orderMessage
+		if err := json.Unmarshal([]byte(member), &payload); err != nil {
+			s.log.Error("drop invalid retry message", zap.Error(err), zap.String("payload", member))
+			_ = s.retryQueue.Remove(ctx, member)
+			continue
+		}
+		if err := s.publishRetry(ctx, payload); err != nil {
+			// Kafka 不可用，保留在队列中下一轮再试
+			return
+		}
+		if err := s.retryQueue.Remove(ctx, member); err != nil {
+			s.log.Error("remove relayed retry failed", zap.Error(err), zap.Int64("orderId", payload.OrderID))
+			return
+		}
+	}
+}
@@ -3,30 +3,41 @@ package service
 import (
 	"context"
 	_ "embed"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/redis/go-redis/v9"
-	"github.com/segmentio/kafka-go"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/lifecycle"
 	"hmdp-backend/internal/model"
 	"hmdp-backend/internal/observability"
 	"hmdp-backend/internal/utils"
 )
 
 const (
-	stockKeyFmt  = "seckill:stock:vid:%d"
-	orderSetFmt  = "order:vid:%d"
+	stockKeyFmt      = "seckill:stock:vid:%d"
+	orderCountKeyFmt = "order:cnt:vid:%d" // 用户已购数量（Hash：userId -> 数量）
+	// legacyOrderKeyFmt 旧版已下单用户 Set（每人一单），迁移窗口内秒杀与补偿脚本仍会读取，
+	// 命中后迁移到 orderCountKeyFmt；线上 order:vid:* 全部清空后可删除兼容逻辑
+	legacyOrderKeyFmt = "order:vid:%d"
+	// orderCompensatedKeyFmt 消费端补偿标记（订单 ID + 重放次数），保证同一次投递只归还一次库存
+	orderCompensatedKeyFmt = "seckill:order:compensated:%d:%d"
+	orderCompensatedTTL    = 24 * time.Hour
+	// orderCancelRestoredKeyFmt 超时取消后归还 Redis 的标记（订单 ID），取消后重复执行归还时只生效一次
+	orderCancelRestoredKeyFmt = "seckill:order:cancel-restored:%d"
+	orderCancelRestoredTTL    = 7 * 24 * time.Hour
 )
 
 var errRetryEnqueued = errors.New("retry enqueued")
@@ -34,68 +45,138 @@ var errRetryEnqueued = errors.New("retry enqueued")
 //go:embed seckill.lua
 var seckillLuaSource string
 
+//go:embed seckill_compensate.lua
+var seckillCompensateLuaSource string
+
+var seckillCompensateLua = redis.NewScript(seckillCompensateLuaSource)
+
 // VoucherOrderService 处理秒杀下单逻辑
 type VoucherOrderService struct {
 	db          *gorm.DB
 	rdb         *redis.Client
 	idWorker    *utils.RedisIdWorker
 	seckillLua  *redis.Script
-	writer      *kafka.Writer
-	retryWriter *kafka.Writer
-	dlqWriter   *kafka.Writer
-	reader      *kafka.Reader
-	retryReader *kafka.Reader
-	dlqReader   *kafka.Reader
+	producer      Producer
+	retryProducer Producer
+	dlqProducer   Producer
+	consumer      Consumer
+	retryConsumer Consumer
+	dlqConsumer   Consumer
 	smtpCfg     utils.SMTPConfig
 	metrics     *observability.SeckillMetrics
 	log         *zap.Logger
+	// 未支付订单超时取消
+	payTimeout   time.Duration
+	timeoutQueue *redisDelayQueue
+	// 重试延迟队列
+	retryQueue *redisDelayQueue
+	// 秒杀券元数据缓存未命中时合并回源
+	metaGroup singleflight.Group
+	// 库存对账
+	reconcileInterval   time.Duration
+	reconcileAutoRepair bool
+	// 订单消费凑批
+	batchSize int
+	batchWait time.Duration
+	// 每个 reader 的并行 lane 数
+	consumeConcurrency int
+	// 本机等待订单结果推送的连接
+	events *orderEventHub
 }
 
 func NewVoucherOrderService(
 	db *gorm.DB,
 	rdb *redis.Client,
-	writer *kafka.Writer,
-	retryWriter *kafka.Writer,
-	dlqWriter *kafka.Writer,
-	reader *kafka.Reader,
-	retryReader *kafka.Reader,
-	dlqReader *kafka.Reader,
+	producer Producer,
+	retryProducer Producer,
+	dlqProducer Producer,
+	consumer Consumer,
+	retryConsumer Consumer,
+	dlqConsumer Consumer,
 	smtpCfg utils.SMTPConfig,
+	seckillCfg config.SeckillConfig,
 	metrics *observability.SeckillMetrics,
 	log *zap.Logger,
 ) *VoucherOrderService {
 	if log == nil {
 		log = zap.NewNop()
 	}
+	payTimeout := seckillCfg.PayTimeout
+	if payTimeout <= 0 {
+		payTimeout = defaultOrderPayTimeout
+	}
+	reconcileInterval := seckillCfg.ReconcileInterval
+	if reconcileInterval == 0 {
+		reconcileInterval = defaultReconcileInterval
+	}
+	batchSize := seckillCfg.ConsumeBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultConsumeBatchSize
+	}
+	batchWait := seckillCfg.ConsumeBatchWait
+	if batchWait <= 0 {
+		batchWait = defaultConsumeBatchWait
+	}
+	concurrency := seckillCfg.ConsumeConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultConsumeConcurrency
+	}
 	svc := &VoucherOrderService{
-		db:          db,
-		rdb:         rdb,
-		idWorker:    utils.NewRedisIdWorker(rdb),
-		seckillLua:  redis.NewScript(seckillLuaSource),
-		writer:      writer,
-		retryWriter: retryWriter,
-		dlqWriter:   dlqWriter,
-		reader:      reader,
-		retryReader: retryReader,
-		dlqReader:   dlqReader,
-		smtpCfg:     smtpCfg,
-		metrics:     metrics,
-		log:         log,
+		db:           db,
+		rdb:          rdb,
+		idWorker:     utils.NewRedisIdWorker(rdb),
+		seckillLua:   redis.NewScript(seckillLuaSource),
+		producer:      producer,
+		retryProducer: retryProducer,
+		dlqProducer:   dlqProducer,
+		consumer:      consumer,
+		retryConsumer: retryConsumer,
+		dlqConsumer:   dlqConsumer,
+		smtpCfg:      smtpCfg,
+		metrics:      metrics,
+		log:          log,
+		payTimeout:   payTimeout,
+		timeoutQueue: newRedisDelayQueue(rdb, orderTimeoutKey),
+		retryQueue:   newRedisDelayQueue(rdb, orderRetryQueueKey),
+
+		reconcileInterval:   reconcileInterval,
+		reconcileAutoRepair: seckillCfg.ReconcileAutoRepair,
+		batchSize:           batchSize,
+		batchWait:           batchWait,
+		consumeConcurrency:  concurrency,
+		events:              newOrderEventHub(),
 	}
 	svc.warmupScripts(context.Background())
-	log.Info("voucher order consumers starting")
+	return svc
+}
+
+// Start 将消费者与后台任务交给生命周期管理器，停机时统一取消并等待在途消息处理完成
+func (s *VoucherOrderService) Start(lc *lifecycle.Manager) {
+	s.log.Info("voucher order consumers starting")
 	// 异步消费 Kafka 订单消息
-	go svc.consumeOrders(context.Background())
+	lc.Go("consumeOrders", s.consumeOrders)
 	// 重试队列消费
-	go svc.consumeRetryOrders(context.Background())
+	lc.Go("consumeRetryOrders", s.consumeRetryOrders)
+	// 到期重试消息投递
+	lc.Go("runRetryScheduler", s.runRetryScheduler)
 	// 记录消费延迟（lag）用于监控
-	go svc.logKafkaLag(context.Background())
+	lc.Go("logKafkaLag", s.logKafkaLag)
 	// 死信队列消费 邮件告警
-	if svc.dlqReader != nil {
-		go svc.consumeDLQ(context.Background())
+	if s.dlqConsumer != nil {
+		lc.Go("consumeDLQ", s.consumeDLQ)
+	}
+	// 未支付订单超时取消
+	lc.Go("runOrderTimeoutWorker", s.runOrderTimeoutWorker)
+	// outbox 重新投递
+	lc.Go("runOutboxRelay", s.runOutboxRelay)
+	// 订阅订单结果并推送给本机等待的连接
+	lc.Go("runOrderEvents", s.runOrderEvents)
+	// 定时库存对账
+	if s.reconcileInterval > 0 {
+		lc.Go("runStockReconcileWorker", s.runStockReconcileWorker)
 	}
-	return svc
 }
+
 // warmupScripts 预加载 Lua 脚本到 Redis
 func (s *VoucherOrderService) warmupScripts(ctx context.Context) {
 	if s.rdb == nil || s.seckillLua == nil {
@@ -106,50 +187,12 @@ func (s *VoucherOrderService) warmupScripts(ctx context.Context) {
 	}
 }
 
-// Seckill 秒杀下单
-func (s *VoucherOrderService) Seckill(ctx context.Context, voucherID, userID int64) (int64, error) {
+// Seckill 秒杀下单，quantity 为本次购买数量（<= 0 时按 1 处理）
+func (s *VoucherOrderService) Seckill(ctx context.Context, voucherID, userID int64, quantity int) (int64, error) {
 	start := time.Now()
-	var info struct {
-		ID        int64
-		BeginTime time.Time
-		EndTime   time.Time
-		Stock     int
-		Status    int
-	}
-	// 查询秒杀券信息
-	err := s.db.WithContext(ctx).Table("tb_voucher AS v").
-		Select("v.id, v.status, sv.begin_time, sv.end_time, sv.stock").
-		Joins("LEFT JOIN tb_seckill_voucher sv ON v.id = sv.voucher_id").
-		Where("v.id = ?", voucherID).
-		Take(&info).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		s.metrics.ObserveSeckill("rejected", "not_found", time.Since(start))
-		return 0, errors.New("优惠券不存在")
-	}
-	if err != nil {
-		s.metrics.ObserveSeckill("rejected", "query_error", time.Since(start))
-		return 0, err
-	}
-	if info.Status != 1 {
-		s.metrics.ObserveSeckill("rejected", "inactive", time.Since(start))
-		return 0, errors.New("优惠券已下架或过期")
-	}
-
-	now := time.Now()
-	if now.Before(info.BeginTime) {
-		s.metrics.ObserveSeckill("rejected", "not_started", time.Since(start))
-		return 0, errors.New("秒杀尚未开始")
-	}
-	if now.After(info.EndTime) {
-		s.metrics.ObserveSeckill("rejected", "ended", time.Since(start))
-		return 0, errors.New("秒杀已结束")
-	}
-	// 库存不足直接返回
-	if info.Stock <= 0 {
-		s.metrics.ObserveSeckill("rejected", "no_stock", time.Since(start))
-		return 0, errors.New("库存不足")
+	if quantity <= 0 {
+		quantity = 1
 	}
-
 	// 生成订单ID
 	orderID, err := s.idWorker.NextId(ctx, "order")
 	if err != nil {
@@ -157,28 +200,60 @@ func (s *VoucherOrderService) Seckill(ctx context.Context, voucherID, userID int
 		return 0, err
 	}
 
-	stockKey := fmt.Sprintf(stockKeyFmt, voucherID)
-	orderSetKey := fmt.Sprintf(orderSetFmt, voucherID)
+	keys := []string{
+		fmt.Sprintf(stockKeyFmt, voucherID),
+		fmt.Sprintf(orderCountKeyFmt, voucherID),
+		fmt.Sprintf(voucherMetaKeyFmt, voucherID),
+		fmt.Sprintf(waitingRoomKeyFmt, voucherID),
+		fmt.Sprintf(waitingTicketKeyFmt, voucherID),
+		fmt.Sprintf(legacyOrderKeyFmt, voucherID),
+	}
 
-	// 执行 Lua 脚本，完成库存校验与扣减、用户下单资格校验与标记
-	res, err := s.seckillLua.Run(ctx, s.rdb, []string{stockKey, orderSetKey}, userID).Int()
-	if err != nil {
-		s.metrics.ObserveSeckill("rejected", "lua_error", time.Since(start))
-		return 0, err
+	// 执行 Lua 脚本，完成券状态/时间窗口校验、库存校验与扣减、用户限购校验与已购数量累加
+	// 券元数据缓存在 Redis，正常路径不访问 MySQL；未命中时回源一次后重试
+	var res []int64
+	for attempt := 0; ; attempt++ {
+		res, err = s.seckillLua.Run(ctx, s.rdb, keys, userID, quantity, time.Now().UnixMilli()).Int64Slice()
+		if err != nil {
+			s.metrics.ObserveSeckill("rejected", "lua_error", time.Since(start))
+			return 0, err
+		}
+		if res[0] != 9 || attempt > 0 {
+			break
+		}
+		if err := s.loadVoucherMeta(ctx, voucherID); err != nil {
+			s.metrics.ObserveSeckill("rejected", "query_error", time.Since(start))
+			return 0, err
+		}
 	}
 
-	switch res {
+	switch res[0] {
 	case 0:
 		// Lua 校验成功，发送 Kafka 消息由消费者异步落库
+		createdAt := time.Now().Unix()
 		msg := orderMessage{
-			OrderID:   orderID,
-			UserID:    userID,
-			VoucherID: voucherID,
-			CreatedAt: time.Now().Unix(),
+			OrderID:     orderID,
+			UserID:      userID,
+			VoucherID:   voucherID,
+			Quantity:    quantity,
+			CreatedAt:   createdAt,
+			PayDeadline: s.payDeadline(createdAt, int(res[1])),
 		}
+		s.trackOrderState(ctx, msg, OrderStatePending)
 		if err := s.publishOrder(ctx, msg); err != nil {
-			s.log.Error("publish kafka failed, queued for retry", zap.Error(err), zap.Int64("orderId", orderID))
-			s.metrics.ObserveSeckill("accepted", "publish_failed", time.Since(start))
+			// Kafka 不可用时写入 outbox，由 relay 恢复后重新投递
+			if outboxErr := s.enqueueOutbox(ctx, msg); outboxErr != nil {
+				// outbox 也写入失败，订单无法送达消费端，归还 Redis 库存与下单资格
+				s.log.Error("publish kafka and outbox failed, order rejected",
+					zap.Error(err), zap.NamedError("outboxError", outboxErr), zap.Int64("orderId", orderID))
+				s.compensateRedis(ctx, msg)
+				msg.LastError = err.Error()
+				s.trackOrderState(ctx, msg, OrderStateCompensated)
+				s.metrics.ObserveSeckill("rejected", "publish_failed", time.Since(start))
+				return 0, errors.New("下单失败，请稍后重试")
+			}
+			s.log.Warn("publish kafka failed, queued to outbox", zap.Error(err), zap.Int64("orderId", orderID))
+			s.metrics.ObserveSeckill("accepted", "outboxed", time.Since(start))
 			return orderID, nil
 		}
 		s.metrics.ObserveSeckill("accepted", "ok", time.Since(start))
@@ -187,8 +262,23 @@ func (s *VoucherOrderService) Seckill(ctx context.Context, voucherID, userID int
 		s.metrics.ObserveSeckill("rejected", "no_stock", time.Since(start))
 		return 0, errors.New("库存不足")
 	case 2:
-		s.metrics.ObserveSeckill("rejected", "duplicate", time.Since(start))
-		return 0, errors.New("每人限购一单")
+		s.metrics.ObserveSeckill("rejected", "over_limit", time.Since(start))
+		return 0, errOverPurchaseLimit
+	case 3:
+		s.metrics.ObserveSeckill("rejected", "not_found", time.Since(start))
+		return 0, errors.New("优惠券不存在")
+	case 4:
+		s.metrics.ObserveSeckill("rejected", "inactive", time.Since(start))
+		return 0, errors.New("优惠券已下架或过期")
+	case 5:
+		s.metrics.ObserveSeckill("rejected", "not_started", time.Since(start))
+		return 0, errors.New("秒杀尚未开始")
+	case 6:
+		s.metrics.ObserveSeckill("rejected", "ended", time.Since(start))
+		return 0, errors.New("秒杀已结束")
+	case 7:
+		s.metrics.ObserveSeckill("rejected", "not_admitted", time.Since(start))
+		return 0, ErrNotAdmitted
 	default:
 		s.metrics.ObserveSeckill("rejected", "lua_failed", time.Since(start))
 		return 0, errors.New("秒杀失败")
@@ -199,15 +289,26 @@ type orderMessage struct {
 	OrderID     int64  `json:"orderId"`
 	UserID      int64  `json:"userId"`
 	VoucherID   int64  `json:"voucherId"`
+	Quantity    int    `json:"quantity,omitempty"` // 购买数量，旧消息缺省为 1
 	CreatedAt   int64  `json:"createdAt"`
-	RetryCount  int    `json:"retryCount"`          // 重试次数
-	NextRetryAt int64  `json:"nextRetryAt"`         // 下次重试时间（秒）
-	LastError   string `json:"lastError,omitempty"` // 最后一次错误信息
+	PayDeadline int64  `json:"payDeadline,omitempty"` // 支付截止时间（秒），超时未支付自动取消
+	RetryCount  int    `json:"retryCount"`            // 重试次数
+	NextRetryAt int64  `json:"nextRetryAt"`           // 下次重试时间（秒）
+	LastError   string `json:"lastError,omitempty"`   // 最后一次错误信息
+	ReplayCount int    `json:"replayCount,omitempty"` // 死信重放次数
+}
+
+// orderQuantity 返回订单购买数量，兼容未携带 quantity 的旧消息
+func (m orderMessage) orderQuantity() int {
+	if m.Quantity <= 0 {
+		return 1
+	}
+	return m.Quantity
 }
 
 // publishOrder 将订单消息发送到 Kafka
 func (s *VoucherOrderService) publishOrder(ctx context.Context, msg orderMessage) error {
-	return s.publishKafkaMessage(ctx, s.writer, msg, "")
+	return s.publishMessage(ctx, s.producer, msg, "")
 }
 
 type consumeOutcome int
@@ -219,33 +320,41 @@ const (
 )
 
 // consumeLoop 通用消费循环：负责拉取消息、反序列化、埋点与提交 offset 具体业务由 handler(hui diao) 处理
+// 消息按 voucherId 分发到多个 lane 并行处理，同券消息保持顺序
 func (s *VoucherOrderService) consumeLoop(
 	ctx context.Context,
-	reader *kafka.Reader,
+	consumer Consumer,
 	name string,
-	handler func(context.Context, orderMessage, kafka.Message, string, time.Time, trace.Span) (consumeOutcome, error),
+	handler func(context.Context, orderMessage, Message, string, time.Time, trace.Span) (consumeOutcome, error),
 ) {
-	s.log.Info(fmt.Sprintf("%s started", name))
-	for {
-		msg, err := reader.FetchMessage(ctx)
-		if err != nil {
-			s.log.Error(fmt.Sprintf("%s fetch message error", name), zap.Error(err))
-			time.Sleep(time.Second)
-			continue
-		}
-
-		var payload orderMessage
-		if err := json.Unmarshal(msg.Value, &payload); err != nil {
-			s.log.Error(fmt.Sprintf("%s parse message error", name), zap.Error(err))
-			_ = reader.CommitMessages(ctx, msg)
-			continue
+	s.dispatchLoop(ctx, consumer, name, 1, func(ctx, msgCtx context.Context, msgs []Message) []Message {
+		for i, msg := range msgs {
+			if !s.consumeMessage(ctx, msgCtx, name, msg, handler) {
+				return msgs[:i]
+			}
 		}
+		return msgs
+	})
+}
 
-		topic := msg.Topic
-		if topic == "" {
-			topic = "unknown"
-		}
-		consumeCtx := observability.ExtractKafkaContext(ctx, msg.Headers)
+// consumeMessage 处理单条消息，返回 true 表示可以提交 offset
+// handler 返回 consumeError 时原地退避重试，不越过该消息提交；停机时返回 false，消息由下一个实例重新消费
+func (s *VoucherOrderService) consumeMessage(
+	ctx, msgCtx context.Context,
+	name string,
+	msg Message,
+	handler func(context.Context, orderMessage, Message, string, time.Time, trace.Span) (consumeOutcome, error),
+) bool {
+	topic := msg.Topic
+	if topic == "" {
+		topic = "unknown"
+	}
+	payload, env, err := decodeOrderMessage(msg.Value)
+	if err != nil {
+		return s.handlePoison(ctx, msgCtx, name, msg, env, err)
+	}
+	for {
+		consumeCtx := observability.ExtractMessageContext(msgCtx, msg.Headers)
 		consumeCtx, span := s.startKafkaConsumeSpan(consumeCtx, topic)
 		start := time.Now()
 
@@ -262,10 +371,7 @@ func (s *VoucherOrderService) consumeLoop(
 				zap.Int64("voucherId", payload.VoucherID),
 			)
 			span.End()
-			if err := reader.CommitMessages(ctx, msg); err != nil {
-				s.log.Error(fmt.Sprintf("%s commit error", name), zap.Error(err), zap.Int64("orderId", payload.OrderID))
-			}
-			continue
+			return true
 		case consumeError:
 			s.metrics.ObserveKafkaConsume(topic, "error", time.Since(start))
 			if err != nil {
@@ -274,40 +380,37 @@ func (s *VoucherOrderService) consumeLoop(
 				s.log.Error(fmt.Sprintf("%s handle error", name), zap.Int64("orderId", payload.OrderID), zap.Int64("voucherId", payload.VoucherID))
 			}
 			span.End()
-			time.Sleep(200 * time.Millisecond)
-			continue
+			if !lifecycle.Sleep(ctx, consumeErrorBackoff) {
+				return false
+			}
 		default:
 			s.metrics.ObserveKafkaConsume(topic, "success", time.Since(start))
 			span.End()
-			if err := reader.CommitMessages(ctx, msg); err != nil {
-				s.log.Error(fmt.Sprintf("%s commit error", name), zap.Error(err), zap.Int64("orderId", payload.OrderID))
-			}
+			return true
 		}
 	}
 }
 
-// consumeOrders 异步创建订单（Kafka 消费端）
-func (s *VoucherOrderService) consumeOrders(ctx context.Context) {
-	s.consumeLoop(ctx, s.reader, "consumeOrders", func(consumeCtx context.Context, payload orderMessage, _ kafka.Message, _ string, _ time.Time, _ trace.Span) (consumeOutcome, error) {
-		if err := s.handleConsume(consumeCtx, payload); err != nil {
-			if errors.Is(err, errRetryEnqueued) {
-				return consumeRetryEnqueued, err
-			}
-			return consumeError, err
-		}
-		return consumeSuccess, nil
-	})
+// isFetchStopped 判断拉取失败是否因为停机：ctx 已取消或消费者已关闭（io.EOF）
+func isFetchStopped(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, io.EOF)
 }
 
 // consumeRetryOrders 消费重试 Topic，按回退时间再次执行
 func (s *VoucherOrderService) consumeRetryOrders(ctx context.Context) {
-	s.consumeLoop(ctx, s.retryReader, "consumeRetryOrders", func(consumeCtx context.Context, payload orderMessage, _ kafka.Message, _ string, _ time.Time, _ trace.Span) (consumeOutcome, error) {
+	s.consumeLoop(ctx, s.retryConsumer, "consumeRetryOrders", func(consumeCtx context.Context, payload orderMessage, _ Message, _ string, _ time.Time, _ trace.Span) (consumeOutcome, error) {
 		s.log.Info("consumeRetryOrders received",
 			zap.Int64("orderId", payload.OrderID),
 			zap.Int64("voucherId", payload.VoucherID),
 			zap.Int("retryCount", payload.RetryCount),
 			zap.Int64("nextRetryAt", payload.NextRetryAt),
 		)
+		// 未到重试时间（延迟队列不可用时直接投递的消息）重新排期，不阻塞分区内后续消息
+		if retryAt := time.Unix(payload.NextRetryAt, 0); payload.NextRetryAt > 0 && time.Now().Before(retryAt) {
+			if err := s.scheduleRetry(consumeCtx, payload, retryAt); err == nil {
+				return consumeRetryEnqueued, nil
+			}
+		}
 		if err := s.handleConsume(consumeCtx, payload); err != nil {
 			if errors.Is(err, errRetryEnqueued) {
 				return consumeRetryEnqueued, err
@@ -320,7 +423,11 @@ func (s *VoucherOrderService) consumeRetryOrders(ctx context.Context) {
 
 // consumeDLQ 消费死信队列 发送邮件告警
 func (s *VoucherOrderService) consumeDLQ(ctx context.Context) {
-	s.consumeLoop(ctx, s.dlqReader, "consumeDLQ", func(_ context.Context, payload orderMessage, _ kafka.Message, _ string, _ time.Time, span trace.Span) (consumeOutcome, error) {
+	s.consumeLoop(ctx, s.dlqConsumer, "consumeDLQ", func(consumeCtx context.Context, payload orderMessage, msg Message, _ string, _ time.Time, span trace.Span) (consumeOutcome, error) {
+		// 先落表供管理端查询与重放，失败时不提交 offset，等待重新消费
+		if err := s.persistDLQ(consumeCtx, payload, msg.Value); err != nil {
+			return consumeError, err
+		}
 		if s.smtpCfg.Host != "" {
 			subject := fmt.Sprintf("[DLQ] seckill order failed: %d", payload.OrderID)
 			body := fmt.Sprintf(
@@ -348,16 +455,6 @@ func (s *VoucherOrderService) consumeDLQ(ctx context.Context) {
 // handleConsume 处理订单消息，失败则进入重试或死信
 func (s *VoucherOrderService) handleConsume(ctx context.Context, payload orderMessage) error {
 	start := time.Now()
-	// 延迟重试处理
-	if payload.NextRetryAt > 0 {
-		// 计算距离NextRetryAt时间点还有多久
-		delay := time.Until(time.Unix(payload.NextRetryAt, 0))
-		// 大于0 代表还没有到重试时间 等delay时间后再继续处理
-		if delay > 0 {
-			time.Sleep(delay)
-		}
-	}
-
 	// 创建订单事务
 	if err := s.createOrderTx(ctx, payload); err != nil {
 		s.log.Warn("handleConsume failed",
@@ -369,6 +466,16 @@ func (s *VoucherOrderService) handleConsume(ctx context.Context, payload orderMe
 		// 失败则进入重试队列
 		return s.publishRetryOrDLQ(ctx, payload, err)
 	}
+	return s.onOrderPersisted(ctx, payload, start)
+}
+
+// onOrderPersisted 订单落库成功，登记超时未支付自动取消任务并更新下单状态
+// 登记失败时返回错误，消息不提交、原地重试（重复插入按已处理返回），避免未支付订单永远占用库存
+func (s *VoucherOrderService) onOrderPersisted(ctx context.Context, payload orderMessage, start time.Time) error {
+	if err := s.scheduleOrderTimeout(ctx, payload); err != nil {
+		return err
+	}
+	s.trackOrderState(ctx, payload, OrderStatePersisted)
 	s.log.Info("handleConsume success",
 		zap.Int64("orderId", payload.OrderID),
 		zap.Int64("voucherId", payload.VoucherID),
@@ -378,6 +485,7 @@ func (s *VoucherOrderService) handleConsume(ctx context.Context, payload orderMe
 	)
 	return nil
 }
+
 // retryPhaseLabel 返回重试阶段标签
 func retryPhaseLabel(retryCount int) string {
 	switch retryCount {
@@ -398,7 +506,9 @@ func retryPhaseLabel(retryCount int) string {
 func (s *VoucherOrderService) publishRetryOrDLQ(ctx context.Context, payload orderMessage, err error) error {
 	// 业务失败不重试，直接补偿 Redis
 	if !isRetryableErr(err) {
-		s.compensateRedis(ctx, payload)
+		s.compensateRedisOnce(ctx, payload)
+		payload.LastError = err.Error()
+		s.trackOrderState(ctx, payload, OrderStateCompensated)
 		s.log.Info("对于业务错误，跳过重试", zap.Error(err), zap.Int64("orderId", payload.OrderID))
 		return errRetryEnqueued
 	}
@@ -409,7 +519,8 @@ func (s *VoucherOrderService) publishRetryOrDLQ(ctx context.Context, payload ord
 	backoff := retryBackoff(payload.RetryCount)
 	// 未超过最大重试次数 则写入重试 Topic
 	if payload.RetryCount <= maxRetryCount {
-		payload.NextRetryAt = time.Now().Add(backoff).Unix()
+		retryAt := time.Now().Add(backoff)
+		payload.NextRetryAt = retryAt.Unix()
 		s.log.Info("publish to retry",
 			zap.Int64("orderId", payload.OrderID),
 			zap.Int64("voucherId", payload.VoucherID),
@@ -417,13 +528,18 @@ func (s *VoucherOrderService) publishRetryOrDLQ(ctx context.Context, payload ord
 			zap.Int64("nextRetryAt", payload.NextRetryAt),
 		)
 		s.metrics.ObserveRetry("retry")
-		if err := s.publishRetry(ctx, payload); err != nil {
-			return err
+		s.trackOrderState(ctx, payload, OrderStateRetrying)
+		// 写入延迟队列，到期后再投递重试 Topic；写入失败时直接投递，由重试消费端重新排期
+		if err := s.scheduleRetry(ctx, payload, retryAt); err != nil {
+			s.log.Warn("schedule retry failed, publish directly", zap.Error(err), zap.Int64("orderId", payload.OrderID))
+			if err := s.publishRetry(ctx, payload); err != nil {
+				return err
+			}
 		}
 		return errRetryEnqueued
 	}
-	// 重试耗尽 补偿 Redis 后进入死信
-	s.compensateRedis(ctx, payload)
+	// 重试耗尽进入死信，写入成功后再补偿 Redis
+	// 写入失败时消息原地退避重试，不能每次都归还库存
 	s.log.Info("publish to dlq",
 		zap.Int64("orderId", payload.OrderID),
 		zap.Int64("voucherId", payload.VoucherID),
@@ -433,37 +549,41 @@ func (s *VoucherOrderService) publishRetryOrDLQ(ctx context.Context, payload ord
 	if err := s.publishDLQ(ctx, payload); err != nil {
 		return err
 	}
+	s.compensateRedisOnce(ctx, payload)
+	s.trackOrderState(ctx, payload, OrderStateDeadLettered)
 	return errRetryEnqueued
 }
 
 // publishRetry 写入 Kafka 重试 Topic
 func (s *VoucherOrderService) publishRetry(ctx context.Context, payload orderMessage) error {
-	return s.publishKafkaMessage(ctx, s.retryWriter, payload, "publish retry failed")
+	return s.publishMessage(ctx, s.retryProducer, payload, "publish retry failed")
 }
 
 // publishDLQ 写入 Kafka 死信 Topic - 后续人工读取DLQ做补偿处理或报警
 func (s *VoucherOrderService) publishDLQ(ctx context.Context, payload orderMessage) error {
-	return s.publishKafkaMessage(ctx, s.dlqWriter, payload, "publish dlq failed")
+	return s.publishMessage(ctx, s.dlqProducer, payload, "publish dlq failed")
 }
-// publishKafkaMessage 写入消息到kafka
-func (s *VoucherOrderService) publishKafkaMessage(ctx context.Context, writer *kafka.Writer, payload orderMessage, errorMsg string) error {
-	data, err := json.Marshal(payload)
+
+// publishMessage 写入消息到消息队列
+func (s *VoucherOrderService) publishMessage(ctx context.Context, producer Producer, payload orderMessage, errorMsg string) error {
+	data, err := encodeEnvelope(messageTypeOrder, producerVoucherOrder, orderMessageID(payload), payload)
 	if err != nil {
 		return err
 	}
-	message := kafka.Message{
+	message := Message{
 		// 使用 voucherId 作为 key，保证同券消息落到同一分区
-		Key:   []byte(strconv.FormatInt(payload.VoucherID, 10)),
-		Value: data,
+		Key:     []byte(strconv.FormatInt(payload.VoucherID, 10)),
+		Value:   data,
+		Headers: map[string]string{},
 	}
-	topic := writer.Topic
+	topic := producer.Topic()
 	if topic == "" {
 		topic = "unknown"
 	}
 	spanCtx, span := s.startKafkaProduceSpan(ctx, topic)
 	defer span.End()
-	observability.InjectKafkaHeaders(spanCtx, &message.Headers)
-	if err := writer.WriteMessages(spanCtx, message); err != nil {
+	observability.InjectMessageHeaders(spanCtx, message.Headers)
+	if err := producer.Publish(spanCtx, message); err != nil {
 		span.RecordError(err)
 		if errorMsg != "" {
 			s.log.Error(errorMsg, zap.Error(err), zap.Int64("orderId", payload.OrderID))
@@ -475,9 +595,8 @@ func (s *VoucherOrderService) publishKafkaMessage(ctx context.Context, writer *k
 	return nil
 }
 
-// createOrderTx 在事务内创建订单并扣减库存
-func (s *VoucherOrderService) createOrderTx(ctx context.Context, payload orderMessage) error {
-	// TEST-ONLY：创建订单时 强制消费失败，用于验证 retry/DLQ 流程 - 可控制失败次数
+// forcedConsumeFailure TEST-ONLY：创建订单时 强制消费失败，用于验证 retry/DLQ 流程 - 可控制失败次数
+func forcedConsumeFailure(payload orderMessage) error {
 	if failCount := os.Getenv("FORCE_SECKILL_CONSUME_FAIL_COUNT"); failCount != "" {
 		if n, err := strconv.Atoi(failCount); err == nil && n >= 0 {
 			if payload.RetryCount < n {
@@ -485,6 +604,14 @@ func (s *VoucherOrderService) createOrderTx(ctx context.Context, payload orderMe
 			}
 		}
 	}
+	return nil
+}
+
+// createOrderTx 在事务内创建订单并扣减库存
+func (s *VoucherOrderService) createOrderTx(ctx context.Context, payload orderMessage) error {
+	if err := forcedConsumeFailure(payload); err != nil {
+		return err
+	}
 
 	nowTime := time.Now()
 	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
@@ -492,8 +619,9 @@ func (s *VoucherOrderService) createOrderTx(ctx context.Context, payload orderMe
 			ID:         payload.OrderID,
 			UserID:     payload.UserID,
 			VoucherID:  payload.VoucherID,
+			Quantity:   payload.orderQuantity(),
 			PayType:    1,
-			Status:     1,
+			Status:     model.VoucherOrderStatusUnpaid,
 			CreateTime: nowTime,
 			UpdateTime: nowTime,
 		}
@@ -505,11 +633,12 @@ func (s *VoucherOrderService) createOrderTx(ctx context.Context, payload orderMe
 			return err
 		}
 		// 订单创建成功后再扣减库存，避免重复消费导致多次扣减
-		// SQL - UPDATE ... SET stock = stock - 1 WHERE stock > 0;
+		// SQL - UPDATE ... SET stock = stock - n WHERE stock >= n;
 		// 这是一条原子SQL UPDATE ... WHERE ... 执行时会对目标行加锁
+		quantity := payload.orderQuantity()
 		res := tx.Model(&model.SeckillVoucher{}).
-			Where("voucher_id = ? AND stock > 0", payload.VoucherID).
-			Update("stock", gorm.Expr("stock - 1"))
+			Where("voucher_id = ? AND stock >= ?", payload.VoucherID, quantity).
+			Update("stock", gorm.Expr("stock - ?", quantity))
 		if res.Error != nil {
 			return res.Error
 		}
@@ -517,7 +646,7 @@ func (s *VoucherOrderService) createOrderTx(ctx context.Context, payload orderMe
 			return errDBStockNotEnough
 		}
 		return nil
-	}); err != nil { 
+	}); err != nil {
 		return err
 	}
 	return nil
@@ -533,9 +662,8 @@ func (s *VoucherOrderService) logKafkaLag(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			stats := s.reader.Stats()
 			// lag 用于监控消费延迟
-			s.log.Info("kafka consumer lag", zap.Int64("lag", stats.Lag))
+			s.log.Info("kafka consumer lag", zap.Int64("lag", s.consumer.Lag()))
 		}
 	}
 }
@@ -544,6 +672,8 @@ const maxRetryCount = 3
 
 var errDBStockNotEnough = errors.New("db stock not enough")
 
+var errOverPurchaseLimit = errors.New("超出每人限购数量")
+
 // isRetryableErr 判断该错误是否需要重试
 func isRetryableErr(err error) bool {
 	if errors.Is(err, errDBStockNotEnough) {
@@ -551,16 +681,34 @@ func isRetryableErr(err error) bool {
 	}
 	return true
 }
-// compensateRedis 补偿 Redis 库存和用户下单资格
+
+// compensateRedis 按购买数量补偿 Redis 库存和用户已购数量
 func (s *VoucherOrderService) compensateRedis(ctx context.Context, payload orderMessage) {
-	stockKey := fmt.Sprintf(stockKeyFmt, payload.VoucherID)
-	orderSetKey := fmt.Sprintf(orderSetFmt, payload.VoucherID)
-	// 管道补偿操作
-	_, _ = s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
-		pipe.Incr(ctx, stockKey)
-		pipe.SRem(ctx, orderSetKey, payload.UserID)
-		return nil
-	})
+	_ = s.runCompensate(ctx, payload, "", 0)
+}
+
+// compensateRedisOnce 消费端补偿：同一订单的同一次投递（按重放次数区分）只补偿一次，
+// 消息被重复消费或处理中宕机后重新消费时不会重复归还库存
+func (s *VoucherOrderService) compensateRedisOnce(ctx context.Context, payload orderMessage) {
+	_ = s.runCompensate(ctx, payload, fmt.Sprintf(orderCompensatedKeyFmt, payload.OrderID, payload.ReplayCount), orderCompensatedTTL)
+}
+
+// runCompensate 执行补偿脚本；markerKey 非空时标记与归还在同一个 Lua 中原子写入，同一标记只归还一次
+func (s *VoucherOrderService) runCompensate(ctx context.Context, payload orderMessage, markerKey string, markerTTL time.Duration) error {
+	keys := []string{
+		fmt.Sprintf(stockKeyFmt, payload.VoucherID),
+		fmt.Sprintf(orderCountKeyFmt, payload.VoucherID),
+		fmt.Sprintf(legacyOrderKeyFmt, payload.VoucherID),
+	}
+	if markerKey != "" {
+		keys = append(keys, markerKey)
+	}
+	// Lua 保证归还库存与扣回已购数量原子执行
+	if err := seckillCompensateLua.Run(ctx, s.rdb, keys, payload.UserID, payload.orderQuantity(), int64(markerTTL.Seconds())).Err(); err != nil {
+		s.log.Error("compensate redis failed", zap.Error(err), zap.Int64("orderId", payload.OrderID))
+		return err
+	}
+	return nil
 }
 
 // retryBackoff 重试回退时间，指数增长，最大 30 秒
@@ -586,6 +734,7 @@ func isDuplicateKey(err error) bool {
 	}
 	return false
 }
+
 // startKafkaProduceSpan 为 Kafka 生产操作创建 OpenTelemetry Span
 func (s *VoucherOrderService) startKafkaProduceSpan(ctx context.Context, topic string) (context.Context, trace.Span) {
 	if topic == "" {
@@ -600,6 +749,7 @@ func (s *VoucherOrderService) startKafkaProduceSpan(ctx context.Context, topic s
 		),
 	)
 }
+
 // startKafkaConsumeSpan 为 Kafka 消费操作创建 OpenTelemetry Span
 func (s *VoucherOrderService) startKafkaConsumeSpan(ctx context.Context, topic string) (context.Context, trace.Span) {
 	if topic == "" {
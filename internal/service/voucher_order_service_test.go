@@ -10,6 +10,8 @@ import (
 	"testing"
 	"time"
 
+	"hmdp-backend/internal/config"
+	"hmdp-backend/internal/lifecycle"
 	"hmdp-backend/internal/model"
 	"hmdp-backend/internal/utils"
 
@@ -21,7 +23,21 @@ import (
 	"gorm.io/gorm"
 )
 
-func newTestKafka(t *testing.T, ctx context.Context) (*kafka.Writer, *kafka.Writer, *kafka.Writer, *kafka.Reader, *kafka.Reader, func()) {
+// startTestWorkers 启动消费者与后台任务，返回的函数在关闭消息队列连接前停止它们
+func startTestWorkers(t *testing.T, svc *VoucherOrderService) func() {
+	t.Helper()
+	lc := lifecycle.NewManager(newTestLogger(t))
+	svc.Start(lc)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := lc.Stop(ctx); err != nil {
+			t.Errorf("stop workers: %v", err)
+		}
+	}
+}
+
+func newTestKafka(t *testing.T, ctx context.Context) (Producer, Producer, Producer, Consumer, Consumer, func()) {
 	t.Helper()
 	broker := os.Getenv("TEST_KAFKA_BROKER")
 	if broker == "" {
@@ -101,7 +117,7 @@ func newTestKafka(t *testing.T, ctx context.Context) (*kafka.Writer, *kafka.Writ
 		_ = reader.Close()
 		_ = retryReader.Close()
 	}
-	return writer, retryWriter, dlqWriter, reader, retryReader, cleanup
+	return NewKafkaProducer(writer), NewKafkaProducer(retryWriter), NewKafkaProducer(dlqWriter), NewKafkaConsumer(reader), NewKafkaConsumer(retryReader), cleanup
 }
 
 func newTestLogger(t *testing.T) *zap.Logger {
@@ -165,7 +181,8 @@ func TestSeckillNoOversell(t *testing.T) {
 	writer, retryWriter, dlqWriter, reader, retryReader, cleanup := newTestKafka(t, ctx)
 	defer cleanup()
 
-	svc := NewVoucherOrderService(db, rdb, writer, retryWriter, dlqWriter, reader, retryReader, nil, utils.SMTPConfig{}, nil, newTestLogger(t))
+	svc := NewVoucherOrderService(db, rdb, writer, retryWriter, dlqWriter, reader, retryReader, nil, utils.SMTPConfig{}, config.SeckillConfig{}, nil, newTestLogger(t))
+	defer startTestWorkers(t, svc)()
 
 	// 使用现有的券 ID
 	const voucherID = int64(12)
@@ -185,6 +202,8 @@ func TestSeckillNoOversell(t *testing.T) {
 		}).Error; err != nil {
 		t.Fatalf("prepare seckill voucher: %v", err)
 	}
+	// DB 直接修改后清除元数据缓存
+	_ = rdb.Del(ctx, fmt.Sprintf(voucherMetaKeyFmt, voucherID)).Err()
 
 	// 并发请求
 	const workers = 200
@@ -197,7 +216,7 @@ func TestSeckillNoOversell(t *testing.T) {
 			defer wg.Done()
 			// 每个请求使用不同的 userId，避免潜在的唯一约束
 			userID := int64(1000 + idx)
-			if _, err := svc.Seckill(ctx, voucherID, userID); err == nil {
+			if _, err := svc.Seckill(ctx, voucherID, userID, 1); err == nil {
 				// 原子自增计数
 				atomic.AddInt64(&success, 1)
 			}
@@ -252,7 +271,8 @@ func TestSeckillOneOrderPerUser(t *testing.T) {
 	writer, retryWriter, dlqWriter, reader, retryReader, cleanup := newTestKafka(t, ctx)
 	defer cleanup()
 
-	svc := NewVoucherOrderService(db, rdb, writer, retryWriter, dlqWriter, reader, retryReader, nil, utils.SMTPConfig{}, nil, newTestLogger(t))
+	svc := NewVoucherOrderService(db, rdb, writer, retryWriter, dlqWriter, reader, retryReader, nil, utils.SMTPConfig{}, config.SeckillConfig{}, nil, newTestLogger(t))
+	defer startTestWorkers(t, svc)()
 
 	const voucherID = int64(12)
 
@@ -265,7 +285,7 @@ func TestSeckillOneOrderPerUser(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if _, err := svc.Seckill(ctx, voucherID, userID); err == nil {
+			if _, err := svc.Seckill(ctx, voucherID, userID, 1); err == nil {
 				atomic.AddInt64(&success, 1)
 			}
 		}()
@@ -312,12 +332,13 @@ func TestSeckillSingleUserRedisFlow(t *testing.T) {
 	writer, retryWriter, dlqWriter, reader, retryReader, cleanup := newTestKafka(t, ctx)
 	defer cleanup()
 
-	svc := NewVoucherOrderService(db, rdb, writer, retryWriter, dlqWriter, reader, retryReader, nil, utils.SMTPConfig{}, nil, newTestLogger(t))
+	svc := NewVoucherOrderService(db, rdb, writer, retryWriter, dlqWriter, reader, retryReader, nil, utils.SMTPConfig{}, config.SeckillConfig{}, nil, newTestLogger(t))
+	defer startTestWorkers(t, svc)()
 
 	const voucherID = int64(12)
 	const userID = int64(2)
 
-	orderID, err := svc.Seckill(ctx, voucherID, userID)
+	orderID, err := svc.Seckill(ctx, voucherID, userID, 1)
 	if err != nil {
 		t.Fatalf("seckill failed: %v", err)
 	}
@@ -369,10 +390,12 @@ func TestSeckillKafkaDownWritesRetry(t *testing.T) {
 		}).Error; err != nil {
 		t.Fatalf("prepare seckill voucher: %v", err)
 	}
+	// DB 直接修改后清除元数据缓存
+	_ = rdb.Del(ctx, fmt.Sprintf(voucherMetaKeyFmt, voucherID)).Err()
 
 	// 预热 Redis 库存与限购集合，并清理补偿队列
 	_ = rdb.Set(ctx, fmt.Sprintf(stockKeyFmt, voucherID), 100, 0).Err()
-	_ = rdb.Del(ctx, fmt.Sprintf(orderSetFmt, voucherID)).Err()
+	_ = rdb.Del(ctx, fmt.Sprintf(orderCountKeyFmt, voucherID)).Err()
 
 	// 构造不可用的 Kafka 连接，模拟写入失败
 	writer := &kafka.Writer{
@@ -422,9 +445,10 @@ func TestSeckillKafkaDownWritesRetry(t *testing.T) {
 		_ = retryReader.Close()
 	}()
 
-	svc := NewVoucherOrderService(db, rdb, writer, retryWriter, dlqWriter, reader, retryReader, nil, utils.SMTPConfig{}, nil, newTestLogger(t))
+	svc := NewVoucherOrderService(db, rdb, NewKafkaProducer(writer), NewKafkaProducer(retryWriter), NewKafkaProducer(dlqWriter), NewKafkaConsumer(reader), NewKafkaConsumer(retryReader), nil, utils.SMTPConfig{}, config.SeckillConfig{}, nil, newTestLogger(t))
+	defer startTestWorkers(t, svc)()
 
-	orderID, err := svc.Seckill(ctx, voucherID, userID)
+	orderID, err := svc.Seckill(ctx, voucherID, userID, 1)
 	if err != nil {
 		t.Fatalf("seckill failed: %v", err)
 	}
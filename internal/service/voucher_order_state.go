@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"hmdp-backend/internal/model"
+)
+
+var (
+	// ErrVoucherOrderNotFound 订单不存在或不属于当前用户
+	ErrVoucherOrderNotFound = errors.New("订单不存在")
+	// ErrIllegalOrderTransition 订单当前状态不允许执行该操作
+	ErrIllegalOrderTransition = errors.New("订单当前状态不允许该操作")
+)
+
+// orderTransitions 订单状态机：key 为当前状态，value 为允许流转到的目标状态
+// 未支付 -> 已支付 / 已取消；已支付 -> 已核销 / 已退款；其余状态为终态
+var orderTransitions = map[int][]int{
+	model.VoucherOrderStatusUnpaid: {model.VoucherOrderStatusPaid, model.VoucherOrderStatusCancelled},
+	model.VoucherOrderStatusPaid:   {model.VoucherOrderStatusUsed, model.VoucherOrderStatusRefunded},
+}
+
+// canTransitOrder 判断订单能否从 from 状态流转到 to 状态
+func canTransitOrder(from, to int) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PayOrder 支付订单：未支付 -> 已支付
+func (s *VoucherOrderService) PayOrder(ctx context.Context, orderID, userID int64, payType int) error {
+	if payType <= 0 {
+		payType = 1
+	}
+	return s.transitOrder(ctx, orderID, userID, model.VoucherOrderStatusPaid, func(now time.Time) map[string]interface{} {
+		return map[string]interface{}{"pay_type": payType, "pay_time": now}
+	}, nil)
+}
+
+// UseOrder 核销订单：已支付 -> 已核销
+func (s *VoucherOrderService) UseOrder(ctx context.Context, orderID, userID int64) error {
+	return s.transitOrder(ctx, orderID, userID, model.VoucherOrderStatusUsed, func(now time.Time) map[string]interface{} {
+		return map[string]interface{}{"use_time": now}
+	}, nil)
+}
+
+// RefundOrder 退款：已支付且未核销 -> 已退款
+func (s *VoucherOrderService) RefundOrder(ctx context.Context, orderID, userID int64) error {
+	return s.transitOrder(ctx, orderID, userID, model.VoucherOrderStatusRefunded, func(now time.Time) map[string]interface{} {
+		return map[string]interface{}{"refund_time": now}
+	}, nil)
+}
+
+// transitOrder 在事务内锁定订单行，校验状态流转合法后更新状态与对应时间字段
+// userID <= 0 表示系统操作（如超时取消），不校验订单归属；after 在同一事务内执行附加操作
+func (s *VoucherOrderService) transitOrder(
+	ctx context.Context,
+	orderID, userID int64,
+	to int,
+	fields func(now time.Time) map[string]interface{},
+	after func(tx *gorm.DB, order *model.VoucherOrder) error,
+) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order model.VoucherOrder
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", orderID)
+		if userID > 0 {
+			query = query.Where("user_id = ?", userID)
+		}
+		// SELECT ... FOR UPDATE 锁定订单行，避免并发支付/退款/超时取消互相覆盖
+		err := query.Take(&order).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVoucherOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !canTransitOrder(order.Status, to) {
+			return ErrIllegalOrderTransition
+		}
+
+		now := time.Now()
+		updates := fields(now)
+		updates["status"] = to
+		updates["update_time"] = now
+		// 条件更新兜底：状态仍为加锁时读到的值才会更新成功
+		res := tx.Model(&model.VoucherOrder{}).
+			Where("id = ? AND status = ?", orderID, order.Status).
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrIllegalOrderTransition
+		}
+		if after != nil {
+			return after(tx, &order)
+		}
+		return nil
+	})
+}
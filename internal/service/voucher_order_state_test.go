@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+
+	"hmdp-backend/internal/model"
+)
+
+// TestCanTransitOrder 校验订单状态机的合法与非法流转
+func TestCanTransitOrder(t *testing.T) {
+	cases := []struct {
+		from, to int
+		want     bool
+	}{
+		{model.VoucherOrderStatusUnpaid, model.VoucherOrderStatusPaid, true},
+		{model.VoucherOrderStatusUnpaid, model.VoucherOrderStatusCancelled, true},
+		{model.VoucherOrderStatusUnpaid, model.VoucherOrderStatusUsed, false},
+		{model.VoucherOrderStatusUnpaid, model.VoucherOrderStatusRefunded, false},
+		{model.VoucherOrderStatusPaid, model.VoucherOrderStatusUsed, true},
+		{model.VoucherOrderStatusPaid, model.VoucherOrderStatusRefunded, true},
+		{model.VoucherOrderStatusPaid, model.VoucherOrderStatusCancelled, false},
+		{model.VoucherOrderStatusPaid, model.VoucherOrderStatusPaid, false},
+		{model.VoucherOrderStatusUsed, model.VoucherOrderStatusRefunded, false},
+		{model.VoucherOrderStatusCancelled, model.VoucherOrderStatusPaid, false},
+		{model.VoucherOrderStatusRefunded, model.VoucherOrderStatusPaid, false},
+	}
+	for _, c := range cases {
+		if got := canTransitOrder(c.from, c.to); got != c.want {
+			t.Fatalf("canTransitOrder(%d, %d) = %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
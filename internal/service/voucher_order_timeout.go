@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"hmdp-backend/internal/model"
+)
+
+const (
+	orderTimeoutKey          = "seckill:order:timeout" // 未支付订单超时取消的延迟队列
+	defaultOrderPayTimeout   = 15 * time.Minute
+	orderTimeoutPollInterval = time.Second
+	orderTimeoutBatchSize    = 100
+	orderTimeoutRetryDelay   = 5 * time.Second
+	orderTimeoutLease        = 30 * time.Second // 领取后未确认的任务经过该时间重新可见
+)
+
+// payDeadline 计算订单支付截止时间：优先使用秒杀券自身配置，未配置时使用全局默认值
+func (s *VoucherOrderService) payDeadline(createdAt int64, voucherPayTimeout int) int64 {
+	timeout := s.payTimeout
+	if voucherPayTimeout > 0 {
+		timeout = time.Duration(voucherPayTimeout) * time.Second
+	}
+	return time.Unix(createdAt, 0).Add(timeout).Unix()
+}
+
+// scheduleOrderTimeout 订单落库后登记超时取消任务
+// 截止时间来自消息本身，Kafka 重复投递时写入的是同一个 member 与同一个时间点，天然幂等
+func (s *VoucherOrderService) scheduleOrderTimeout(ctx context.Context, payload orderMessage) error {
+	deadline := payload.PayDeadline
+	if deadline <= 0 {
+		deadline = s.payDeadline(payload.CreatedAt, 0)
+	}
+	member := strconv.FormatInt(payload.OrderID, 10)
+	if err := s.timeoutQueue.Push(ctx, member, time.Unix(deadline, 0)); err != nil {
+		s.log.Error("schedule order timeout failed", zap.Error(err), zap.Int64("orderId", payload.OrderID))
+		return err
+	}
+	return nil
+}
+
+// runOrderTimeoutWorker 轮询延迟队列，取消到期仍未支付的订单
+func (s *VoucherOrderService) runOrderTimeoutWorker(ctx context.Context) {
+	s.log.Info("order timeout worker started")
+	ticker := time.NewTicker(orderTimeoutPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 已领取的任务尽量处理完，不随停机中断；即使中断，租约到期后也会被重新领取
+			s.processDueOrderTimeouts(context.WithoutCancel(ctx))
+		}
+	}
+}
+
+// processDueOrderTimeouts 处理一批到期的超时任务：成功后才从队列删除，失败的任务延后重新排期
+func (s *VoucherOrderService) processDueOrderTimeouts(ctx context.Context) {
+	members, err := s.timeoutQueue.ClaimDue(ctx, time.Now(), orderTimeoutLease, orderTimeoutBatchSize)
+	if err != nil {
+		s.log.Error("claim order timeout failed", zap.Error(err))
+		return
+	}
+	done := make([]string, 0, len(members))
+	for _, member := range members {
+		orderID, parseErr := strconv.ParseInt(member, 10, 64)
+		if parseErr != nil {
+			s.log.Warn("invalid order timeout member", zap.String("member", member))
+			done = append(done, member)
+			continue
+		}
+		if err := s.CancelUnpaidOrder(ctx, orderID); err != nil {
+			s.log.Error("cancel unpaid order failed, rescheduled", zap.Error(err), zap.Int64("orderId", orderID))
+			// 重新排期失败时任务仍按租约到期时间重试
+			_ = s.timeoutQueue.PushOverwrite(ctx, member, time.Now().Add(orderTimeoutRetryDelay))
+			continue
+		}
+		done = append(done, member)
+	}
+	if err := s.timeoutQueue.Remove(ctx, done...); err != nil {
+		// 删除失败时任务会在租约到期后重复执行，CancelUnpaidOrder 幂等
+		s.log.Error("remove order timeout failed", zap.Error(err), zap.Int("count", len(done)))
+	}
+}
+
+// CancelUnpaidOrder 超时取消未支付订单，并归还 DB 与 Redis 库存
+// 订单已支付/不存在时直接返回 nil；已取消时重新执行幂等的 Redis 归还，覆盖提交后归还失败或进程崩溃的情况。
+// Redis 归还失败时返回错误，任务重新排期
+func (s *VoucherOrderService) CancelUnpaidOrder(ctx context.Context, orderID int64) error {
+	var cancelled *model.VoucherOrder
+	err := s.transitOrder(ctx, orderID, 0, model.VoucherOrderStatusCancelled, func(time.Time) map[string]interface{} {
+		return map[string]interface{}{}
+	}, func(tx *gorm.DB, order *model.VoucherOrder) error {
+		// 与状态变更在同一事务内按购买数量归还 DB 库存
+		if err := tx.Model(&model.SeckillVoucher{}).
+			Where("voucher_id = ?", order.VoucherID).
+			Update("stock", gorm.Expr("stock + ?", order.OrderQuantity())).Error; err != nil {
+			return err
+		}
+		cancelled = order
+		return nil
+	})
+	if errors.Is(err, ErrVoucherOrderNotFound) {
+		return nil
+	}
+	if errors.Is(err, ErrIllegalOrderTransition) {
+		var order model.VoucherOrder
+		if err := s.db.WithContext(ctx).Where("id = ?", orderID).Take(&order).Error; err != nil {
+			return err
+		}
+		if order.Status != model.VoucherOrderStatusCancelled {
+			return nil
+		}
+		// 已取消：上次提交后 Redis 可能未归还，按订单标记重新执行，已归还时为空操作
+		return s.restoreCancelledOrder(ctx, &order)
+	}
+	if err != nil {
+		return err
+	}
+	// 事务提交后归还 Redis 库存与用户下单资格
+	if err := s.restoreCancelledOrder(ctx, cancelled); err != nil {
+		return err
+	}
+	s.log.Info("unpaid order cancelled",
+		zap.Int64("orderId", cancelled.ID),
+		zap.Int64("voucherId", cancelled.VoucherID),
+		zap.Int64("userId", cancelled.UserID),
+	)
+	return nil
+}
+
+// restoreCancelledOrder 归还已取消订单占用的 Redis 库存与用户下单资格，按订单 ID 标记只归还一次
+func (s *VoucherOrderService) restoreCancelledOrder(ctx context.Context, order *model.VoucherOrder) error {
+	return s.runCompensate(ctx, orderMessage{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		VoucherID: order.VoucherID,
+		Quantity:  order.OrderQuantity(),
+	}, fmt.Sprintf(orderCancelRestoredKeyFmt, order.ID), orderCancelRestoredTTL)
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"hmdp-backend/internal/model"
+)
+
+const (
+	orderStateKeyFmt  = "seckill:order:state:%d" // 订单异步处理状态（Hash）
+	userOrdersKeyFmt  = "seckill:order:user:%d"  // 用户近期秒杀订单索引（ZSet，score 为下单时间）
+	orderStateTTL     = 7 * 24 * time.Hour
+	userOrdersMaxSize = 100
+
+	// voucherInflightKeyFmt 秒杀券已受理但尚未落库的订单（ZSet，member 为 orderId:userId:quantity，score 为最近一次状态更新时间），
+	// 对账时用于扣除在途数量
+	voucherInflightKeyFmt = "seckill:order:inflight:%d"
+)
+
+// 订单异步处理状态
+const (
+	OrderStatePending      = "pending"       // 已受理，等待 Kafka 消费落库
+	OrderStatePersisted    = "persisted"     // 已落库
+	OrderStateRetrying     = "retrying"      // 落库失败，重试中
+	OrderStateDeadLettered = "dead_lettered" // 重试耗尽进入死信，库存已归还
+	OrderStateCompensated  = "compensated"   // 业务失败不重试，库存已归还
+)
+
+// VoucherOrderView 订单查询结果：异步处理状态 + 已落库的订单详情
+type VoucherOrderView struct {
+	OrderID    int64               `json:"orderId"`
+	UserID     int64               `json:"userId"`
+	VoucherID  int64               `json:"voucherId"`
+	Quantity   int                 `json:"quantity"`
+	State      string              `json:"state"`
+	RetryCount int                 `json:"retryCount"`
+	LastError  string              `json:"lastError,omitempty"`
+	CreatedAt  int64               `json:"createdAt"`
+	UpdatedAt  int64               `json:"updatedAt"`
+	Order      *model.VoucherOrder `json:"order,omitempty"`
+}
+
+// trackOrderState 记录订单在异步链路中的处理状态，失败只记日志不影响主流程
+func (s *VoucherOrderService) trackOrderState(ctx context.Context, payload orderMessage, state string) {
+	if s.rdb == nil {
+		return
+	}
+	key := fmt.Sprintf(orderStateKeyFmt, payload.OrderID)
+	view := VoucherOrderView{
+		OrderID:    payload.OrderID,
+		UserID:     payload.UserID,
+		VoucherID:  payload.VoucherID,
+		Quantity:   payload.orderQuantity(),
+		State:      state,
+		RetryCount: payload.RetryCount,
+		LastError:  payload.LastError,
+		CreatedAt:  payload.CreatedAt,
+		UpdatedAt:  time.Now().Unix(),
+	}
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			"state", view.State,
+			"userId", view.UserID,
+			"voucherId", view.VoucherID,
+			"quantity", view.Quantity,
+			"retryCount", view.RetryCount,
+			"lastError", view.LastError,
+			"createdAt", view.CreatedAt,
+			"updatedAt", view.UpdatedAt,
+		)
+		pipe.Expire(ctx, key, orderStateTTL)
+		inflightKey := fmt.Sprintf(voucherInflightKeyFmt, payload.VoucherID)
+		switch state {
+		case OrderStatePending, OrderStateRetrying:
+			pipe.ZAdd(ctx, inflightKey, redis.Z{Score: float64(view.UpdatedAt), Member: inflightMember(payload)})
+			pipe.Expire(ctx, inflightKey, orderStateTTL)
+		default:
+			// 已落库、已补偿或进入死信，不再占用在途数量
+			pipe.ZRem(ctx, inflightKey, inflightMember(payload))
+		}
+		if state == OrderStatePending {
+			// 下单受理时写入用户订单索引，只保留最近 userOrdersMaxSize 条
+			userKey := fmt.Sprintf(userOrdersKeyFmt, payload.UserID)
+			pipe.ZAdd(ctx, userKey, redis.Z{Score: float64(payload.CreatedAt), Member: payload.OrderID})
+			pipe.ZRemRangeByRank(ctx, userKey, 0, -userOrdersMaxSize-1)
+			pipe.Expire(ctx, userKey, orderStateTTL)
+		} else if event, marshalErr := json.Marshal(view); marshalErr == nil {
+			// 消费结果推送给等待该订单的连接（受理时的 pending 由客户端首次查询获得，不推送）
+			pipe.Publish(ctx, orderEventChannel, event)
+		}
+		return nil
+	})
+	if err != nil {
+		s.log.Warn("track order state failed", zap.Error(err), zap.Int64("orderId", payload.OrderID), zap.String("state", state))
+	}
+}
+
+// inflightMember 在途订单索引的 member
+func inflightMember(payload orderMessage) string {
+	return fmt.Sprintf("%d:%d:%d", payload.OrderID, payload.UserID, payload.orderQuantity())
+}
+
+// parseInflightMember 解析在途订单索引的 member
+func parseInflightMember(member string) (orderID, userID, quantity int64, ok bool) {
+	parts := strings.Split(member, ":")
+	if len(parts) != 3 {
+		return 0, 0, 0, false
+	}
+	var err1, err2, err3 error
+	orderID, err1 = strconv.ParseInt(parts[0], 10, 64)
+	userID, err2 = strconv.ParseInt(parts[1], 10, 64)
+	quantity, err3 = strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, 0, 0, false
+	}
+	return orderID, userID, quantity, true
+}
+
+// loadOrderState 读取订单异步处理状态，不存在时返回 nil
+func (s *VoucherOrderService) loadOrderState(ctx context.Context, orderID int64) (*VoucherOrderView, error) {
+	fields, err := s.rdb.HGetAll(ctx, fmt.Sprintf(orderStateKeyFmt, orderID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return orderViewFromState(orderID, fields), nil
+}
+
+// orderViewFromState 将状态 Hash 转换为查询结果
+func orderViewFromState(orderID int64, fields map[string]string) *VoucherOrderView {
+	view := &VoucherOrderView{
+		OrderID:   orderID,
+		State:     fields["state"],
+		LastError: fields["lastError"],
+	}
+	view.UserID, _ = strconv.ParseInt(fields["userId"], 10, 64)
+	view.VoucherID, _ = strconv.ParseInt(fields["voucherId"], 10, 64)
+	view.Quantity, _ = strconv.Atoi(fields["quantity"])
+	view.RetryCount, _ = strconv.Atoi(fields["retryCount"])
+	view.CreatedAt, _ = strconv.ParseInt(fields["createdAt"], 10, 64)
+	view.UpdatedAt, _ = strconv.ParseInt(fields["updatedAt"], 10, 64)
+	return view
+}
+
+// GetOrder 查询当前用户的单个订单：优先以 DB 为准，未落库时返回异步处理状态
+func (s *VoucherOrderService) GetOrder(ctx context.Context, orderID, userID int64) (*VoucherOrderView, error) {
+	var order model.VoucherOrder
+	err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", orderID, userID).Take(&order).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	tracked, stateErr := s.loadOrderState(ctx, orderID)
+	if stateErr != nil {
+		s.log.Warn("load order state failed", zap.Error(stateErr), zap.Int64("orderId", orderID))
+	}
+	if err == nil {
+		return persistedOrderView(&order, tracked), nil
+	}
+	if tracked == nil || tracked.UserID != userID {
+		return nil, ErrVoucherOrderNotFound
+	}
+	return tracked, nil
+}
+
+// ListMyOrders 分页查询当前用户的订单
+// 第一页额外带上尚未落库（排队、重试、死信、已补偿）的订单，避免客户端把失败订单当成成功
+func (s *VoucherOrderService) ListMyOrders(ctx context.Context, userID int64, page, size int) ([]VoucherOrderView, error) {
+	offset := (page - 1) * size
+	if offset < 0 {
+		offset = 0
+	}
+	var orders []model.VoucherOrder
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Offset(offset).
+		Limit(size).
+		Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	views := make([]VoucherOrderView, 0, len(orders))
+	if page <= 1 {
+		inFlight, err := s.listUnpersistedOrders(ctx, userID)
+		if err != nil {
+			s.log.Warn("list unpersisted orders failed", zap.Error(err), zap.Int64("userId", userID))
+		}
+		views = append(views, inFlight...)
+	}
+	for i := range orders {
+		views = append(views, *persistedOrderView(&orders[i], nil))
+	}
+	return views, nil
+}
+
+// listUnpersistedOrders 从用户订单索引中找出尚未落库的订单
+func (s *VoucherOrderService) listUnpersistedOrders(ctx context.Context, userID int64) ([]VoucherOrderView, error) {
+	members, err := s.rdb.ZRevRange(ctx, fmt.Sprintf(userOrdersKeyFmt, userID), 0, userOrdersMaxSize-1).Result()
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members))
+	cmds := make([]*redis.MapStringStringCmd, 0, len(members))
+	pipe := s.rdb.Pipeline()
+	for _, member := range members {
+		id, parseErr := strconv.ParseInt(member, 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		ids = append(ids, id)
+		cmds = append(cmds, pipe.HGetAll(ctx, fmt.Sprintf(orderStateKeyFmt, id)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	// 状态更新可能失败，已落库的订单以 DB 为准剔除
+	var persistedIDs []int64
+	if err := s.db.WithContext(ctx).Model(&model.VoucherOrder{}).
+		Where("id IN ?", ids).
+		Pluck("id", &persistedIDs).Error; err != nil {
+		return nil, err
+	}
+	persisted := make(map[int64]struct{}, len(persistedIDs))
+	for _, id := range persistedIDs {
+		persisted[id] = struct{}{}
+	}
+
+	views := make([]VoucherOrderView, 0, len(ids))
+	for i, id := range ids {
+		if _, ok := persisted[id]; ok {
+			continue
+		}
+		fields := cmds[i].Val()
+		if len(fields) == 0 || fields["state"] == OrderStatePersisted {
+			continue
+		}
+		views = append(views, *orderViewFromState(id, fields))
+	}
+	return views, nil
+}
+
+// persistedOrderView 已落库订单的查询结果，tracked 非空时补充重试信息
+func persistedOrderView(order *model.VoucherOrder, tracked *VoucherOrderView) *VoucherOrderView {
+	view := &VoucherOrderView{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		VoucherID: order.VoucherID,
+		Quantity:  order.OrderQuantity(),
+		State:     OrderStatePersisted,
+		CreatedAt: order.CreateTime.Unix(),
+		UpdatedAt: order.UpdateTime.Unix(),
+		Order:     order,
+	}
+	if tracked != nil {
+		view.RetryCount = tracked.RetryCount
+		view.LastError = tracked.LastError
+	}
+	return view
+}
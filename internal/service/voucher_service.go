@@ -2,15 +2,34 @@ package service
 
 import (
 	"context"
+	_ "embed"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"hmdp-backend/internal/model"
 )
 
+//go:embed seckill_stock_adjust.lua
+var seckillStockAdjustLuaSource string
+
+var seckillStockAdjustLua = redis.NewScript(seckillStockAdjustLuaSource)
+
+var (
+	// ErrVoucherNotFound 优惠券或秒杀券不存在
+	ErrVoucherNotFound = errors.New("优惠券不存在")
+	// ErrInvalidVoucher 优惠券参数不合法
+	ErrInvalidVoucher = errors.New("优惠券参数不合法")
+	// ErrSeckillStockNotEnough 库存调整后为负
+	ErrSeckillStockNotEnough = errors.New("调整后库存不能为负")
+	// ErrVoucherHasActiveOrders 仍有未支付/未核销订单，不允许删除
+	ErrVoucherHasActiveOrders = errors.New("存在未完成订单，请先下架")
+)
+
 // VoucherService 处理普通券与秒杀券逻辑
 type VoucherService struct {
 	db         *gorm.DB
@@ -20,20 +39,31 @@ type VoucherService struct {
 
 // VoucherWithSeckill 用于返回携带秒杀信息的券
 type VoucherWithSeckill struct {
-	ID          int64      `gorm:"column:id" json:"id"`
-	ShopID      int64      `gorm:"column:shop_id" json:"shopId"`
-	Title       string     `gorm:"column:title" json:"title"`
-	SubTitle    string     `gorm:"column:sub_title" json:"subTitle"`
-	Rules       string     `gorm:"column:rules" json:"rules"`
-	PayValue    int64      `gorm:"column:pay_value" json:"payValue"`
-	ActualValue int64      `gorm:"column:actual_value" json:"actualValue"`
-	Type        int        `gorm:"column:type" json:"type"`
-	Status      int        `gorm:"column:status" json:"status"`
-	CreateTime  time.Time  `gorm:"column:create_time" json:"createTime"`
-	UpdateTime  time.Time  `gorm:"column:update_time" json:"updateTime"`
-	Stock       *int       `gorm:"column:stock" json:"stock,omitempty"`
-	BeginTime   *time.Time `gorm:"column:begin_time" json:"beginTime,omitempty"`
-	EndTime     *time.Time `gorm:"column:end_time" json:"endTime,omitempty"`
+	ID            int64      `gorm:"column:id" json:"id"`
+	ShopID        int64      `gorm:"column:shop_id" json:"shopId"`
+	Title         string     `gorm:"column:title" json:"title"`
+	SubTitle      string     `gorm:"column:sub_title" json:"subTitle"`
+	Rules         string     `gorm:"column:rules" json:"rules"`
+	PayValue      int64      `gorm:"column:pay_value" json:"payValue"`
+	ActualValue   int64      `gorm:"column:actual_value" json:"actualValue"`
+	Type          int        `gorm:"column:type" json:"type"`
+	Status        int        `gorm:"column:status" json:"status"`
+	CreateTime    time.Time  `gorm:"column:create_time" json:"createTime"`
+	UpdateTime    time.Time  `gorm:"column:update_time" json:"updateTime"`
+	Stock         *int       `gorm:"column:stock" json:"stock,omitempty"`
+	BeginTime     *time.Time `gorm:"column:begin_time" json:"beginTime,omitempty"`
+	EndTime       *time.Time `gorm:"column:end_time" json:"endTime,omitempty"`
+	LimitPerUser  *int       `gorm:"column:limit_per_user" json:"limitPerUser,omitempty"`
+	AdmissionRate *int       `gorm:"column:admission_rate" json:"admissionRate,omitempty"` // > 0 时需先排队领取入场资格
+}
+
+// SeckillVoucherUpdate 秒杀券可编辑字段，nil 表示不修改
+type SeckillVoucherUpdate struct {
+	BeginTime     *time.Time `json:"beginTime"`
+	EndTime       *time.Time `json:"endTime"`
+	LimitPerUser  *int       `json:"limitPerUser"`
+	PayTimeout    *int       `json:"payTimeout"`
+	AdmissionRate *int       `json:"admissionRate"` // 等候室每秒放行人数，0 关闭等候室
 }
 
 // NewVoucherService 创建 VoucherService 实例
@@ -51,7 +81,7 @@ func (s *VoucherService) QueryVoucherOfShop(ctx context.Context, shopID int64) (
 	query := `
         SELECT v.id, v.shop_id, v.title, v.sub_title, v.rules, v.pay_value,
                v.actual_value, v.type, v.status, v.create_time, v.update_time,
-               sv.stock, sv.begin_time, sv.end_time
+               sv.stock, sv.begin_time, sv.end_time, sv.limit_per_user, sv.admission_rate
         FROM tb_voucher v
         LEFT JOIN tb_seckill_voucher sv ON v.id = sv.voucher_id
         WHERE v.shop_id = ? AND v.status = 1`
@@ -59,32 +89,220 @@ func (s *VoucherService) QueryVoucherOfShop(ctx context.Context, shopID int64) (
 	return vouchers, err
 }
 
+// AddSeckillVoucher 创建秒杀券：券信息、秒杀信息与 Redis 库存在同一事务内写入
 func (s *VoucherService) AddSeckillVoucher(ctx context.Context, voucher *model.Voucher) error {
-	if err := s.Create(ctx, voucher); err != nil {
+	if voucher.Stock == nil || *voucher.Stock <= 0 {
+		return fmt.Errorf("%w：库存必须大于 0", ErrInvalidVoucher)
+	}
+	if voucher.BeginTime == nil || voucher.EndTime == nil || !voucher.BeginTime.Before(*voucher.EndTime) {
+		return fmt.Errorf("%w：开始时间必须早于结束时间", ErrInvalidVoucher)
+	}
+	payTimeout := 0
+	if voucher.PayTimeout != nil {
+		payTimeout = *voucher.PayTimeout
+	}
+	if payTimeout < 0 {
+		return fmt.Errorf("%w：支付超时时间不能为负", ErrInvalidVoucher)
+	}
+	// 未指定时默认每人限购一单
+	limitPerUser := 1
+	if voucher.LimitPerUser != nil {
+		limitPerUser = *voucher.LimitPerUser
+	}
+	admissionRate := 0
+	if voucher.AdmissionRate != nil {
+		admissionRate = *voucher.AdmissionRate
+	}
+	if admissionRate < 0 {
+		return fmt.Errorf("%w：放行速率不能为负", ErrInvalidVoucher)
+	}
+	stock := *voucher.Stock
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(voucher).Error; err != nil {
+			return err
+		}
+		sec := &model.SeckillVoucher{
+			VoucherID:     voucher.ID,
+			Stock:         stock,
+			PayTimeout:    payTimeout,
+			LimitPerUser:  limitPerUser,
+			AdmissionRate: admissionRate,
+			BeginTime:     *voucher.BeginTime,
+			EndTime:       *voucher.EndTime,
+		}
+		if err := tx.Create(sec).Error; err != nil {
+			return err
+		}
+		// 将库存写入 Redis，供秒杀脚本扣减；写入失败时回滚事务
+		return s.rdb.Set(ctx, fmt.Sprintf(stockKeyFmt, voucher.ID), stock, 0).Err()
+	})
+	if err != nil {
 		return err
 	}
-	stock := 100
-	if voucher.Stock != nil {
-		stock = *voucher.Stock
+	// 事务提交后清除可能存在的空标记，避免并发秒杀在提交前回源把空标记重新写回
+	return invalidateVoucherMeta(ctx, s.rdb, voucher.ID)
+}
+
+// UpdateSeckillVoucher 修改秒杀时间、每人限购、支付超时时间与等候室放行速率
+func (s *VoucherService) UpdateSeckillVoucher(ctx context.Context, voucherID int64, req SeckillVoucherUpdate) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var sec model.SeckillVoucher
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("voucher_id = ?", voucherID).Take(&sec).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVoucherNotFound
+		}
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{}
+		if req.BeginTime != nil {
+			sec.BeginTime = *req.BeginTime
+			updates["begin_time"] = sec.BeginTime
+		}
+		if req.EndTime != nil {
+			sec.EndTime = *req.EndTime
+			updates["end_time"] = sec.EndTime
+		}
+		if !sec.BeginTime.Before(sec.EndTime) {
+			return fmt.Errorf("%w：开始时间必须早于结束时间", ErrInvalidVoucher)
+		}
+		if req.LimitPerUser != nil {
+			updates["limit_per_user"] = *req.LimitPerUser
+		}
+		if req.PayTimeout != nil {
+			if *req.PayTimeout < 0 {
+				return fmt.Errorf("%w：支付超时时间不能为负", ErrInvalidVoucher)
+			}
+			updates["pay_timeout"] = *req.PayTimeout
+		}
+		if req.AdmissionRate != nil {
+			if *req.AdmissionRate < 0 {
+				return fmt.Errorf("%w：放行速率不能为负", ErrInvalidVoucher)
+			}
+			updates["admission_rate"] = *req.AdmissionRate
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		updates["update_time"] = time.Now()
+		return tx.Model(&model.SeckillVoucher{}).Where("voucher_id = ?", voucherID).Updates(updates).Error
+	})
+	if err != nil {
+		return err
+	}
+	// 事务提交后删除元数据缓存，秒杀脚本下次回源加载新配置
+	return invalidateVoucherMeta(ctx, s.rdb, voucherID)
+}
+
+// AdjustSeckillStock 按增量调整秒杀库存，DB 与 Redis 任一侧调整后为负都会整体失败
+// 返回调整后的 Redis 库存（即当前可售库存）
+func (s *VoucherService) AdjustSeckillStock(ctx context.Context, voucherID int64, delta int) (int64, error) {
+	if delta == 0 {
+		return 0, fmt.Errorf("%w：库存增量不能为 0", ErrInvalidVoucher)
 	}
-	var begin time.Time
-	if voucher.BeginTime != nil {
-		begin = *voucher.BeginTime
+	stockKey := fmt.Sprintf(stockKeyFmt, voucherID)
+	var redisStock int64
+	redisApplied := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 条件更新：stock + delta >= 0，同时锁定秒杀券行
+		res := tx.Model(&model.SeckillVoucher{}).
+			Where("voucher_id = ? AND stock + ? >= 0", voucherID, delta).
+			Updates(map[string]interface{}{
+				"stock":       gorm.Expr("stock + ?", delta),
+				"update_time": time.Now(),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		var sec model.SeckillVoucher
+		err := tx.Where("voucher_id = ?", voucherID).Take(&sec).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVoucherNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected == 0 {
+			return ErrSeckillStockNotEnough
+		}
+		// DB 更新成功后在事务内同步 Redis，Redis 拒绝时回滚 DB
+		n, err := seckillStockAdjustLua.Run(ctx, s.rdb, []string{stockKey}, delta, sec.Stock).Int64()
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return ErrSeckillStockNotEnough
+		}
+		redisStock = n
+		redisApplied = true
+		return nil
+	})
+	if err != nil && redisApplied {
+		// Redis 已调整但事务提交失败，反向归还
+		if compErr := s.rdb.IncrBy(ctx, stockKey, int64(-delta)).Err(); compErr != nil {
+			return 0, errors.Join(err, compErr)
+		}
 	}
-	var end time.Time
-	if voucher.EndTime != nil {
-		end = *voucher.EndTime
+	if err != nil {
+		return 0, err
 	}
-	sec := &model.SeckillVoucher{
-		VoucherID: voucher.ID,
-		Stock:     stock,
-		BeginTime: begin,
-		EndTime:   end,
+	return redisStock, nil
+}
+
+// UpdateVoucherStatus 上架/下架优惠券，下架后秒杀请求直接被拒绝，Redis 库存保留以便重新上架
+func (s *VoucherService) UpdateVoucherStatus(ctx context.Context, voucherID int64, status int) error {
+	switch status {
+	case model.VoucherStatusOnline, model.VoucherStatusOffline, model.VoucherStatusExpired:
+	default:
+		return fmt.Errorf("%w：未知状态 %d", ErrInvalidVoucher, status)
+	}
+	res := s.db.WithContext(ctx).Model(&model.Voucher{}).
+		Where("id = ?", voucherID).
+		Updates(map[string]interface{}{"status": status, "update_time": time.Now()})
+	if res.Error != nil {
+		return res.Error
 	}
-	if err := s.seckillSvc.Create(ctx, sec); err != nil {
+	if res.RowsAffected == 0 {
+		return ErrVoucherNotFound
+	}
+	return invalidateVoucherMeta(ctx, s.rdb, voucherID)
+}
+
+// DeleteVoucher 删除优惠券及其秒杀信息，并清理 Redis 库存、用户已购数量与元数据缓存
+// 仍有未支付或已支付未核销的订单时拒绝删除，应先下架
+func (s *VoucherService) DeleteVoucher(ctx context.Context, voucherID int64) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var active int64
+		if err := tx.Model(&model.VoucherOrder{}).
+			Where("voucher_id = ? AND status IN ?", voucherID,
+				[]int{model.VoucherOrderStatusUnpaid, model.VoucherOrderStatusPaid}).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrVoucherHasActiveOrders
+		}
+		if err := tx.Where("voucher_id = ?", voucherID).Delete(&model.SeckillVoucher{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("id = ?", voucherID).Delete(&model.Voucher{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVoucherNotFound
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
-	// 将库存写入 Redis，供秒杀脚本扣减
-	stockKey := fmt.Sprintf("seckill:stock:vid:%d", voucher.ID)
-	return s.rdb.Set(ctx, stockKey, stock, 0).Err()
+	// 库存 key 删除后，在途订单的补偿脚本不会再重建它
+	return s.rdb.Del(ctx,
+		fmt.Sprintf(stockKeyFmt, voucherID),
+		fmt.Sprintf(orderCountKeyFmt, voucherID),
+		fmt.Sprintf(legacyOrderKeyFmt, voucherID),
+		fmt.Sprintf(voucherMetaKeyFmt, voucherID),
+		fmt.Sprintf(voucherInflightKeyFmt, voucherID),
+	).Err()
 }
@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"hmdp-backend/internal/model"
+)
+
+const (
+	reconcileLockKey         = "seckill:reconcile:lock" // 多实例下同一周期只有一个实例执行定时对账
+	defaultReconcileInterval = 5 * time.Minute
+	reconcileLookback        = 24 * time.Hour // 定时对账覆盖结束时间在该窗口内的秒杀券
+	reconcileScanCount       = 1000
+	reconcileSampleUsers     = 10 // 对账报告与日志中最多列出的不一致用户数
+	// reconcileInflightMaxAge 在途订单超过该时间没有状态更新视为已丢失，不再从差异中扣除
+	reconcileInflightMaxAge = time.Hour
+)
+
+// ErrReconcileVoucherSelling 秒杀进行中不允许修复，在途订单会导致修复结果错误
+var ErrReconcileVoucherSelling = errors.New("秒杀进行中，请先下架或等待结束后再修复")
+
+// StockReconcileReport 单张秒杀券的库存对账结果
+// 正常情况下 Redis 库存 + Redis 已购 = DB 库存 + DB 订单数量（都等于总库存），
+// Redis 已购 - DB 订单数量 - 在途数量 秒杀结束后应为 0
+type StockReconcileReport struct {
+	VoucherID         int64     `json:"voucherId"`
+	RedisStock        int64     `json:"redisStock"`
+	RedisStockMissing bool      `json:"redisStockMissing"`
+	RedisBought       int64     `json:"redisBought"` // order:cnt:vid 中各用户已购数量之和
+	DBOrdered         int64     `json:"dbOrdered"`   // tb_voucher_order 中未取消订单的购买数量之和
+	DBStock           int64     `json:"dbStock"`
+	InFlight          int64     `json:"inFlight"`                 // 已受理尚未落库的订单数量之和
+	Selling           bool      `json:"selling"`                  // 上架且在秒杀时间窗口内
+	StockDrift        int64     `json:"stockDrift"`               // (RedisStock + RedisBought) - (DBStock + DBOrdered)
+	BoughtDrift       int64     `json:"boughtDrift"`              // RedisBought - DBOrdered - InFlight
+	UserMismatches    int       `json:"userMismatches"`           // Redis 已购与 DB 订单 + 在途数量不一致的用户数
+	MismatchSample    []int64   `json:"mismatchSample,omitempty"` // 部分不一致的用户 ID，最多 10 个
+	Consistent        bool      `json:"consistent"`
+	Repaired          bool      `json:"repaired"`
+	RepairSkipped     bool      `json:"repairSkipped,omitempty"` // 秒杀进行中，跳过修复
+	CheckedAt         time.Time `json:"checkedAt"`
+}
+
+// runStockReconcileWorker 定时对账，多实例通过 Redis 锁保证每个周期只执行一次
+func (s *VoucherOrderService) runStockReconcileWorker(ctx context.Context) {
+	s.log.Info("stock reconcile worker started", zap.Duration("interval", s.reconcileInterval))
+	ticker := time.NewTicker(s.reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := s.rdb.SetNX(ctx, reconcileLockKey, 1, s.reconcileInterval).Result()
+			if err != nil {
+				s.log.Warn("acquire reconcile lock failed", zap.Error(err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if _, err := s.ReconcileStock(ctx, 0, s.reconcileAutoRepair); err != nil {
+				s.log.Error("scheduled stock reconcile failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// ReconcileStock 对比 Redis 库存、Redis 用户已购数量、DB 订单与 DB 库存
+// voucherID <= 0 时对账近期所有秒杀券；repair 为 true 时以 DB 为准修复 Redis（仅限未在售的券）
+func (s *VoucherOrderService) ReconcileStock(ctx context.Context, voucherID int64, repair bool) ([]StockReconcileReport, error) {
+	voucherIDs := []int64{voucherID}
+	if voucherID <= 0 {
+		voucherIDs = nil
+		if err := s.db.WithContext(ctx).Model(&model.SeckillVoucher{}).
+			Where("end_time >= ?", time.Now().Add(-reconcileLookback)).
+			Pluck("voucher_id", &voucherIDs).Error; err != nil {
+			return nil, err
+		}
+	}
+	reports := make([]StockReconcileReport, 0, len(voucherIDs))
+	for _, id := range voucherIDs {
+		report, err := s.reconcileVoucherStock(ctx, id, repair)
+		if err != nil {
+			// 指定单张券时直接返回错误，批量对账时跳过
+			if voucherID > 0 {
+				return nil, err
+			}
+			s.log.Error("reconcile voucher stock failed", zap.Error(err), zap.Int64("voucherId", id))
+			continue
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// reconcileVoucherStock 对账单张秒杀券，每张券每次对账只记录一次指标
+// 秒杀进行中 Redis 的多次读取不是快照，且不断有新订单受理，只检查库存 key 是否缺失；
+// 下架或不在秒杀时间窗口内时再比较库存与逐用户已购数量，并扣除仍在途（已受理、尚未落库）的订单
+func (s *VoucherOrderService) reconcileVoucherStock(ctx context.Context, voucherID int64, repair bool) (*StockReconcileReport, error) {
+	result := "error"
+	var drifts map[string]int64
+	defer func() {
+		s.metrics.ObserveReconcile(voucherID, result, drifts)
+	}()
+
+	var voucher model.Voucher
+	err := s.db.WithContext(ctx).Select("id", "status").Where("id = ?", voucherID).Take(&voucher).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVoucherNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &StockReconcileReport{VoucherID: voucherID, CheckedAt: time.Now()}
+	// 先读 Redis 已购、库存与在途订单，再在同一个 DB 快照内读取库存与订单：
+	// 读取期间落库的订单会出现在 DB 快照中，并从在途订单中剔除，不会重复或遗漏
+	redisBought, err := s.loadRedisBought(ctx, voucherID)
+	if err != nil {
+		return nil, err
+	}
+	report.RedisStock, err = s.rdb.Get(ctx, fmt.Sprintf(stockKeyFmt, voucherID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		report.RedisStockMissing = true
+	} else if err != nil {
+		return nil, err
+	}
+	inflight, err := s.loadInflightOrders(ctx, voucherID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sec model.SeckillVoucher
+	var dbBought map[int64]int64
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("voucher_id = ?", voucherID).Take(&sec).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVoucherNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if dbBought, err = loadDBBought(tx, voucherID); err != nil {
+			return err
+		}
+		return dropPersistedInflight(tx, inflight)
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	report.DBStock = int64(sec.Stock)
+	report.Selling = isVoucherSelling(voucher.Status, &sec, report.CheckedAt)
+	// 期望的 Redis 已购数量 = DB 订单 + 在途订单
+	expected := make(map[int64]int64, len(dbBought))
+	for userID, n := range dbBought {
+		expected[userID] = n
+		report.DBOrdered += n
+	}
+	for _, order := range inflight {
+		expected[order.userID] += order.quantity
+		report.InFlight += order.quantity
+	}
+	for _, n := range redisBought {
+		report.RedisBought += n
+	}
+	// 按用户汇总不一致：每个用户只计一次，只保留少量样本
+	for userID := range unionUserIDs(redisBought, expected) {
+		if redisBought[userID] == expected[userID] {
+			continue
+		}
+		report.UserMismatches++
+		if len(report.MismatchSample) < reconcileSampleUsers {
+			report.MismatchSample = append(report.MismatchSample, userID)
+		}
+	}
+	report.StockDrift = (report.RedisStock + report.RedisBought) - (report.DBStock + report.DBOrdered)
+	report.BoughtDrift = report.RedisBought - report.DBOrdered - report.InFlight
+	report.Consistent = !report.RedisStockMissing
+	if !report.Selling {
+		report.Consistent = report.Consistent && report.StockDrift == 0 && report.UserMismatches == 0
+	}
+
+	drifts = map[string]int64{
+		"stock":  report.StockDrift,
+		"bought": report.BoughtDrift,
+		"users":  int64(report.UserMismatches),
+	}
+	result = "consistent"
+	if !report.Consistent {
+		result = "drift"
+		s.log.Warn("seckill stock drift detected",
+			zap.Int64("voucherId", voucherID),
+			zap.Bool("selling", report.Selling),
+			zap.Int64("redisStock", report.RedisStock),
+			zap.Bool("redisStockMissing", report.RedisStockMissing),
+			zap.Int64("redisBought", report.RedisBought),
+			zap.Int64("dbOrdered", report.DBOrdered),
+			zap.Int64("dbStock", report.DBStock),
+			zap.Int64("inFlight", report.InFlight),
+			zap.Int64("stockDrift", report.StockDrift),
+			zap.Int64("boughtDrift", report.BoughtDrift),
+			zap.Int("userMismatches", report.UserMismatches),
+			zap.Int64s("mismatchSample", report.MismatchSample),
+		)
+		if repair {
+			err := s.repairRedisStock(ctx, &sec, expected, report.DBStock-report.InFlight)
+			switch {
+			case errors.Is(err, ErrReconcileVoucherSelling):
+				// 秒杀进行中不修复，保留报告，等下架或结束后的对账再修复
+				report.RepairSkipped = true
+				result = "repair_skipped"
+				s.log.Info("seckill redis repair skipped: voucher selling", zap.Int64("voucherId", voucherID))
+			case err != nil:
+				result = "repair_failed"
+				return nil, err
+			default:
+				report.Repaired = true
+				result = "repaired"
+				s.log.Info("seckill redis stock repaired from db", zap.Int64("voucherId", voucherID), zap.Int64("stock", report.DBStock-report.InFlight))
+			}
+		}
+	}
+	return report, nil
+}
+
+// isVoucherSelling 秒杀券是否上架且在秒杀时间窗口内
+func isVoucherSelling(status int, sec *model.SeckillVoucher, now time.Time) bool {
+	return status == model.VoucherStatusOnline && !now.Before(sec.BeginTime) && !now.After(sec.EndTime)
+}
+
+// inflightOrder 已受理尚未落库的订单
+type inflightOrder struct {
+	userID   int64
+	quantity int64
+}
+
+// loadInflightOrders 读取秒杀券的在途订单（orderId -> 订单），超过 reconcileInflightMaxAge 没有状态更新的视为已丢失
+func (s *VoucherOrderService) loadInflightOrders(ctx context.Context, voucherID int64) (map[int64]inflightOrder, error) {
+	members, err := s.rdb.ZRangeByScore(ctx, fmt.Sprintf(voucherInflightKeyFmt, voucherID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Add(-reconcileInflightMaxAge).Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	orders := make(map[int64]inflightOrder, len(members))
+	for _, member := range members {
+		orderID, userID, quantity, ok := parseInflightMember(member)
+		if !ok {
+			continue
+		}
+		orders[orderID] = inflightOrder{userID: userID, quantity: quantity}
+	}
+	return orders, nil
+}
+
+// dropPersistedInflight 剔除已经落库的在途订单（落库后状态更新失败或读取期间落库）
+func dropPersistedInflight(tx *gorm.DB, inflight map[int64]inflightOrder) error {
+	if len(inflight) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(inflight))
+	for id := range inflight {
+		ids = append(ids, id)
+	}
+	for start := 0; start < len(ids); start += reconcileScanCount {
+		end := start + reconcileScanCount
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var persisted []int64
+		if err := tx.Model(&model.VoucherOrder{}).Where("id IN ?", ids[start:end]).Pluck("id", &persisted).Error; err != nil {
+			return err
+		}
+		for _, id := range persisted {
+			delete(inflight, id)
+		}
+	}
+	return nil
+}
+
+// unionUserIDs 合并两侧出现过的用户 ID
+func unionUserIDs(a, b map[int64]int64) map[int64]struct{} {
+	ids := make(map[int64]struct{}, len(a)+len(b))
+	for id := range a {
+		ids[id] = struct{}{}
+	}
+	for id := range b {
+		ids[id] = struct{}{}
+	}
+	return ids
+}
+
+// loadDBBought 按用户汇总 DB 中未取消订单的购买数量（已取消订单的库存已归还）
+func loadDBBought(tx *gorm.DB, voucherID int64) (map[int64]int64, error) {
+	var rows []struct {
+		UserID int64
+		Total  int64
+	}
+	if err := tx.Model(&model.VoucherOrder{}).
+		Select("user_id, SUM(quantity) AS total").
+		Where("voucher_id = ? AND status <> ?", voucherID, model.VoucherOrderStatusCancelled).
+		Group("user_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	bought := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		bought[row.UserID] = row.Total
+	}
+	return bought, nil
+}
+
+// loadRedisBought 使用 HSCAN/SSCAN 分批读取 Redis 中各用户已购数量（含旧版 Set），避免大 key 阻塞 Redis
+func (s *VoucherOrderService) loadRedisBought(ctx context.Context, voucherID int64) (map[int64]int64, error) {
+	key := fmt.Sprintf(orderCountKeyFmt, voucherID)
+	bought := make(map[int64]int64)
+	var cursor uint64
+	for {
+		kvs, next, err := s.rdb.HScan(ctx, key, cursor, "", reconcileScanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(kvs); i += 2 {
+			userID, err1 := strconv.ParseInt(kvs[i], 10, 64)
+			n, err2 := strconv.ParseInt(kvs[i+1], 10, 64)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			bought[userID] = n
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	// 迁移窗口内旧版 Set 中尚未迁移的用户各记已购 1
+	legacyKey := fmt.Sprintf(legacyOrderKeyFmt, voucherID)
+	cursor = 0
+	for {
+		members, next, err := s.rdb.SScan(ctx, legacyKey, cursor, "", reconcileScanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			userID, err := strconv.ParseInt(member, 10, 64)
+			if err != nil {
+				continue
+			}
+			if _, ok := bought[userID]; !ok {
+				bought[userID] = 1
+			}
+		}
+		if next == 0 {
+			return bought, nil
+		}
+		cursor = next
+	}
+}
+
+// repairRedisStock 以 DB 为准重建 Redis 库存与用户已购数量，bought 与 stock 已计入在途订单
+// 秒杀进行中不断有新订单受理，修复会覆盖这部分扣减，因此重新检查上架状态后拒绝执行
+func (s *VoucherOrderService) repairRedisStock(ctx context.Context, sec *model.SeckillVoucher, bought map[int64]int64, stock int64) error {
+	var voucher model.Voucher
+	if err := s.db.WithContext(ctx).Select("id", "status").Where("id = ?", sec.VoucherID).Take(&voucher).Error; err != nil {
+		return err
+	}
+	if isVoucherSelling(voucher.Status, sec, time.Now()) {
+		return ErrReconcileVoucherSelling
+	}
+	if stock < 0 {
+		stock = 0
+	}
+	stockKey := fmt.Sprintf(stockKeyFmt, sec.VoucherID)
+	orderCountKey := fmt.Sprintf(orderCountKeyFmt, sec.VoucherID)
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, stockKey, stock, 0)
+		pipe.Del(ctx, orderCountKey, fmt.Sprintf(legacyOrderKeyFmt, sec.VoucherID))
+		values := make([]interface{}, 0, len(bought)*2)
+		for userID, n := range bought {
+			if n > 0 {
+				values = append(values, userID, n)
+			}
+		}
+		if len(values) > 0 {
+			pipe.HSet(ctx, orderCountKey, values...)
+		}
+		return nil
+	})
+	return err
+}
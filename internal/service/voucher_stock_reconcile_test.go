@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"hmdp-backend/internal/model"
+)
+
+// TestIsVoucherSelling 只有上架且在秒杀时间窗口内视为进行中，此时对账不比较已购数量、不修复
+func TestIsVoucherSelling(t *testing.T) {
+	now := time.Now()
+	sec := &model.SeckillVoucher{BeginTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour)}
+	if !isVoucherSelling(model.VoucherStatusOnline, sec, now) {
+		t.Fatalf("expected online voucher in window to be selling")
+	}
+	if isVoucherSelling(model.VoucherStatusOnline, sec, now.Add(2*time.Hour)) {
+		t.Fatalf("expected ended voucher not selling")
+	}
+	if isVoucherSelling(model.VoucherStatusOffline, sec, now) {
+		t.Fatalf("expected offline voucher not selling")
+	}
+}
+
+func TestInflightMemberRoundTrip(t *testing.T) {
+	member := inflightMember(orderMessage{OrderID: 11, UserID: 7, Quantity: 0})
+	orderID, userID, quantity, ok := parseInflightMember(member)
+	if !ok || orderID != 11 || userID != 7 || quantity != 1 {
+		t.Fatalf("unexpected parse of %q: %d %d %d %v", member, orderID, userID, quantity, ok)
+	}
+	if _, _, _, ok := parseInflightMember("11:7"); ok {
+		t.Fatalf("expected malformed member to be rejected")
+	}
+}
@@ -18,4 +18,6 @@ const (
 	SHOP_GEO_KEY        = "shop:geo:"
 	USER_SIGN_KEY       = "sign:"
 	SHOP_BLOOM_KEY      = "bloom:shop"
+	RATE_LIMIT_KEY      = "ratelimit:"
+	IDEMPOTENCY_KEY     = "idempotency:"
 )
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	_ "embed"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+//go:embed redis_unlock.lua
+var redisUnlockLuaSource string
+
+var redisUnlockLua = redis.NewScript(redisUnlockLuaSource)
+
+// RedisLock 基于 SET NX 的分布式锁：value 为本次加锁的随机 token，释放时比较 token 后删除
+// 任务执行超过 TTL 时锁可能已被其他实例拿到，此时 Unlock 不会删除别人的锁
+type RedisLock struct {
+	rdb   *redis.Client
+	key   string
+	ttl   time.Duration
+	token string
+}
+
+// NewRedisLock 创建分布式锁，同一个实例在释放前不应重复 TryLock
+func NewRedisLock(rdb *redis.Client, key string, ttl time.Duration) *RedisLock {
+	return &RedisLock{rdb: rdb, key: key, ttl: ttl}
+}
+
+// TryLock 尝试加锁，锁已被持有时返回 false
+func (l *RedisLock) TryLock(ctx context.Context) (bool, error) {
+	token := uuid.NewString()
+	ok, err := l.rdb.SetNX(ctx, l.key, token, l.ttl).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+	l.token = token
+	return true, nil
+}
+
+// Unlock 释放锁，锁已过期或已被其他实例持有时不做任何操作
+func (l *RedisLock) Unlock(ctx context.Context) error {
+	if l.token == "" {
+		return nil
+	}
+	token := l.token
+	l.token = ""
+	return redisUnlockLua.Run(ctx, l.rdb, []string{l.key}, token).Err()
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestRedisLockUnlockKeepsOthersLock 锁过期被其他实例拿到后，原持有者释放不会删除别人的锁
+func TestRedisLockUnlockKeepsOthersLock(t *testing.T) {
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", DB: 0})
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis not available: %v", err)
+	}
+	defer client.Close()
+
+	key := "test:lock:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	defer client.Del(ctx, key)
+
+	first := NewRedisLock(client, key, 50*time.Millisecond)
+	if ok, err := first.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("expected first lock, got %v %v", ok, err)
+	}
+	second := NewRedisLock(client, key, time.Minute)
+	if ok, _ := second.TryLock(ctx); ok {
+		t.Fatalf("expected lock held by first")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if ok, err := second.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("expected second lock after expiry, got %v %v", ok, err)
+	}
+	if err := first.Unlock(ctx); err != nil {
+		t.Fatalf("unlock first: %v", err)
+	}
+	if n, _ := client.Exists(ctx, key).Result(); n != 1 {
+		t.Fatalf("expected second lock kept after stale unlock")
+	}
+	if err := second.Unlock(ctx); err != nil {
+		t.Fatalf("unlock second: %v", err)
+	}
+	if n, _ := client.Exists(ctx, key).Result(); n != 0 {
+		t.Fatalf("expected lock released")
+	}
+}
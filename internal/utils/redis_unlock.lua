@@ -0,0 +1,5 @@
+-- 只有锁仍由自己持有（value 与 token 相同）时才删除，避免误删其他实例在锁过期后拿到的锁
+if redis.call("get", KEYS[1]) == ARGV[1] then
+  return redis.call("del", KEYS[1])
+end
+return 0
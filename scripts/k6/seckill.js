@@ -7,6 +7,12 @@ const baseUrl = __ENV.BASE_URL || 'http://127.0.0.1:8081';
 const voucherId = __ENV.VOUCHER_ID || '12';
 const tokensFile = __ENV.TOKENS_FILE || 'tokens.csv';
 const rampWindow = __ENV.RAMP_WINDOW || '10s';
+// Comparison run: label this run, write its summary as JSON, and diff against a previous run.
+// e.g. SUMMARY_LABEL=mysql-check SUMMARY_JSON=baseline.json  (build before voucher meta cache)
+//      SUMMARY_LABEL=redis-meta BASELINE_FILE=baseline.json (current build)
+const summaryLabel = __ENV.SUMMARY_LABEL || 'current';
+const summaryJson = __ENV.SUMMARY_JSON || '';
+const baseline = __ENV.BASELINE_FILE ? JSON.parse(open(__ENV.BASELINE_FILE)) : null;
 
 const tokens = new SharedArray('tokens', () => {
   const lines = open(tokensFile)
@@ -36,6 +42,7 @@ export const options = {
       maxDuration: '2m',
     },
   },
+  summaryTrendStats: ['avg', 'min', 'med', 'max', 'p(90)', 'p(95)', 'p(99)'],
   thresholds: {
     // Keep business success rate visible; remove strict http_req_failed threshold for flash-sale tests.
     biz_success_rate: ['rate>=0'],
@@ -110,6 +117,16 @@ function parseDurationMs(input) {
   return parseInt(v, 10) || 0;
 }
 
+function compareLine(name, current, base, unit, lowerIsBetter) {
+  if (!base) {
+    return `${name}: ${current}${unit} (no baseline)`;
+  }
+  const diff = ((current - base) / base) * 100;
+  const better = lowerIsBetter ? diff < 0 : diff > 0;
+  const sign = diff >= 0 ? '+' : '';
+  return `${name}: ${base}${unit} -> ${current}${unit} (${sign}${diff.toFixed(1)}%${better ? ', better' : ''})`;
+}
+
 export function handleSummary(data) {
   const totalRequests = data.metrics.http_reqs
     ? data.metrics.http_reqs.values.count
@@ -118,9 +135,15 @@ export function handleSummary(data) {
   const p95 = data.metrics.http_req_duration
     ? Math.round(data.metrics.http_req_duration.values['p(95)'])
     : 0;
+  const p99 = data.metrics.http_req_duration && data.metrics.http_req_duration.values['p(99)'] !== undefined
+    ? Math.round(data.metrics.http_req_duration.values['p(99)'])
+    : 0;
   const avg = data.metrics.http_req_duration
     ? Math.round(data.metrics.http_req_duration.values.avg)
     : 0;
+  const rps = data.metrics.http_reqs
+    ? Math.round(data.metrics.http_reqs.values.rate)
+    : 0;
   const failRate = data.metrics.http_req_failed
     ? data.metrics.http_req_failed.values.rate
     : 0;
@@ -129,7 +152,7 @@ export function handleSummary(data) {
     ? data.metrics.biz_success_rate.values.rate
     : 0;
   const lines = [
-    '--- Seckill Summary ---',
+    `--- Seckill Summary (${summaryLabel}) ---`,
     `total requests: ${totalRequests}`,
     `total duration: ${totalDuration} ms`,
     `avg latency: ${avg} ms`,
@@ -145,7 +168,22 @@ export function handleSummary(data) {
     `status 5xx: ${data.metrics.status_500 ? data.metrics.status_500.values.count : 0}`,
   ];
 
-  return {
+  const result = { label: summaryLabel, totalRequests, totalDuration, rps, avg, p95, p99 };
+  if (baseline) {
+    lines.push(
+      `--- Compared with ${baseline.label} ---`,
+      compareLine('throughput', rps, baseline.rps, ' req/s', false),
+      compareLine('avg latency', avg, baseline.avg, ' ms', true),
+      compareLine('p95 latency', p95, baseline.p95, ' ms', true),
+      compareLine('p99 latency', p99, baseline.p99, ' ms', true),
+    );
+  }
+
+  const output = {
     stdout: `${lines.join('\n')}\n`,
   };
+  if (summaryJson) {
+    output[summaryJson] = JSON.stringify(result, null, 2);
+  }
+  return output;
 }
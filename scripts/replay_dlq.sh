@@ -1,6 +1,10 @@
 #!/usr/bin/env bash
 set -euo pipefail
 
+# 手工重放单条 DLQ 消息（排障用）。常规处理请使用管理接口：
+#   POST /admin/seckill/dlq/:id/replay  重放（原子预占 Redis 库存并重新投递）
+#   POST /admin/seckill/dlq/:id/discard 丢弃
+
 TOPIC="${TOPIC:-seckill-orders}"
 PAYLOAD_FILE="${PAYLOAD_FILE:-}"
 PAYLOAD="${PAYLOAD:-}"
@@ -40,17 +44,18 @@ if ! command -v python3 >/dev/null 2>&1; then
 fi
 voucher_id="$(python3 -c 'import json,sys;print(json.loads(sys.argv[1]).get("voucherId",""))' "${PAYLOAD}")"
 user_id="$(python3 -c 'import json,sys;print(json.loads(sys.argv[1]).get("userId",""))' "${PAYLOAD}")"
+quantity="$(python3 -c 'import json,sys;print(json.loads(sys.argv[1]).get("quantity") or 1)' "${PAYLOAD}")"
 if [[ -z "${voucher_id}" || -z "${user_id}" ]]; then
   echo "missing voucherId/userId in payload; cannot sync redis" >&2
   exit 1
 fi
 stock_key="seckill:stock:vid:${voucher_id}"
-order_key="order:vid:${voucher_id}"
+order_key="order:cnt:vid:${voucher_id}"
 if command -v redis-cli >/dev/null 2>&1; then
-  redis-cli -h "${REDIS_HOST}" -p "${REDIS_PORT}" -n "${REDIS_DB}" DECR "${stock_key}" >/dev/null
-  redis-cli -h "${REDIS_HOST}" -p "${REDIS_PORT}" -n "${REDIS_DB}" SADD "${order_key}" "${user_id}" >/dev/null
+  redis-cli -h "${REDIS_HOST}" -p "${REDIS_PORT}" -n "${REDIS_DB}" DECRBY "${stock_key}" "${quantity}" >/dev/null
+  redis-cli -h "${REDIS_HOST}" -p "${REDIS_PORT}" -n "${REDIS_DB}" HINCRBY "${order_key}" "${user_id}" "${quantity}" >/dev/null
 else
-  docker exec "${REDIS_CONTAINER}" redis-cli -n "${REDIS_DB}" DECR "${stock_key}" >/dev/null
-  docker exec "${REDIS_CONTAINER}" redis-cli -n "${REDIS_DB}" SADD "${order_key}" "${user_id}" >/dev/null
+  docker exec "${REDIS_CONTAINER}" redis-cli -n "${REDIS_DB}" DECRBY "${stock_key}" "${quantity}" >/dev/null
+  docker exec "${REDIS_CONTAINER}" redis-cli -n "${REDIS_DB}" HINCRBY "${order_key}" "${user_id}" "${quantity}" >/dev/null
 fi
 echo "requeued one message and synced redis"
@@ -14,12 +14,12 @@ if command -v redis-cli >/dev/null 2>&1; then
     SET "seckill:stock:vid:${VOUCHER_ID}" "${STOCK}" >/dev/null
 
   redis-cli -h "${REDIS_HOST}" -p "${REDIS_PORT}" -n "${REDIS_DB}" \
-    DEL "order:vid:${VOUCHER_ID}" >/dev/null
+    DEL "order:cnt:vid:${VOUCHER_ID}" >/dev/null
 else
   docker exec "${REDIS_CONTAINER}" redis-cli -n "${REDIS_DB}" \
     SET "seckill:stock:vid:${VOUCHER_ID}" "${STOCK}" >/dev/null
   docker exec "${REDIS_CONTAINER}" redis-cli -n "${REDIS_DB}" \
-    DEL "order:vid:${VOUCHER_ID}" >/dev/null
+    DEL "order:cnt:vid:${VOUCHER_ID}" >/dev/null
 fi
 
 echo "reset seckill voucher=${VOUCHER_ID} stock=${STOCK} (redis ${REDIS_HOST}:${REDIS_PORT}/${REDIS_DB})"
@@ -0,0 +1,3 @@
+-- 秒杀券支付超时时间（秒），0 表示使用 app.seckill.payTimeout 全局默认值
+ALTER TABLE tb_seckill_voucher
+  ADD COLUMN pay_timeout INT NOT NULL DEFAULT 0 COMMENT '支付超时时间（秒）' AFTER stock;
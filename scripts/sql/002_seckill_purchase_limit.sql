@@ -0,0 +1,7 @@
+-- 每人限购数量，<= 0 表示不限购；默认 1 保持原有“一人一单”语义
+ALTER TABLE tb_seckill_voucher
+  ADD COLUMN limit_per_user INT NOT NULL DEFAULT 1 COMMENT '每人限购数量' AFTER pay_timeout;
+
+-- 单个订单购买数量
+ALTER TABLE tb_voucher_order
+  ADD COLUMN quantity INT NOT NULL DEFAULT 1 COMMENT '购买数量' AFTER voucher_id;
@@ -0,0 +1,22 @@
+-- 秒杀订单死信记录，由 DLQ 消费端写入，供管理端查询、重放与丢弃
+CREATE TABLE IF NOT EXISTS tb_seckill_dlq (
+  id           BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  order_id     BIGINT          NOT NULL COMMENT '订单 ID',
+  user_id      BIGINT UNSIGNED NOT NULL COMMENT '用户 ID',
+  voucher_id   BIGINT UNSIGNED NOT NULL COMMENT '秒杀券 ID',
+  quantity     INT             NOT NULL DEFAULT 1 COMMENT '购买数量',
+  retry_count  INT             NOT NULL DEFAULT 0 COMMENT '进入死信前的重试次数',
+  replay_count INT             NOT NULL DEFAULT 0 COMMENT '已重放次数',
+  last_error   VARCHAR(1024)   NOT NULL DEFAULT '' COMMENT '最后一次错误',
+  payload      TEXT            NOT NULL COMMENT '原始消息 JSON',
+  status       TINYINT         NOT NULL DEFAULT 0 COMMENT '0 待处理 1 已重放 2 已丢弃',
+  operator_id  BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '处理人',
+  reason       VARCHAR(255)    NOT NULL DEFAULT '' COMMENT '丢弃原因',
+  handled_time TIMESTAMP       NULL DEFAULT NULL COMMENT '处理时间',
+  create_time  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  update_time  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uk_order_id (order_id),
+  KEY idx_voucher_status (voucher_id, status),
+  KEY idx_user_id (user_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT = '秒杀订单死信';
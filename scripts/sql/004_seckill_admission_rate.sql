@@ -0,0 +1,3 @@
+-- 等候室每秒放行人数，0 表示不启用等候室（直接秒杀）
+ALTER TABLE tb_seckill_voucher
+  ADD COLUMN admission_rate INT NOT NULL DEFAULT 0 COMMENT '等候室每秒放行人数' AFTER limit_per_user;